@@ -4,33 +4,60 @@ import (
 	"bitcask/config"
 	"bitcask/kv"
 	"bitcask/merge"
+	"context"
+	"io"
 )
 
 // DB is the key/value database. It contains a `KVStore` and a `MergeWorker`
 // 1. KVStore is an abstraction that encapsulates append-only log segments and KeyDirectory which is an in-memory hashmap
 // 2. Worker encapsulates the goroutine that performs merge and compaction of inactive segments
+// 3. RolloverWorker encapsulates the goroutine that rolls over the expired active segment, it exists only if config.Config.WithMaxSegmentAge is set
 type DB[Key config.BitCaskKey] struct {
-	kvStore *kv.KVStore[Key]
-	worker  *merge.Worker[Key]
+	kvStore        *kv.KVStore[Key]
+	worker         *merge.Worker[Key]
+	rolloverWorker *kv.RolloverWorker[Key]
 }
 
-// NewDB takes a configuration and starts a new database instance.
+// NewDB takes a configuration and starts a new database instance. The merge worker selects the oldest inactive segments for merge.
 func NewDB[Key config.BitCaskKey](config *config.Config[Key]) (*DB[Key], error) {
+	return NewDBWithSegmentSelector[Key](config, merge.NewOldestFirstSegmentSelector())
+}
+
+// NewDBWithSegmentSelector takes a configuration and a merge.SegmentSelector and starts a new database instance.
+// The merge worker uses the SegmentSelector to select the inactive segments for merge.
+func NewDBWithSegmentSelector[Key config.BitCaskKey](config *config.Config[Key], selector merge.SegmentSelector) (*DB[Key], error) {
 	kvStore, err := kv.NewKVStore[Key](config)
 	if err != nil {
 		return nil, err
 	}
-	return &DB[Key]{
+	db := &DB[Key]{
 		kvStore: kvStore,
-		worker:  merge.NewWorker[Key](kvStore, config.MergeConfig()),
-	}, nil
+		worker:  merge.NewWorkerWithSegmentSelector[Key](kvStore, config.MergeConfig(), selector),
+	}
+	if config.MaxSegmentAge() > 0 {
+		db.rolloverWorker = kv.NewRolloverWorker[Key](kvStore, config.MaxSegmentAge())
+	}
+	return db, nil
 }
 
-// Put adds a key value pair in the append-only log, followed by an entry in the hashmap inside KeyDirectory
+// Put adds a key value pair in the append-only log, followed by an entry in the hashmap inside KeyDirectory.
+// It returns a log.EntrySizeError if the key or the value exceeds its maximum size, refer to config.Config.WithMaxKeySize and config.Config.WithMaxValueSize
 func (db *DB[Key]) Put(key Key, value []byte) error {
 	return db.kvStore.Put(key, value)
 }
 
+// PutReader puts a key and a value of size bytes read from the reader, without holding the value in memory. It is meant for large values (up to ~4GB).
+// The value is staged to a file without the lock, so the other operations do not wait for the reader; the lock is held only to append the staged value.
+// A value is neither buffered nor compressed, and PutReader returns log.ErrEncryptedStream if encryption is enabled.
+func (db *DB[Key]) PutReader(key Key, reader io.Reader, size int64) error {
+	return db.kvStore.PutReader(key, reader, size)
+}
+
+// MultiPut puts all the key value pairs with a single acquisition of the write lock. MultiPut is not atomic, if it fails, the pairs put before the failure remain in the DB.
+func (db *DB[Key]) MultiPut(pairs []kv.KeyValuePair[Key]) error {
+	return db.kvStore.MultiPut(pairs)
+}
+
 // Update adds a key value pair in the append-only log, followed by updating the entry in the hashmap inside KeyDirectory
 // Both Update and Delete operations are append-only operations wrt log, but they are in-place update operations wrt KeyDirectory.
 func (db *DB[Key]) Update(key Key, value []byte) error {
@@ -53,9 +80,112 @@ func (db *DB[Key]) Get(key Key) ([]byte, error) {
 	return db.kvStore.Get(key)
 }
 
-// Shutdown performs a shutdown of the database that involves stopping the merge worker goroutine and shutting down the KVStore
+// MultiGet gets the values corresponding to all the keys with a single acquisition of the read lock, and returns a kv.MultiGetResult (the value or the error) for every key,
+// in the order of the keys. The reads are ordered by their position in the segment files, and can be parallelized across segments with config.Config.WithMultiGetParallelism.
+func (db *DB[Key]) MultiGet(keys []Key) []kv.MultiGetResult {
+	return db.kvStore.MultiGet(keys)
+}
+
+// GetReader returns an io.ReadCloser which reads the value corresponding to the key from the segment file, without reading the whole value in memory.
+// The caller must close the reader. Returns nil and error if the key is not found.
+func (db *DB[Key]) GetReader(key Key) (io.ReadCloser, error) {
+	return db.kvStore.GetReader(key)
+}
+
+// GetInto gets the value corresponding to the key into dst, reusing dst if its capacity is sufficient, and returns the value. Returns nil and error if the key is not found.
+// It is meant for the callers that reuse a buffer across reads to avoid an allocation per read.
+func (db *DB[Key]) GetInto(key Key, dst []byte) ([]byte, error) {
+	return db.kvStore.GetInto(key, dst)
+}
+
+// View gets the value corresponding to the key and invokes fn with it without copying the value. Returns the error returned by fn, or an error if the key is not found.
+// The value is valid only until fn returns, and fn must neither modify it nor write to the DB (the DB is read-locked while fn runs).
+func (db *DB[Key]) View(key Key, fn func(value []byte) error) error {
+	return db.kvStore.View(key, fn)
+}
+
+// Keys returns a snapshot of all the keys in the DB, in no particular order
+func (db *DB[Key]) Keys() []Key {
+	return db.kvStore.Keys()
+}
+
+// Iterate invokes fn with every key and its value until fn returns an error. The keys are a snapshot taken when Iterate begins, refer to kv.KVStore.Iterate
+func (db *DB[Key]) Iterate(fn func(key Key, value []byte) error) error {
+	return db.kvStore.Iterate(fn)
+}
+
+// CreateBucket creates a new bucket (a namespace of keys) and returns it, or kv.ErrBucketExists if the bucket already exists. Refer to kv.Bucket
+// The keys put directly in the DB belong to the default bucket, which is not visible to the named buckets
+func (db *DB[Key]) CreateBucket(name string) (*kv.Bucket[Key], error) {
+	return db.kvStore.CreateBucket(name)
+}
+
+// Bucket returns the bucket identified by the name, or kv.ErrBucketNotFound if the bucket does not exist
+func (db *DB[Key]) Bucket(name string) (*kv.Bucket[Key], error) {
+	return db.kvStore.Bucket(name)
+}
+
+// DropBucket drops the bucket identified by the name. The keys of the bucket disappear immediately, whereas their space is reclaimed by the merge. Refer to kv.KVStore.DropBucket
+func (db *DB[Key]) DropBucket(name string) error {
+	return db.kvStore.DropBucket(name)
+}
+
+// Buckets returns the names of all the buckets, in the increasing order
+func (db *DB[Key]) Buckets() []string {
+	return db.kvStore.BucketNames()
+}
+
+// Stats returns the statistics of the DB: the number of keys, the active and the inactive segments with their total, live and dead bytes, the number of tombstones,
+// the cumulative operation counters and the outcome of the last merge. Refer to Stats
+func (db *DB[Key]) Stats() *Stats {
+	return &Stats{Stats: *db.kvStore.Stats(), LastMerge: db.worker.LastOutcome()}
+}
+
+// CompressionStats returns the size of the values put since the database was started, before and after compression. Refer to config.Config.WithCompressor
+func (db *DB[Key]) CompressionStats() *kv.CompressionStats {
+	return db.kvStore.CompressionStats()
+}
+
+// ValueCacheStats returns the hits and the misses of the cache of the recently read values, nil if the cache is not enabled. Refer to config.Config.WithValueCache
+func (db *DB[Key]) ValueCacheStats() *kv.ValueCacheStats {
+	return db.kvStore.ValueCacheStats()
+}
+
+// Merge performs a merge of the inactive segments synchronously and returns the merge.Result.
+// It returns merge.ErrMergeInProgress if the merge worker is already performing a merge, and merge.ErrMergePaused if the merges are paused.
+// The context is checked between segments.
+func (db *DB[Key]) Merge(ctx context.Context) (*merge.Result, error) {
+	return db.worker.Merge(ctx)
+}
+
+// MergeBlobs performs the garbage collection of the blob segments synchronously and returns the merge.Result. Blob segments exist only if key-value separation
+// is enabled with config.Config.WithBlobValueThreshold. It returns the same errors as Merge.
+func (db *DB[Key]) MergeBlobs(ctx context.Context) (*merge.Result, error) {
+	return db.worker.MergeBlobs(ctx)
+}
+
+// Reencrypt re-encrypts the inactive segments which are not encrypted with the current key of the config.KeyProvider, and returns the merge.Result.
+// Refer to merge.Worker. It returns the same errors as Merge.
+func (db *DB[Key]) Reencrypt(ctx context.Context) (*merge.Result, error) {
+	return db.worker.Reencrypt(ctx)
+}
+
+// PauseMerge pauses the merges until ResumeMerge is invoked. A merge in progress is suspended, refer to merge.Worker
+func (db *DB[Key]) PauseMerge() {
+	db.worker.Pause()
+}
+
+// ResumeMerge resumes the merges paused by PauseMerge
+func (db *DB[Key]) ResumeMerge() {
+	db.worker.Resume()
+}
+
+// Shutdown performs a shutdown of the database that involves stopping the merge worker (and the rollover worker) goroutine and shutting down the KVStore
 func (db *DB[Key]) Shutdown() {
 	db.worker.Stop()
+	if db.rolloverWorker != nil {
+		db.rolloverWorker.Stop()
+	}
 	db.kvStore.Shutdown()
 }
 
@@ -2,7 +2,11 @@ package bitcask
 
 import (
 	"bitcask/config"
+	"context"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"testing"
 )
@@ -172,3 +176,218 @@ func TestReloadDB(t *testing.T) {
 		}
 	}
 }
+
+func TestMergeManually(t *testing.T) {
+	cfg := config.NewConfig[serializableKey](".", 8, 16, config.NewMergeConfigWithAllSegmentsToRead[serializableKey](func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	db, _ := NewDB[serializableKey](cfg)
+	defer db.Shutdown()
+	defer db.clearLog()
+
+	_ = db.Put("topic", []byte("microservices"))
+	_ = db.Put("topic", []byte("bitcask"))
+	_ = db.Put("disk", []byte("ssd"))
+
+	result, err := db.Merge(context.Background())
+	if err != nil {
+		t.Fatalf("Expected merge to succeed, received %v", err)
+	}
+	if result.SegmentsRead != 2 || result.EntriesDropped != 1 {
+		t.Fatalf("Expected %v segments to be read and %v entry to be dropped, received %v and %v", 2, 1, result.SegmentsRead, result.EntriesDropped)
+	}
+	value, _ := db.Get("topic")
+	if !reflect.DeepEqual([]byte("bitcask"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
+	}
+}
+
+func TestReloadAndMergeWithABuiltInKeyTypeWithoutAKeyMapper(t *testing.T) {
+	cfg := config.NewConfig[config.Uint64Key](".", 32, 16, config.NewMergeConfigWithAllSegmentsToRead[config.Uint64Key](nil))
+	db, _ := NewDB[config.Uint64Key](cfg)
+
+	for key := config.Uint64Key(0); key < 10; key++ {
+		_ = db.Put(key, []byte("value-"+strconv.Itoa(int(key))))
+	}
+	_ = db.Delete(3)
+	if _, err := db.Merge(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	db.Sync()
+	db.Shutdown()
+
+	db, _ = NewDB[config.Uint64Key](cfg)
+	defer db.Shutdown()
+	defer db.clearLog()
+
+	for key := config.Uint64Key(0); key < 10; key++ {
+		value, err := db.Get(key)
+		if key == 3 {
+			if err == nil {
+				t.Fatalf("Expected key %v to be deleted, received %v", key, string(value))
+			}
+			continue
+		}
+		if string(value) != "value-"+strconv.Itoa(int(key)) {
+			t.Fatalf("Expected value of key %v to be %v, received %v", key, "value-"+strconv.Itoa(int(key)), string(value))
+		}
+	}
+}
+
+func TestBucketsSurviveMergeAndReload(t *testing.T) {
+	cfg := config.NewConfig[serializableKey](".", 8, 16, config.NewMergeConfigWithAllSegmentsToRead[serializableKey](func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	db, _ := NewDB[serializableKey](cfg)
+
+	users, _ := db.CreateBucket("users")
+	sessions, _ := db.CreateBucket("sessions")
+	_ = db.Put("topic", []byte("microservices"))
+	_ = users.Put("topic", []byte("bitcask"))
+	_ = users.Put("topic", []byte("storage"))
+	_ = sessions.Put("topic", []byte("expired"))
+	_ = db.DropBucket("sessions")
+
+	if _, err := db.Merge(context.Background()); err != nil {
+		t.Fatalf("Expected merge to succeed, received %v", err)
+	}
+	db.Sync()
+	db.Shutdown()
+
+	db, _ = NewDB[serializableKey](cfg)
+	defer db.Shutdown()
+	defer db.clearLog()
+
+	if !reflect.DeepEqual([]string{"users"}, db.Buckets()) {
+		t.Fatalf("Expected the buckets to be %v, received %v", []string{"users"}, db.Buckets())
+	}
+	users, _ = db.Bucket("users")
+	value, _ := users.Get("topic")
+	if !reflect.DeepEqual([]byte("storage"), value) {
+		t.Fatalf("Expected value in the bucket to be %v, received %v", "storage", string(value))
+	}
+	value, _ = db.Get("topic")
+	if !reflect.DeepEqual([]byte("microservices"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+}
+
+func TestStatsAfterAMerge(t *testing.T) {
+	cfg := config.NewConfig[serializableKey](".", 8, 16, config.NewMergeConfigWithAllSegmentsToRead[serializableKey](func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	db, _ := NewDB[serializableKey](cfg)
+	defer db.Shutdown()
+	defer db.clearLog()
+
+	_ = db.Put("topic", []byte("microservices"))
+	_ = db.Put("topic", []byte("bitcask"))
+	_ = db.Put("disk", []byte("ssd"))
+
+	if stats := db.Stats(); stats.LastMerge != nil || stats.DeadBytes <= 0 {
+		t.Fatalf("Expected no merge and some dead bytes, received %v and %v dead bytes", stats.LastMerge, stats.DeadBytes)
+	}
+	result, _ := db.Merge(context.Background())
+
+	stats := db.Stats()
+	if stats.LastMerge == nil || stats.LastMerge.Result != result {
+		t.Fatalf("Expected the last merge to be recorded, received %v", stats.LastMerge)
+	}
+	if stats.Keys != 2 || stats.Operations.Puts != 3 {
+		t.Fatalf("Expected %v keys and %v puts, received %v and %v", 2, 3, stats.Keys, stats.Operations.Puts)
+	}
+	for _, segment := range stats.Segments {
+		if segment.GarbageBytes() != 0 {
+			t.Fatalf("Expected the merged segment %v to have no garbage, received %v garbage bytes", segment.FileId, segment.GarbageBytes())
+		}
+	}
+}
+
+func TestReopenADBWithAPartialEntryAtTheEndOfTheNewestSegment(t *testing.T) {
+	for _, truncatedBytes := range []int64{3, 10} {
+		cfg := config.NewConfig[serializableKey](".", 64, 16, config.NewMergeConfig[serializableKey](2, func(key []byte) serializableKey {
+			return serializableKey(key)
+		}))
+		db, _ := NewDB[serializableKey](cfg)
+		_ = db.Put("topic", []byte("microservices"))
+		_ = db.Put("disk", []byte("solid state drive"))
+		db.Sync()
+		db.Shutdown()
+
+		filePaths, _ := filepath.Glob("*_bitcask.data")
+		newestFilePath := filePaths[len(filePaths)-1]
+		fileInfo, _ := os.Stat(newestFilePath)
+		_ = os.Truncate(newestFilePath, fileInfo.Size()-truncatedBytes)
+
+		db, err := NewDB[serializableKey](cfg)
+		if err != nil {
+			t.Fatalf("Expected the DB to reopen after truncating %v bytes, received %v", truncatedBytes, err)
+		}
+		value, _ := db.Get("topic")
+		if !reflect.DeepEqual([]byte("microservices"), value) {
+			t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+		}
+		if _, err := db.Get("disk"); err == nil {
+			t.Fatalf("Expected the partial entry of %v to be dropped after truncating %v bytes", "disk", truncatedBytes)
+		}
+		_ = db.Put("disk", []byte("ssd"))
+		value, _ = db.Get("disk")
+		if !reflect.DeepEqual([]byte("ssd"), value) {
+			t.Fatalf("Expected value to be %v, received %v", "ssd", string(value))
+		}
+		db.clearLog()
+		db.Shutdown()
+	}
+}
+
+func TestReopenADBWithAPartialEntryAtTheEndOfAMergedSegment(t *testing.T) {
+	cfg := config.NewConfig[serializableKey](".", 8, 16, config.NewMergeConfig[serializableKey](2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	db, _ := NewDB[serializableKey](cfg)
+	_ = db.Put("topic", []byte("microservices"))
+	_ = db.Put("disk", []byte("ssd"))
+	_ = db.Put("engine", []byte("bitcask"))
+
+	filePathsBeforeMerge, _ := filepath.Glob("*_bitcask.data")
+	if _, err := db.Merge(context.Background()); err != nil {
+		t.Fatalf("Expected merge to succeed, received %v", err)
+	}
+	_ = db.Put("paradigm", []byte("append-only"))
+	db.Sync()
+	db.Shutdown()
+
+	filePaths, _ := filepath.Glob("*_bitcask.data")
+	var mergedFilePath string
+	for _, filePath := range filePaths {
+		if !slices.Contains(filePathsBeforeMerge, filePath) {
+			mergedFilePath = filePath
+			break
+		}
+	}
+	if mergedFilePath == "" || mergedFilePath == filePaths[len(filePaths)-1] {
+		t.Fatalf("Expected a merged segment older than the active segment, received %v", filePaths)
+	}
+	content, _ := os.ReadFile(mergedFilePath)
+	file, _ := os.OpenFile(mergedFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.Write(content[:len(content)-3])
+	_ = file.Close()
+
+	db, err := NewDB[serializableKey](cfg)
+	if err != nil {
+		t.Fatalf("Expected the DB to reopen with a partial entry at the end of a merged segment, received %v", err)
+	}
+	defer db.Shutdown()
+	defer db.clearLog()
+
+	for key, expected := range map[serializableKey]string{"topic": "microservices", "disk": "ssd", "engine": "bitcask", "paradigm": "append-only"} {
+		value, _ := db.Get(key)
+		if !reflect.DeepEqual([]byte(expected), value) {
+			t.Fatalf("Expected value of %v to be %v, received %v", key, expected, string(value))
+		}
+	}
+	fileInfo, _ := os.Stat(mergedFilePath)
+	if fileInfo.Size() != int64(len(content)) {
+		t.Fatalf("Expected the merged segment to be truncated to %v bytes, received %v", len(content), fileInfo.Size())
+	}
+}
@@ -0,0 +1,13 @@
+package bitcask
+
+import (
+	"bitcask/kv"
+	"bitcask/merge"
+)
+
+// Stats describes the size of the DB (refer to kv.Stats) along with the Outcome of the last merge, which is nil if no merge has been performed since the DB was started.
+// The statistics are computed from the in-memory state, so DB.Stats does not read the segment files.
+type Stats struct {
+	kv.Stats
+	LastMerge *merge.Outcome
+}
@@ -0,0 +1,86 @@
+package bitcask
+
+import (
+	"bitcask/config"
+)
+
+// TypedDB is a typed wrapper over DB which stores the values of type Value. The values are encoded by the config.Codec before they are put,
+// and decoded after they are read, so TypedDB stores the values in the same format as DB. A DB can be used through a TypedDB and directly (refer to DB)
+// at the same time, as long as the values put directly are encoded by the same Codec.
+type TypedDB[Key config.BitCaskKey, Value any] struct {
+	db    *DB[Key]
+	codec config.Codec[Value]
+}
+
+// NewTypedDB takes a configuration and a config.Codec, and starts a new database instance which stores the values of type Value
+func NewTypedDB[Key config.BitCaskKey, Value any](config *config.Config[Key], codec config.Codec[Value]) (*TypedDB[Key, Value], error) {
+	db, err := NewDB[Key](config)
+	if err != nil {
+		return nil, err
+	}
+	return NewTypedDBFrom[Key, Value](db, codec), nil
+}
+
+// NewTypedDBFrom creates a TypedDB over an existing DB, which stores the values of type Value encoded by the config.Codec
+func NewTypedDBFrom[Key config.BitCaskKey, Value any](db *DB[Key], codec config.Codec[Value]) *TypedDB[Key, Value] {
+	return &TypedDB[Key, Value]{db: db, codec: codec}
+}
+
+// Put encodes the value and puts the key and the encoded value, refer to DB.Put
+func (typedDB *TypedDB[Key, Value]) Put(key Key, value Value) error {
+	encoded, err := typedDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return typedDB.db.Put(key, encoded)
+}
+
+// Update encodes the value and updates the key with the encoded value, refer to DB.Update
+func (typedDB *TypedDB[Key, Value]) Update(key Key, value Value) error {
+	encoded, err := typedDB.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return typedDB.db.Update(key, encoded)
+}
+
+// Delete deletes the key, refer to DB.Delete
+func (typedDB *TypedDB[Key, Value]) Delete(key Key) error {
+	return typedDB.db.Delete(key)
+}
+
+// Get gets the value corresponding to the key and decodes it. Returns the zero value and an error if the key does not exist or if the value can not be decoded
+func (typedDB *TypedDB[Key, Value]) Get(key Key) (Value, error) {
+	encoded, err := typedDB.db.Get(key)
+	if err != nil {
+		var zero Value
+		return zero, err
+	}
+	return typedDB.codec.Decode(encoded)
+}
+
+// Iterate invokes fn with every key and its decoded value until fn returns an error, refer to DB.Iterate. A value which can not be decoded stops the iteration with the error
+func (typedDB *TypedDB[Key, Value]) Iterate(fn func(key Key, value Value) error) error {
+	return typedDB.db.Iterate(func(key Key, encoded []byte) error {
+		value, err := typedDB.codec.Decode(encoded)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+// DB returns the underlying DB, which offers the operations on the encoded values and the operations which do not involve values (for example, Merge)
+func (typedDB *TypedDB[Key, Value]) DB() *DB[Key] {
+	return typedDB.db
+}
+
+// Sync performs a sync of all the active and inactive segments, refer to DB.Sync
+func (typedDB *TypedDB[Key, Value]) Sync() {
+	typedDB.db.Sync()
+}
+
+// Shutdown performs a shutdown of the underlying DB, refer to DB.Shutdown
+func (typedDB *TypedDB[Key, Value]) Shutdown() {
+	typedDB.db.Shutdown()
+}
@@ -0,0 +1,87 @@
+package bitcask
+
+import (
+	"bitcask/config"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type topic struct {
+	Name       string
+	Partitions int
+}
+
+func TestPutAndGetATypedValue(t *testing.T) {
+	cfg := config.NewConfig[config.StringKey](".", 128, 16, config.NewMergeConfig[config.StringKey](2, nil))
+	db, _ := NewTypedDB[config.StringKey, topic](cfg, config.NewJSONCodec[topic]())
+	defer db.Shutdown()
+	defer db.DB().clearLog()
+
+	_ = db.Put("microservices", topic{Name: "microservices", Partitions: 3})
+	_ = db.Update("microservices", topic{Name: "microservices", Partitions: 6})
+
+	value, err := db.Get("microservices")
+	if err != nil || !reflect.DeepEqual(topic{Name: "microservices", Partitions: 6}, value) {
+		t.Fatalf("Expected value to be %v, received %v (%v)", topic{Name: "microservices", Partitions: 6}, value, err)
+	}
+	encoded, _ := db.DB().Get("microservices")
+	if string(encoded) != `{"Name":"microservices","Partitions":6}` {
+		t.Fatalf("Expected the stored value to be the JSON encoding, received %v", string(encoded))
+	}
+}
+
+func TestGetATypedValueOfANonExistentKey(t *testing.T) {
+	cfg := config.NewConfig[config.StringKey](".", 128, 16, config.NewMergeConfig[config.StringKey](2, nil))
+	db, _ := NewTypedDB[config.StringKey, topic](cfg, config.NewGobCodec[topic]())
+	defer db.Shutdown()
+	defer db.DB().clearLog()
+
+	value, err := db.Get("non-existing")
+	if err == nil || value != (topic{}) {
+		t.Fatalf("Expected an error and the zero value, received %v and %v", err, value)
+	}
+}
+
+func TestIterateTypedValues(t *testing.T) {
+	cfg := config.NewConfig[config.StringKey](".", 64, 16, config.NewMergeConfig[config.StringKey](2, nil))
+	db, _ := NewTypedDB[config.StringKey, topic](cfg, config.NewGobCodec[topic]())
+	defer db.Shutdown()
+	defer db.DB().clearLog()
+
+	_ = db.Put("microservices", topic{Name: "microservices", Partitions: 3})
+	_ = db.Put("storage", topic{Name: "storage", Partitions: 1})
+	_ = db.Put("deleted", topic{Name: "deleted", Partitions: 2})
+	_ = db.Delete("deleted")
+
+	values := make(map[config.StringKey]topic)
+	_ = db.Iterate(func(key config.StringKey, value topic) error {
+		values[key] = value
+		return nil
+	})
+	expected := map[config.StringKey]topic{
+		"microservices": {Name: "microservices", Partitions: 3},
+		"storage":       {Name: "storage", Partitions: 1},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Fatalf("Expected the iterated values to be %v, received %v", expected, values)
+	}
+}
+
+func TestIterateTypedValuesStopsAtAnError(t *testing.T) {
+	cfg := config.NewConfig[config.StringKey](".", 128, 16, config.NewMergeConfig[config.StringKey](2, nil))
+	db, _ := NewTypedDB[config.StringKey, topic](cfg, config.NewJSONCodec[topic]())
+	defer db.Shutdown()
+	defer db.DB().clearLog()
+
+	_ = db.Put("microservices", topic{Name: "microservices", Partitions: 3})
+	_ = db.DB().Put("storage", []byte("not json"))
+
+	stop := errors.New("stop")
+	err := db.Iterate(func(key config.StringKey, value topic) error {
+		return stop
+	})
+	if err == nil {
+		t.Fatalf("Expected the iteration to stop with an error")
+	}
+}
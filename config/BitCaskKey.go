@@ -1,10 +1,57 @@
 package config
 
+import "errors"
+
 type Serializable interface {
 	Serialize() []byte
 }
 
+// Deserializable is implemented by a key type which can decode itself from the bytes returned by its Serialize method.
+// Deserialize is invoked on the zero value of the key type, so it must not depend on the receiver. A key type which implements Deserializable
+// does not need a keyMapper in MergeConfig, refer to MergeConfig.KeyMapper. Refer to Keys.go for the built-in key types.
+type Deserializable[Key any] interface {
+	Deserialize(serialized []byte) Key
+}
+
 type BitCaskKey interface {
 	comparable
 	Serializable
 }
+
+// DeserializerOf returns the Deserialize method of the key type as a keyMapper, or nil if the key type does not implement Deserializable
+func DeserializerOf[Key BitCaskKey]() func([]byte) Key {
+	var zero Key
+	deserializable, ok := any(zero).(Deserializable[Key])
+	if !ok {
+		return nil
+	}
+	return deserializable.Deserialize
+}
+
+// FixedSizeKey is implemented by a key type whose serialized form always has the same number of bytes, like the built-in Int64Key, Uint64Key and UUIDKey.
+// The reload and the merge reject a serialized key of another size instead of decoding it, refer to KeyDecoderOf
+type FixedSizeKey interface {
+	SerializedSize() int
+}
+
+// ErrInvalidKeySize is returned by the decoder of KeyDecoderOf for a serialized key whose size differs from the SerializedSize of its FixedSizeKey type
+var ErrInvalidKeySize = errors.New("the serialized key does not have the size of the key type")
+
+// KeyDecoderOf wraps the keyMapper into a decoder which returns ErrInvalidKeySize if the key type is a FixedSizeKey and the serialized key has a different size,
+// so that a damaged key is reported instead of being decoded into a different key. The keyMapper is invoked as is for the other key types
+func KeyDecoderOf[Key BitCaskKey](keyMapper func([]byte) Key) func([]byte) (Key, error) {
+	var zero Key
+	fixedSizeKey, ok := any(zero).(FixedSizeKey)
+	if !ok {
+		return func(serialized []byte) (Key, error) {
+			return keyMapper(serialized), nil
+		}
+	}
+	size := fixedSizeKey.SerializedSize()
+	return func(serialized []byte) (Key, error) {
+		if len(serialized) != size {
+			return zero, ErrInvalidKeySize
+		}
+		return keyMapper(serialized), nil
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encodes a typed value to the bytes stored by the DB and decodes the bytes back to the typed value. It is used by the typed DB (refer to TypedDB.go),
+// the bytes are stored like any other value, so a Codec does not change the format of the segment files
+type Codec[Value any] interface {
+	Encode(value Value) ([]byte, error)
+	Decode(encoded []byte) (Value, error)
+}
+
+// JSONCodec is a Codec based on the standard library's encoding/json
+type JSONCodec[Value any] struct{}
+
+// NewJSONCodec creates a new instance of JSONCodec
+func NewJSONCodec[Value any]() *JSONCodec[Value] {
+	return &JSONCodec[Value]{}
+}
+
+func (codec *JSONCodec[Value]) Encode(value Value) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (codec *JSONCodec[Value]) Decode(encoded []byte) (Value, error) {
+	var value Value
+	err := json.Unmarshal(encoded, &value)
+	return value, err
+}
+
+// GobCodec is a Codec based on the standard library's encoding/gob. Every value is encoded with its own gob.Encoder,
+// so every encoded value carries the description of its type
+type GobCodec[Value any] struct{}
+
+// NewGobCodec creates a new instance of GobCodec
+func NewGobCodec[Value any]() *GobCodec[Value] {
+	return &GobCodec[Value]{}
+}
+
+func (codec *GobCodec[Value]) Encode(value Value) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (codec *GobCodec[Value]) Decode(encoded []byte) (Value, error) {
+	var value Value
+	err := gob.NewDecoder(bytes.NewReader(encoded)).Decode(&value)
+	return value, err
+}
+
+// BytesCodec is a Codec for the raw byte slice values, it stores the bytes as they are
+type BytesCodec struct{}
+
+// NewBytesCodec creates a new instance of BytesCodec
+func NewBytesCodec() *BytesCodec {
+	return &BytesCodec{}
+}
+
+func (codec *BytesCodec) Encode(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+func (codec *BytesCodec) Decode(encoded []byte) ([]byte, error) {
+	return encoded, nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+type topic struct {
+	Name       string
+	Partitions int
+	Replicated bool
+}
+
+func TestJSONCodecEncodesAndDecodes(t *testing.T) {
+	codec := NewJSONCodec[topic]()
+	value := topic{Name: "microservices", Partitions: 3, Replicated: true}
+
+	encoded, _ := codec.Encode(value)
+	decoded, err := codec.Decode(encoded)
+	if err != nil || !reflect.DeepEqual(value, decoded) {
+		t.Fatalf("Expected the decoded value to be %v, received %v (%v)", value, decoded, err)
+	}
+}
+
+func TestJSONCodecFailsToDecodeAnInvalidValue(t *testing.T) {
+	if _, err := NewJSONCodec[topic]().Decode([]byte("microservices")); err == nil {
+		t.Fatalf("Expected an error while decoding an invalid value but received none")
+	}
+}
+
+func TestGobCodecEncodesAndDecodes(t *testing.T) {
+	codec := NewGobCodec[topic]()
+	value := topic{Name: "microservices", Partitions: 3, Replicated: true}
+
+	encoded, _ := codec.Encode(value)
+	decoded, err := codec.Decode(encoded)
+	if err != nil || !reflect.DeepEqual(value, decoded) {
+		t.Fatalf("Expected the decoded value to be %v, received %v (%v)", value, decoded, err)
+	}
+}
+
+func TestBytesCodecStoresTheBytesAsTheyAre(t *testing.T) {
+	codec := NewBytesCodec()
+
+	encoded, _ := codec.Encode([]byte("microservices"))
+	decoded, _ := codec.Decode(encoded)
+	if string(encoded) != "microservices" || string(decoded) != "microservices" {
+		t.Fatalf("Expected the encoded and the decoded values to be %v, received %v and %v", "microservices", string(encoded), string(decoded))
+	}
+}
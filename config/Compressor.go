@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+)
+
+// Compressor compresses the values before they are written to the segment files and decompresses them when they are read.
+// A value is stored compressed only if its compressed form is smaller, and every entry carries a flag indicating if its value is compressed,
+// so compressed and uncompressed entries (and segments) coexist. A DB that has written compressed values must be opened with a Compressor
+// that can decompress them, FlateCompressor is used to decompress if no Compressor is configured.
+type Compressor interface {
+	Compress(value []byte) ([]byte, error)
+	Decompress(compressed []byte) ([]byte, error)
+}
+
+// FlateCompressor is a Compressor based on the DEFLATE format of the standard library's compress/flate
+type FlateCompressor struct {
+	level int
+}
+
+// NewFlateCompressor creates a new instance of FlateCompressor with the compression level, ranging from flate.BestSpeed to flate.BestCompression
+func NewFlateCompressor(level int) *FlateCompressor {
+	return &FlateCompressor{level: level}
+}
+
+// Compress compresses the value. It returns an error if the compression level is invalid
+func (compressor *FlateCompressor) Compress(value []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, compressor.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(value); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decompress decompresses the value compressed by Compress, irrespective of the compression level
+func (compressor *FlateCompressor) Decompress(compressed []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"compress/flate"
+	"strings"
+	"testing"
+)
+
+func TestFlateCompressorCompressesAndDecompresses(t *testing.T) {
+	compressor := NewFlateCompressor(flate.BestSpeed)
+	value := []byte(strings.Repeat(`{"topic":"microservices","engine":"bitcask"}`, 10))
+
+	compressed, _ := compressor.Compress(value)
+	if len(compressed) >= len(value) {
+		t.Fatalf("Expected the compressed value to be smaller than %v bytes, received %v bytes", len(value), len(compressed))
+	}
+	decompressed, _ := compressor.Decompress(compressed)
+	if string(decompressed) != string(value) {
+		t.Fatalf("Expected the decompressed value to be %v, received %v", string(value), string(decompressed))
+	}
+}
+
+func TestFlateCompressorWithAnInvalidLevel(t *testing.T) {
+	compressor := NewFlateCompressor(20)
+
+	_, err := compressor.Compress([]byte("microservices"))
+	if err == nil {
+		t.Fatalf("Expected an error while compressing with an invalid level but received none")
+	}
+}
@@ -1,6 +1,10 @@
 package config
 
-import "bitcask/clock"
+import (
+	"bitcask/clock"
+	"bitcask/metrics"
+	"time"
+)
 
 type Config[Key BitCaskKey] struct {
 	directory            string
@@ -8,6 +12,20 @@ type Config[Key BitCaskKey] struct {
 	keyDirectoryCapacity uint64
 	mergeConfig          *MergeConfig[Key]
 	clock                clock.Clock
+	blobValueThreshold   uint64
+	compressor           Compressor
+	keyProvider          KeyProvider
+	valueCacheBytes      uint64
+	memoryMappedReads    bool
+	multiGetParallelism  int
+	reloadParallelism    int
+	reloadProgress       func(ReloadProgress)
+	maxKeySizeBytes      uint64
+	maxValueSizeBytes    uint64
+	preallocateSegments  bool
+	maxSegmentAge        time.Duration
+	metrics              *metrics.Metrics
+	eventListener        EventListener
 }
 
 func NewConfig[Key BitCaskKey](directory string, maxSegmentSizeBytes uint64, keyDirectoryCapacity uint64, mergeConfig *MergeConfig[Key]) *Config[Key] {
@@ -27,6 +45,7 @@ func NewConfigWithClock[Key BitCaskKey](
 		keyDirectoryCapacity: keyDirectoryCapacity,
 		mergeConfig:          mergeConfig,
 		clock:                clock,
+		eventListener:        NoOpEventListener{},
 	}
 }
 
@@ -49,3 +68,153 @@ func (config *Config[Key]) Clock() clock.Clock {
 func (config *Config[Key]) MergeConfig() *MergeConfig[Key] {
 	return config.mergeConfig
 }
+
+func (config *Config[Key]) BlobValueThresholdInBytes() uint64 {
+	return config.blobValueThreshold
+}
+
+// WithBlobValueThreshold enables key-value separation: the values larger than blobValueThreshold bytes are written to separate blob segment files
+// and the segment files store only a reference to them. 0 disables key-value separation
+func (config *Config[Key]) WithBlobValueThreshold(blobValueThreshold uint64) *Config[Key] {
+	config.blobValueThreshold = blobValueThreshold
+	return config
+}
+
+func (config *Config[Key]) Compressor() Compressor {
+	return config.compressor
+}
+
+// WithCompressor enables compression of the values with the provided Compressor, refer to Compressor
+func (config *Config[Key]) WithCompressor(compressor Compressor) *Config[Key] {
+	config.compressor = compressor
+	return config
+}
+
+func (config *Config[Key]) KeyProvider() KeyProvider {
+	return config.keyProvider
+}
+
+// WithKeyProvider enables encryption of the segment files with the keys provided by the KeyProvider, refer to KeyProvider
+func (config *Config[Key]) WithKeyProvider(keyProvider KeyProvider) *Config[Key] {
+	config.keyProvider = keyProvider
+	return config
+}
+
+func (config *Config[Key]) ValueCacheSizeInBytes() uint64 {
+	return config.valueCacheBytes
+}
+
+// WithValueCache enables an in-memory cache of the recently read values which holds up to valueCacheBytes of keys and values. 0 disables the cache
+func (config *Config[Key]) WithValueCache(valueCacheBytes uint64) *Config[Key] {
+	config.valueCacheBytes = valueCacheBytes
+	return config
+}
+
+func (config *Config[Key]) MemoryMappedReads() bool {
+	return config.memoryMappedReads
+}
+
+// WithMemoryMappedReads enables the reads of the inactive (immutable) segment files from read-only memory mappings, which avoids a system call per read.
+// The values read from a memory mapping are copied before they are returned
+func (config *Config[Key]) WithMemoryMappedReads(memoryMappedReads bool) *Config[Key] {
+	config.memoryMappedReads = memoryMappedReads
+	return config
+}
+
+func (config *Config[Key]) MultiGetParallelism() int {
+	return config.multiGetParallelism
+}
+
+// WithMultiGetParallelism sets the maximum number of goroutines that read the segments concurrently during a MultiGet. 0 or 1 reads the segments sequentially
+func (config *Config[Key]) WithMultiGetParallelism(parallelism int) *Config[Key] {
+	config.multiGetParallelism = parallelism
+	return config
+}
+
+func (config *Config[Key]) ReloadParallelism() int {
+	return config.reloadParallelism
+}
+
+// WithReloadParallelism sets the maximum number of inactive segments decoded concurrently during start-up. 0 uses runtime.GOMAXPROCS(0).
+// The keyMapper of MergeConfig is invoked by the concurrent decodes, so it must be safe for concurrent use unless the parallelism is 1
+func (config *Config[Key]) WithReloadParallelism(parallelism int) *Config[Key] {
+	config.reloadParallelism = parallelism
+	return config
+}
+
+func (config *Config[Key]) ReloadProgress() func(ReloadProgress) {
+	return config.reloadProgress
+}
+
+// WithReloadProgress sets the callback which is invoked during start-up after every inactive segment is reloaded, refer to ReloadProgress
+func (config *Config[Key]) WithReloadProgress(reloadProgress func(ReloadProgress)) *Config[Key] {
+	config.reloadProgress = reloadProgress
+	return config
+}
+
+func (config *Config[Key]) MaxKeySizeInBytes() uint64 {
+	return config.maxKeySizeBytes
+}
+
+// WithMaxKeySize sets the maximum size of a serialized key, a put or a delete of a larger key fails with an error. 0 limits the key only by the encoding of an entry
+func (config *Config[Key]) WithMaxKeySize(maxKeySizeBytes uint64) *Config[Key] {
+	config.maxKeySizeBytes = maxKeySizeBytes
+	return config
+}
+
+func (config *Config[Key]) MaxValueSizeInBytes() uint64 {
+	return config.maxValueSizeBytes
+}
+
+// WithMaxValueSize sets the maximum size of a value, a put of a larger value fails with an error. 0 limits the value only by the encoding of an entry
+func (config *Config[Key]) WithMaxValueSize(maxValueSizeBytes uint64) *Config[Key] {
+	config.maxValueSizeBytes = maxValueSizeBytes
+	return config
+}
+
+func (config *Config[Key]) SegmentPreallocation() bool {
+	return config.preallocateSegments
+}
+
+// WithSegmentPreallocation enables the preallocation of the disk space of a new segment file up to the segment size threshold, which reduces
+// the fragmentation of the file and the cost of extending it on every append. It is supported only on Linux and is ignored on the other platforms
+func (config *Config[Key]) WithSegmentPreallocation(preallocateSegments bool) *Config[Key] {
+	config.preallocateSegments = preallocateSegments
+	return config
+}
+
+func (config *Config[Key]) MaxSegmentAge() time.Duration {
+	return config.maxSegmentAge
+}
+
+// WithMaxSegmentAge rolls over the active segment file (and the active blob segment file) once its first entry is older than maxSegmentAge,
+// even if no further write arrives, so that the segment files become inactive promptly under a low write volume. 0 rolls over the segment files only by size
+func (config *Config[Key]) WithMaxSegmentAge(maxSegmentAge time.Duration) *Config[Key] {
+	config.maxSegmentAge = maxSegmentAge
+	return config
+}
+
+func (config *Config[Key]) Metrics() *metrics.Metrics {
+	return config.metrics
+}
+
+// WithMetrics enables the instrumentation of bitcask: the latencies of the operations, the bytes written and read, the rollovers of the segment files, the merges,
+// the reload and the lock waits are recorded in the metrics, which are exposed in the Prometheus text exposition format by metrics.Metrics.Handler. nil disables it
+func (config *Config[Key]) WithMetrics(metrics *metrics.Metrics) *Config[Key] {
+	config.metrics = metrics
+	return config
+}
+
+func (config *Config[Key]) EventListener() EventListener {
+	return config.eventListener
+}
+
+// WithEventListener sets the EventListener which is notified of the rollovers and the removals of the segments, the merges, the reload progress and the corruptions.
+// Refer to EventListener and NewSlogEventListener. nil restores the NoOpEventListener
+func (config *Config[Key]) WithEventListener(eventListener EventListener) *Config[Key] {
+	if eventListener == nil {
+		eventListener = NoOpEventListener{}
+	}
+	config.eventListener = eventListener
+	return config
+}
@@ -0,0 +1,40 @@
+package config
+
+// EventListener is notified of the events of bitcask: the rollovers and the removals of the segment files, the merges, the progress of the reload and the corruptions.
+// The callbacks are invoked synchronously by the goroutine which causes the event, some of them with the lock of the key value store held (the rollovers, the removals,
+// the reload progress and the corruptions), so a callback must return quickly and must not invoke an operation of the DB.
+// An implementation which is interested in a few events can embed NoOpEventListener. Refer to SlogEventListener for an EventListener which logs the events.
+type EventListener interface {
+	// SegmentRolledOver is invoked after the active segment (or the active blob segment) becomes inactive
+	SegmentRolledOver(event SegmentRolloverEvent)
+	// SegmentRemoved is invoked after a segment file (or a blob segment file) is removed from disk, refer to SegmentRemovalReason
+	SegmentRemoved(event SegmentRemovalEvent)
+	// MergeStarted is invoked when a merge starts merging the selected segments. A merge which finds nothing to merge is not started
+	MergeStarted(event MergeStartEvent)
+	// MergeFinished is invoked when a started merge completes
+	MergeFinished(event MergeFinishEvent)
+	// MergeFailed is invoked when a started merge fails or is cancelled
+	MergeFailed(event MergeFailureEvent)
+	// ReloadProgressed is invoked during start-up after every inactive segment is reloaded, like the callback of Config.WithReloadProgress
+	ReloadProgressed(progress ReloadProgress)
+	// CorruptionDetected is invoked when a segment can not be read or decoded during start-up, the start-up then fails with the same error,
+	// unless the corruption is a partial entry at the end of the segment which is truncated. Refer to CorruptionEvent
+	CorruptionDetected(event CorruptionEvent)
+}
+
+// NoOpEventListener is an EventListener which ignores all the events. It is the default EventListener of Config
+type NoOpEventListener struct{}
+
+func (NoOpEventListener) SegmentRolledOver(SegmentRolloverEvent) {}
+
+func (NoOpEventListener) SegmentRemoved(SegmentRemovalEvent) {}
+
+func (NoOpEventListener) MergeStarted(MergeStartEvent) {}
+
+func (NoOpEventListener) MergeFinished(MergeFinishEvent) {}
+
+func (NoOpEventListener) MergeFailed(MergeFailureEvent) {}
+
+func (NoOpEventListener) ReloadProgressed(ReloadProgress) {}
+
+func (NoOpEventListener) CorruptionDetected(CorruptionEvent) {}
@@ -0,0 +1,98 @@
+package config
+
+import "time"
+
+// SegmentRolloverEvent describes a rollover of the active segment, or of the active blob segment if Blob is true.
+// FileId and SizeInBytes identify the segment which became inactive.
+type SegmentRolloverEvent struct {
+	FileId      uint64
+	SizeInBytes int64
+	Blob        bool
+}
+
+// SegmentRemovalReason is the reason a segment file is removed
+type SegmentRemovalReason int
+
+const (
+	// SegmentMerged is the reason of the removal of a segment whose live entries have been written to new segments by a merge
+	SegmentMerged SegmentRemovalReason = iota
+	// SegmentEmpty is the reason of the removal of an empty segment during start-up or during a rollover, including a segment with only a partial entry
+	SegmentEmpty
+)
+
+// String returns the name of the SegmentRemovalReason
+func (reason SegmentRemovalReason) String() string {
+	switch reason {
+	case SegmentMerged:
+		return "merged"
+	case SegmentEmpty:
+		return "empty"
+	}
+	return "unknown"
+}
+
+// SegmentRemovalEvent describes the removal of a segment file, or of a blob segment file if Blob is true
+type SegmentRemovalEvent struct {
+	FileId uint64
+	Blob   bool
+	Reason SegmentRemovalReason
+}
+
+// MergeKind is the kind of a merge: a merge of the segments, a garbage collection of the blob segments or a re-encryption
+type MergeKind int
+
+const (
+	// SegmentsMerge is the merge of the inactive segments, refer to merge.Worker.Merge
+	SegmentsMerge MergeKind = iota
+	// BlobSegmentsMerge is the garbage collection of the inactive blob segments, refer to merge.Worker.MergeBlobs
+	BlobSegmentsMerge
+	// Reencryption is the merge of the segments which are not encrypted with the current key, refer to merge.Worker.Reencrypt
+	Reencryption
+)
+
+// String returns the name of the MergeKind
+func (kind MergeKind) String() string {
+	switch kind {
+	case SegmentsMerge:
+		return "segments"
+	case BlobSegmentsMerge:
+		return "blob segments"
+	case Reencryption:
+		return "reencryption"
+	}
+	return "unknown"
+}
+
+// MergeStartEvent describes a merge which starts merging the segments (or the blob segments) identified by FileIds
+type MergeStartEvent struct {
+	Kind    MergeKind
+	FileIds []uint64
+}
+
+// MergeFinishEvent describes a merge which completed, refer to merge.Result for the meaning of the counts
+type MergeFinishEvent struct {
+	Kind            MergeKind
+	StartedAt       time.Time
+	Duration        time.Duration
+	SegmentsRead    int
+	SegmentsWritten int
+	BytesReclaimed  int64
+	EntriesDropped  int
+}
+
+// MergeFailureEvent describes a merge which failed or was cancelled with Err, after merging the segments merged before the failure
+type MergeFailureEvent struct {
+	Kind      MergeKind
+	StartedAt time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// CorruptionEvent describes a segment, identified by FileId, which can not be read or decoded during start-up: for example, a tampered encrypted record,
+// a malformed entry, a key whose size differs from its FixedSizeKey type (refer to ErrInvalidKeySize), or a partial entry at the end of a segment other than the newest (refer to log.CorruptSegmentError). Such a partial entry is typically left
+// by a crash during a merge, so it is truncated and the start-up continues, whereas the other corruptions fail the start-up. A partial entry at the end
+// of the newest segment is left behind by a crash during an append, it is truncated silently and it is not a corruption.
+type CorruptionEvent struct {
+	FileId uint64
+	Err    error
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KeyProvider provides the keys to encrypt the segment files. Every key is identified by a key id, and new segment files are encrypted with the current key.
+// The key id of a segment file is recorded in its name, so the segment files encrypted with an older key remain readable after the current key is rotated,
+// as long as the KeyProvider can still provide the older key. The merge re-encrypts the older segment files with the current key.
+// A key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	CurrentKeyId() uint32
+	Key(keyId uint32) ([]byte, error)
+}
+
+// InMemoryKeyProvider is a KeyProvider that keeps all the keys in memory. It is safe for concurrent use
+type InMemoryKeyProvider struct {
+	lock         sync.RWMutex
+	currentKeyId uint32
+	keys         map[uint32][]byte
+}
+
+// NewInMemoryKeyProvider creates a new instance of InMemoryKeyProvider with the key identified by keyId as the current key
+func NewInMemoryKeyProvider(keyId uint32, key []byte) *InMemoryKeyProvider {
+	return &InMemoryKeyProvider{
+		currentKeyId: keyId,
+		keys:         map[uint32][]byte{keyId: key},
+	}
+}
+
+// CurrentKeyId returns the id of the key used to encrypt the new segment files
+func (provider *InMemoryKeyProvider) CurrentKeyId() uint32 {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+
+	return provider.currentKeyId
+}
+
+// Key returns the key identified by keyId, or an error if the key is unknown
+func (provider *InMemoryKeyProvider) Key(keyId uint32) ([]byte, error) {
+	provider.lock.RLock()
+	defer provider.lock.RUnlock()
+
+	key, ok := provider.keys[keyId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown encryption key id %v", keyId))
+	}
+	return key, nil
+}
+
+// Rotate adds the key identified by keyId and makes it the current key. The older keys are retained to read the older segment files
+func (provider *InMemoryKeyProvider) Rotate(keyId uint32, key []byte) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.keys[keyId] = key
+	provider.currentKeyId = keyId
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInMemoryKeyProviderReturnsTheCurrentKey(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	keyProvider := NewInMemoryKeyProvider(1, key)
+
+	if keyProvider.CurrentKeyId() != 1 {
+		t.Fatalf("Expected the current key id to be %v, received %v", 1, keyProvider.CurrentKeyId())
+	}
+	currentKey, _ := keyProvider.Key(1)
+	if !reflect.DeepEqual(key, currentKey) {
+		t.Fatalf("Expected the key to be %v, received %v", key, currentKey)
+	}
+}
+
+func TestInMemoryKeyProviderRetainsTheOlderKeysAfterRotation(t *testing.T) {
+	oldKey, newKey := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+	keyProvider := NewInMemoryKeyProvider(1, oldKey)
+	keyProvider.Rotate(2, newKey)
+
+	if keyProvider.CurrentKeyId() != 2 {
+		t.Fatalf("Expected the current key id to be %v, received %v", 2, keyProvider.CurrentKeyId())
+	}
+	key, _ := keyProvider.Key(1)
+	if !reflect.DeepEqual(oldKey, key) {
+		t.Fatalf("Expected the older key to be %v, received %v", oldKey, key)
+	}
+}
+
+func TestInMemoryKeyProviderWithAnUnknownKeyId(t *testing.T) {
+	keyProvider := NewInMemoryKeyProvider(1, []byte("0123456789abcdef"))
+
+	_, err := keyProvider.Key(2)
+	if err == nil {
+		t.Fatalf("Expected an error while getting an unknown key id but received none")
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// StringKey is a built-in key type for the string keys. It is serialized as the bytes of the string
+type StringKey string
+
+func (key StringKey) Serialize() []byte {
+	return []byte(key)
+}
+
+func (key StringKey) Deserialize(serialized []byte) StringKey {
+	return StringKey(serialized)
+}
+
+// BytesKey is a built-in key type for the byte slice keys. A byte slice is not comparable, so BytesKey holds the bytes as a string.
+// It is serialized as the bytes themselves
+type BytesKey string
+
+// NewBytesKey creates a BytesKey holding a copy of the bytes
+func NewBytesKey(bytes []byte) BytesKey {
+	return BytesKey(bytes)
+}
+
+// Bytes returns a copy of the bytes of the key
+func (key BytesKey) Bytes() []byte {
+	return []byte(key)
+}
+
+func (key BytesKey) Serialize() []byte {
+	return []byte(key)
+}
+
+func (key BytesKey) Deserialize(serialized []byte) BytesKey {
+	return BytesKey(serialized)
+}
+
+// Int64Key is a built-in key type for the int64 keys. It is serialized as 8 big-endian bytes with the sign bit flipped,
+// so the serialized keys sort in the same order as the keys. The reload and the merge reject a serialized key which does not have 8 bytes, refer to FixedSizeKey
+type Int64Key int64
+
+func (key Int64Key) SerializedSize() int {
+	return 8
+}
+
+func (key Int64Key) Serialize() []byte {
+	serialized := make([]byte, 8)
+	binary.BigEndian.PutUint64(serialized, uint64(key)^(1<<63))
+	return serialized
+}
+
+func (key Int64Key) Deserialize(serialized []byte) Int64Key {
+	return Int64Key(binary.BigEndian.Uint64(eightBytesOf(serialized)) ^ (1 << 63))
+}
+
+// Uint64Key is a built-in key type for the uint64 keys. It is serialized as 8 big-endian bytes, so the serialized keys sort in the same order as the keys.
+// The reload and the merge reject a serialized key which does not have 8 bytes, refer to FixedSizeKey
+type Uint64Key uint64
+
+func (key Uint64Key) SerializedSize() int {
+	return 8
+}
+
+func (key Uint64Key) Serialize() []byte {
+	serialized := make([]byte, 8)
+	binary.BigEndian.PutUint64(serialized, uint64(key))
+	return serialized
+}
+
+func (key Uint64Key) Deserialize(serialized []byte) Uint64Key {
+	return Uint64Key(binary.BigEndian.Uint64(eightBytesOf(serialized)))
+}
+
+// eightBytesOf copies the serialized bytes into 8 bytes, padding a shorter input with trailing zeros, so that Deserialize never panics.
+// A serialized key of another size never reaches Deserialize during the reload and the merge, refer to KeyDecoderOf
+func eightBytesOf(serialized []byte) []byte {
+	var padded [8]byte
+	copy(padded[:], serialized)
+	return padded[:]
+}
+
+// UUIDKey is a built-in key type for the UUID keys (RFC 4122). It is serialized as its 16 bytes,
+// and the reload and the merge reject a serialized key which does not have 16 bytes, refer to FixedSizeKey
+type UUIDKey [16]byte
+
+// NewRandomUUIDKey creates a random (version 4) UUIDKey
+func NewRandomUUIDKey() (UUIDKey, error) {
+	var key UUIDKey
+	if _, err := rand.Read(key[:]); err != nil {
+		return UUIDKey{}, err
+	}
+	key[6] = (key[6] & 0x0f) | 0x40
+	key[8] = (key[8] & 0x3f) | 0x80
+	return key, nil
+}
+
+// ParseUUIDKey parses a UUIDKey from its canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func ParseUUIDKey(uuid string) (UUIDKey, error) {
+	var key UUIDKey
+	if len(uuid) != 36 || uuid[8] != '-' || uuid[13] != '-' || uuid[18] != '-' || uuid[23] != '-' {
+		return UUIDKey{}, errors.New(fmt.Sprintf("Invalid UUID %v", uuid))
+	}
+	digits := uuid[0:8] + uuid[9:13] + uuid[14:18] + uuid[19:23] + uuid[24:36]
+	if _, err := hex.Decode(key[:], []byte(digits)); err != nil {
+		return UUIDKey{}, errors.New(fmt.Sprintf("Invalid UUID %v: %v", uuid, err))
+	}
+	return key, nil
+}
+
+// String returns the canonical form of the UUIDKey
+func (key UUIDKey) String() string {
+	encoded := hex.EncodeToString(key[:])
+	return encoded[0:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:32]
+}
+
+func (key UUIDKey) SerializedSize() int {
+	return len(key)
+}
+
+func (key UUIDKey) Serialize() []byte {
+	serialized := make([]byte, len(key))
+	copy(serialized, key[:])
+	return serialized
+}
+
+func (key UUIDKey) Deserialize(serialized []byte) UUIDKey {
+	var deserialized UUIDKey
+	copy(deserialized[:], serialized)
+	return deserialized
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestDeserializeAStringKey(t *testing.T) {
+	key := StringKey("topic")
+	if deserialized := key.Deserialize(key.Serialize()); deserialized != key {
+		t.Fatalf("Expected key to be %v, received %v", key, deserialized)
+	}
+}
+
+func TestDeserializeABytesKey(t *testing.T) {
+	key := NewBytesKey([]byte{0x00, 0xff, 0x10})
+	deserialized := key.Deserialize(key.Serialize())
+	if !bytes.Equal(deserialized.Bytes(), []byte{0x00, 0xff, 0x10}) {
+		t.Fatalf("Expected key to be %v, received %v", key.Bytes(), deserialized.Bytes())
+	}
+}
+
+func TestSerializedInt64KeysSortInTheOrderOfTheKeys(t *testing.T) {
+	keys := []Int64Key{-9000, -1, 0, 1, 42, 1 << 40}
+	serialized := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if deserialized := key.Deserialize(key.Serialize()); deserialized != key {
+			t.Fatalf("Expected key to be %v, received %v", key, deserialized)
+		}
+		serialized = append(serialized, key.Serialize())
+	}
+	if !sort.SliceIsSorted(serialized, func(i, j int) bool {
+		return bytes.Compare(serialized[i], serialized[j]) < 0
+	}) {
+		t.Fatalf("Expected the serialized keys to sort in the order of the keys")
+	}
+}
+
+func TestDeserializeAUint64Key(t *testing.T) {
+	key := Uint64Key(1<<63 + 7)
+	if deserialized := key.Deserialize(key.Serialize()); deserialized != key {
+		t.Fatalf("Expected key to be %v, received %v", key, deserialized)
+	}
+}
+
+func TestKeyDecoderRejectsASerializedKeyOfAnotherSize(t *testing.T) {
+	decodeUint64Key := KeyDecoderOf(DeserializerOf[Uint64Key]())
+	if _, err := decodeUint64Key([]byte{0x01}); !errors.Is(err, ErrInvalidKeySize) {
+		t.Fatalf("Expected ErrInvalidKeySize for a short Uint64Key, received %v", err)
+	}
+	if key, err := decodeUint64Key(Uint64Key(42).Serialize()); err != nil || key != 42 {
+		t.Fatalf("Expected key to be %v, received %v, %v", 42, key, err)
+	}
+	if _, err := KeyDecoderOf(DeserializerOf[Int64Key]())(nil); !errors.Is(err, ErrInvalidKeySize) {
+		t.Fatalf("Expected ErrInvalidKeySize for an empty Int64Key, received %v", err)
+	}
+	if _, err := KeyDecoderOf(DeserializerOf[UUIDKey]())(make([]byte, 17)); !errors.Is(err, ErrInvalidKeySize) {
+		t.Fatalf("Expected ErrInvalidKeySize for a long UUIDKey, received %v", err)
+	}
+	if key, err := KeyDecoderOf(DeserializerOf[StringKey]())([]byte("a")); err != nil || key != "a" {
+		t.Fatalf("Expected key to be %v, received %v, %v", "a", key, err)
+	}
+}
+
+func TestParseAndFormatAUUIDKey(t *testing.T) {
+	key, err := ParseUUIDKey("123e4567-e89b-12d3-a456-426614174000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.String() != "123e4567-e89b-12d3-a456-426614174000" {
+		t.Fatalf("Expected key to be %v, received %v", "123e4567-e89b-12d3-a456-426614174000", key.String())
+	}
+	if deserialized := key.Deserialize(key.Serialize()); deserialized != key {
+		t.Fatalf("Expected key to be %v, received %v", key, deserialized)
+	}
+	if _, err := ParseUUIDKey("123e4567e89b12d3a456426614174000"); err == nil {
+		t.Fatalf("Expected an error while parsing a UUID without hyphens")
+	}
+}
+
+func TestNewRandomUUIDKeyIsAVersion4UUID(t *testing.T) {
+	key, _ := NewRandomUUIDKey()
+	other, _ := NewRandomUUIDKey()
+	if key == other {
+		t.Fatalf("Expected 2 random keys to be different, received %v twice", key)
+	}
+	if key[6]>>4 != 4 || key[8]>>6 != 2 {
+		t.Fatalf("Expected a version 4 UUID, received %v", key)
+	}
+}
+
+func TestKeyMapperFallsBackToTheDeserializableKeyType(t *testing.T) {
+	mergeConfig := NewMergeConfig[Uint64Key](2, nil)
+	if key := mergeConfig.KeyMapper()(Uint64Key(42).Serialize()); key != 42 {
+		t.Fatalf("Expected key to be %v, received %v", 42, key)
+	}
+}
+
+func TestKeyMapperIsNilForAKeyTypeWhichIsNotDeserializable(t *testing.T) {
+	mergeConfig := NewMergeConfig[serializableKey](2, nil)
+	if mergeConfig.KeyMapper() != nil {
+		t.Fatalf("Expected a nil keyMapper")
+	}
+}
@@ -7,8 +7,12 @@ type MergeConfig[Key BitCaskKey] struct {
 	shouldReadAllSegments bool
 	keyMapper             func([]byte) Key
 	runMergeEvery         time.Duration
+	mergeWindows          []*MergeWindow
+	maxBytesPerSecond     uint64
 }
 
+// NewMergeConfig creates a MergeConfig which merges totalSegmentsToRead inactive segments every 5 minutes.
+// The keyMapper may be nil if the key type implements Deserializable, refer to KeyMapper
 func NewMergeConfig[Key BitCaskKey](totalSegmentsToRead int, keyMapper func([]byte) Key) *MergeConfig[Key] {
 	return &MergeConfig[Key]{
 		totalSegmentsToRead:   totalSegmentsToRead,
@@ -51,10 +55,48 @@ func (mergeConfig *MergeConfig[Key]) ShouldReadAllSegments() bool {
 	return mergeConfig.shouldReadAllSegments
 }
 
+// KeyMapper returns the keyMapper which decodes a serialized key during reload and merge. The keyMapper is optional if the key type implements Deserializable
+// (for example, the built-in key types in Keys.go): a nil keyMapper falls back to the Deserialize method of the key type. It returns nil if neither is available
 func (mergeConfig *MergeConfig[Key]) KeyMapper() func([]byte) Key {
-	return mergeConfig.keyMapper
+	if mergeConfig.keyMapper != nil {
+		return mergeConfig.keyMapper
+	}
+	return DeserializerOf[Key]()
 }
 
 func (mergeConfig *MergeConfig[Key]) RunMergeEvery() time.Duration {
 	return mergeConfig.runMergeEvery
 }
+
+func (mergeConfig *MergeConfig[Key]) MergeWindows() []*MergeWindow {
+	return mergeConfig.mergeWindows
+}
+
+func (mergeConfig *MergeConfig[Key]) MaxBytesPerSecond() uint64 {
+	return mergeConfig.maxBytesPerSecond
+}
+
+// WithMergeWindows restricts the scheduled merges to run only within one of the provided windows of local time, a scheduled merge is cancelled once the windows close
+func (mergeConfig *MergeConfig[Key]) WithMergeWindows(windows ...*MergeWindow) *MergeConfig[Key] {
+	mergeConfig.mergeWindows = windows
+	return mergeConfig
+}
+
+// WithMaxBytesPerSecond limits the bytes read and written by a merge per second. 0 means no limit
+func (mergeConfig *MergeConfig[Key]) WithMaxBytesPerSecond(maxBytesPerSecond uint64) *MergeConfig[Key] {
+	mergeConfig.maxBytesPerSecond = maxBytesPerSecond
+	return mergeConfig
+}
+
+// IsInMergeWindow returns true if a scheduled merge is allowed to run at `t`, which is always the case if no merge windows are configured
+func (mergeConfig *MergeConfig[Key]) IsInMergeWindow(t time.Time) bool {
+	if len(mergeConfig.mergeWindows) == 0 {
+		return true
+	}
+	for _, window := range mergeConfig.mergeWindows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
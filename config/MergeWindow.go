@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MergeWindow represents a daily window of local time, like 01:00-05:00, in which the scheduled merges are allowed to start.
+// A window whose end is before its start wraps around midnight, 22:00-02:00 includes 23:30 and 01:30.
+type MergeWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// NewMergeWindow creates a new instance of MergeWindow from the hour and minute of its start and end, both in local time.
+// It returns an error if the hours or the minutes are out of range, or if the start and the end are the same.
+func NewMergeWindow(startHour, startMinute, endHour, endMinute int) (*MergeWindow, error) {
+	start, err := timeOfDay(startHour, startMinute)
+	if err != nil {
+		return nil, err
+	}
+	end, err := timeOfDay(endHour, endMinute)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, errors.New(fmt.Sprintf("Merge window must have different start and end, received %02d:%02d", startHour, startMinute))
+	}
+	return &MergeWindow{start: start, end: end}, nil
+}
+
+// Contains returns true if the local time of day of `t` is within the window. The start of the window is inclusive and the end is exclusive.
+func (window *MergeWindow) Contains(t time.Time) bool {
+	hour, minute, second := t.Clock()
+	now := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+	if window.start < window.end {
+		return now >= window.start && now < window.end
+	}
+	return now >= window.start || now < window.end
+}
+
+func timeOfDay(hour, minute int) (time.Duration, error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, errors.New(fmt.Sprintf("Invalid time of day %02d:%02d", hour, minute))
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
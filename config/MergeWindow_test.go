@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2023, 5, 4, hour, minute, 0, 0, time.Local)
+}
+
+func TestMergeWindowContainsTime(t *testing.T) {
+	window, _ := NewMergeWindow(1, 0, 5, 0)
+
+	if !window.Contains(at(1, 0)) {
+		t.Fatalf("Expected window to contain %v", at(1, 0))
+	}
+	if !window.Contains(at(4, 59)) {
+		t.Fatalf("Expected window to contain %v", at(4, 59))
+	}
+	if window.Contains(at(5, 0)) {
+		t.Fatalf("Expected window to not contain %v", at(5, 0))
+	}
+	if window.Contains(at(0, 59)) {
+		t.Fatalf("Expected window to not contain %v", at(0, 59))
+	}
+}
+
+func TestMergeWindowWrappingAroundMidnight(t *testing.T) {
+	window, _ := NewMergeWindow(22, 0, 2, 0)
+
+	if !window.Contains(at(23, 30)) {
+		t.Fatalf("Expected window to contain %v", at(23, 30))
+	}
+	if !window.Contains(at(1, 30)) {
+		t.Fatalf("Expected window to contain %v", at(1, 30))
+	}
+	if window.Contains(at(12, 0)) {
+		t.Fatalf("Expected window to not contain %v", at(12, 0))
+	}
+}
+
+func TestInvalidMergeWindow(t *testing.T) {
+	_, err := NewMergeWindow(24, 0, 2, 0)
+	if err == nil {
+		t.Fatalf("Expected an error while creating a merge window with an invalid hour but received none")
+	}
+	_, err = NewMergeWindow(2, 0, 2, 0)
+	if err == nil {
+		t.Fatalf("Expected an error while creating a merge window with the same start and end but received none")
+	}
+}
+
+func TestMergeConfigWithoutMergeWindows(t *testing.T) {
+	mergeConfig := NewMergeConfig[serializableKey](2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	if !mergeConfig.IsInMergeWindow(at(12, 0)) {
+		t.Fatalf("Expected merge to be allowed at any time without merge windows")
+	}
+}
+
+func TestMergeConfigWithMergeWindows(t *testing.T) {
+	night, _ := NewMergeWindow(1, 0, 5, 0)
+	afternoon, _ := NewMergeWindow(14, 0, 15, 0)
+	mergeConfig := NewMergeConfig[serializableKey](2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}).WithMergeWindows(night, afternoon)
+
+	if !mergeConfig.IsInMergeWindow(at(14, 30)) {
+		t.Fatalf("Expected merge to be allowed at %v", at(14, 30))
+	}
+	if mergeConfig.IsInMergeWindow(at(12, 0)) {
+		t.Fatalf("Expected merge to not be allowed at %v", at(12, 0))
+	}
+}
+
+type serializableKey string
+
+func (key serializableKey) Serialize() []byte {
+	return []byte(key)
+}
@@ -0,0 +1,15 @@
+package config
+
+// ReloadProgress describes the progress of the reload of the inactive segments during start-up.
+// SegmentsReloaded and BytesReloaded count the segments which have been applied to the KeyDirectory, out of TotalSegments and TotalBytes.
+type ReloadProgress struct {
+	SegmentsReloaded int
+	TotalSegments    int
+	BytesReloaded    int64
+	TotalBytes       int64
+}
+
+// Done returns true if all the segments have been reloaded
+func (progress ReloadProgress) Done() bool {
+	return progress.SegmentsReloaded == progress.TotalSegments
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogEventListener is an EventListener which logs the events with a slog.Logger.
+// The merges are logged at the info level (the failures at the error level), the corruptions at the error level, the completion of the reload at the info level,
+// whereas the frequent events (the rollovers, the removals and the progress of the reload) are logged at the debug level.
+type SlogEventListener struct {
+	logger *slog.Logger
+}
+
+// NewSlogEventListener creates a new instance of SlogEventListener which logs with the logger, or with slog.Default() if the logger is nil
+func NewSlogEventListener(logger *slog.Logger) *SlogEventListener {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogEventListener{logger: logger}
+}
+
+func (listener *SlogEventListener) SegmentRolledOver(event SegmentRolloverEvent) {
+	listener.log(slog.LevelDebug, "bitcask segment rolled over",
+		slog.Uint64("fileId", event.FileId),
+		slog.Int64("sizeInBytes", event.SizeInBytes),
+		slog.Bool("blob", event.Blob),
+	)
+}
+
+func (listener *SlogEventListener) SegmentRemoved(event SegmentRemovalEvent) {
+	listener.log(slog.LevelDebug, "bitcask segment removed",
+		slog.Uint64("fileId", event.FileId),
+		slog.Bool("blob", event.Blob),
+		slog.String("reason", event.Reason.String()),
+	)
+}
+
+func (listener *SlogEventListener) MergeStarted(event MergeStartEvent) {
+	listener.log(slog.LevelInfo, "bitcask merge started",
+		slog.String("kind", event.Kind.String()),
+		slog.Any("fileIds", event.FileIds),
+	)
+}
+
+func (listener *SlogEventListener) MergeFinished(event MergeFinishEvent) {
+	listener.log(slog.LevelInfo, "bitcask merge finished",
+		slog.String("kind", event.Kind.String()),
+		slog.Duration("duration", event.Duration),
+		slog.Int("segmentsRead", event.SegmentsRead),
+		slog.Int("segmentsWritten", event.SegmentsWritten),
+		slog.Int64("bytesReclaimed", event.BytesReclaimed),
+		slog.Int("entriesDropped", event.EntriesDropped),
+	)
+}
+
+func (listener *SlogEventListener) MergeFailed(event MergeFailureEvent) {
+	listener.log(slog.LevelError, "bitcask merge failed",
+		slog.String("kind", event.Kind.String()),
+		slog.Duration("duration", event.Duration),
+		slog.Any("error", event.Err),
+	)
+}
+
+func (listener *SlogEventListener) ReloadProgressed(progress ReloadProgress) {
+	level, message := slog.LevelDebug, "bitcask reload progressed"
+	if progress.Done() {
+		level, message = slog.LevelInfo, "bitcask reload completed"
+	}
+	listener.log(level, message,
+		slog.Int("segmentsReloaded", progress.SegmentsReloaded),
+		slog.Int("totalSegments", progress.TotalSegments),
+		slog.Int64("bytesReloaded", progress.BytesReloaded),
+		slog.Int64("totalBytes", progress.TotalBytes),
+	)
+}
+
+func (listener *SlogEventListener) CorruptionDetected(event CorruptionEvent) {
+	listener.log(slog.LevelError, "bitcask corruption detected",
+		slog.Uint64("fileId", event.FileId),
+		slog.Any("error", event.Err),
+	)
+}
+
+// log logs the message with the attributes at the level, if the level is enabled
+func (listener *SlogEventListener) log(level slog.Level, message string, attributes ...slog.Attr) {
+	listener.logger.LogAttrs(context.Background(), level, message, attributes...)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlogEventListenerLogsTheEvents(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	listener := NewSlogEventListener(slog.New(slog.NewTextHandler(buffer, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	listener.SegmentRolledOver(SegmentRolloverEvent{FileId: 10, SizeInBytes: 128})
+	listener.SegmentRemoved(SegmentRemovalEvent{FileId: 10, Reason: SegmentMerged})
+	listener.MergeStarted(MergeStartEvent{Kind: SegmentsMerge, FileIds: []uint64{10, 11}})
+	listener.MergeFinished(MergeFinishEvent{Kind: SegmentsMerge, Duration: time.Second, SegmentsRead: 2, SegmentsWritten: 1})
+	listener.MergeFailed(MergeFailureEvent{Kind: BlobSegmentsMerge, Err: errors.New("disk full")})
+	listener.ReloadProgressed(ReloadProgress{SegmentsReloaded: 2, TotalSegments: 2})
+	listener.CorruptionDetected(CorruptionEvent{FileId: 12, Err: errors.New("truncated record")})
+
+	logged := buffer.String()
+	for _, expected := range []string{
+		`level=DEBUG msg="bitcask segment rolled over" fileId=10 sizeInBytes=128 blob=false`,
+		`level=DEBUG msg="bitcask segment removed" fileId=10 blob=false reason=merged`,
+		`level=INFO msg="bitcask merge started" kind=segments fileIds="[10 11]"`,
+		`level=INFO msg="bitcask merge finished" kind=segments duration=1s segmentsRead=2 segmentsWritten=1`,
+		`level=ERROR msg="bitcask merge failed" kind="blob segments" duration=0s error="disk full"`,
+		`level=INFO msg="bitcask reload completed" segmentsReloaded=2 totalSegments=2`,
+		`level=ERROR msg="bitcask corruption detected" fileId=12 error="truncated record"`,
+	} {
+		if !strings.Contains(logged, expected) {
+			t.Fatalf("Expected the log to contain %v, received\n%v", expected, logged)
+		}
+	}
+}
+
+func TestSlogEventListenerSkipsTheDebugEventsAtTheInfoLevel(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	listener := NewSlogEventListener(slog.New(slog.NewTextHandler(buffer, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	listener.SegmentRolledOver(SegmentRolloverEvent{FileId: 10, SizeInBytes: 128})
+	listener.ReloadProgressed(ReloadProgress{SegmentsReloaded: 1, TotalSegments: 2})
+
+	if buffer.Len() != 0 {
+		t.Fatalf("Expected the debug events to be skipped, received\n%v", buffer.String())
+	}
+}
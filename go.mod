@@ -1,3 +1,3 @@
 module bitcask
 
-go 1.20
+go 1.21
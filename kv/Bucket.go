@@ -0,0 +1,56 @@
+package kv
+
+import (
+	"bitcask/config"
+)
+
+// Bucket is a namespace of keys within a KVStore. The same key can be put in different buckets, and the buckets do not see each other's keys.
+// The entries of all the buckets share the segments, the key of an entry is prefixed by the id of its bucket (refer to log.Entry.inBucket),
+// whereas every bucket has its own KeyDirectory.
+// A Bucket is obtained using KVStore.CreateBucket or KVStore.Bucket, and all its operations return ErrBucketNotFound once the bucket is dropped,
+// even if a bucket with the same name is created again.
+type Bucket[Key config.BitCaskKey] struct {
+	kvStore *KVStore[Key]
+	name    string
+	id      uint32
+}
+
+// Name returns the name of the bucket
+func (bucket *Bucket[Key]) Name() string {
+	return bucket.name
+}
+
+// Put puts the key and the value in the bucket, refer to KVStore.Put
+func (bucket *Bucket[Key]) Put(key Key, value []byte) error {
+	return bucket.kvStore.putInBucket(bucket.id, key, value)
+}
+
+// Update updates the value of the key in the bucket, refer to KVStore.Update
+func (bucket *Bucket[Key]) Update(key Key, value []byte) error {
+	return bucket.Put(key, value)
+}
+
+// Delete deletes the key in the bucket, refer to KVStore.Delete
+func (bucket *Bucket[Key]) Delete(key Key) error {
+	return bucket.kvStore.deleteInBucket(bucket.id, key)
+}
+
+// Get gets the value corresponding to the key in the bucket, refer to KVStore.Get
+func (bucket *Bucket[Key]) Get(key Key) ([]byte, error) {
+	return bucket.kvStore.getInBucket(bucket.id, key)
+}
+
+// Keys returns a snapshot of all the keys in the bucket, in no particular order
+func (bucket *Bucket[Key]) Keys() ([]Key, error) {
+	return bucket.kvStore.keysInBucket(bucket.id)
+}
+
+// Iterate invokes fn with every key in the bucket and its value, refer to KVStore.Iterate
+func (bucket *Bucket[Key]) Iterate(fn func(key Key, value []byte) error) error {
+	return bucket.kvStore.iterateBucket(bucket.id, fn)
+}
+
+// Stats returns the BucketStats of the bucket
+func (bucket *Bucket[Key]) Stats() (*BucketStats, error) {
+	return bucket.kvStore.bucketStats(bucket.id)
+}
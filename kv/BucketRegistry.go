@@ -0,0 +1,141 @@
+package kv
+
+import (
+	appendOnlyLog "bitcask/kv/log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+)
+
+// bucketRegistryFileName is the name of the file which persists the bucketRegistry in the directory of bitcask
+const bucketRegistryFileName = "bitcask.buckets"
+
+// ErrBucketExists is returned by CreateBucket if a bucket with the same name already exists
+var ErrBucketExists = errors.New("bucket already exists")
+
+// ErrBucketNotFound is returned by the operations on a bucket which does not exist, or which has been dropped
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// bucketRegistry maps the name of every bucket to its id, which is the bucket that the log entries are encoded with, refer to log.Entry.inBucket.
+// The ids start at 1 (0 is the log.DefaultBucket) and are never reused: the entries of a dropped bucket remain in the segments until they are merged,
+// and a bucket created later with the same name must not see them.
+// The registry is persisted as JSON in the directory of bitcask, every change is written to a temporary file which is synced and renamed over the registry file.
+type bucketRegistry struct {
+	filePath string
+	NextId   uint32            `json:"nextId"`
+	Buckets  map[string]uint32 `json:"buckets"`
+}
+
+// loadBucketRegistry loads the bucketRegistry from the directory, or returns an empty bucketRegistry if no bucket has ever been created
+func loadBucketRegistry(directory string) (*bucketRegistry, error) {
+	registry := &bucketRegistry{
+		filePath: path.Join(directory, bucketRegistryFileName),
+		NextId:   appendOnlyLog.DefaultBucket + 1,
+		Buckets:  make(map[string]uint32),
+	}
+	content, err := os.ReadFile(registry.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, registry); err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not decode the bucket registry %v, %v", registry.filePath, err))
+	}
+	if registry.Buckets == nil {
+		registry.Buckets = make(map[string]uint32)
+	}
+	return registry, nil
+}
+
+// create registers a new bucket with the next id, and persists the registry. It returns ErrBucketExists if the bucket already exists
+func (registry *bucketRegistry) create(name string) (uint32, error) {
+	if name == "" {
+		return 0, errors.New("the name of a bucket can not be empty")
+	}
+	if _, ok := registry.Buckets[name]; ok {
+		return 0, ErrBucketExists
+	}
+	id := registry.NextId
+	registry.Buckets[name] = id
+	registry.NextId = registry.NextId + 1
+	if err := registry.persist(); err != nil {
+		delete(registry.Buckets, name)
+		registry.NextId = id
+		return 0, err
+	}
+	return id, nil
+}
+
+// drop unregisters the bucket, and persists the registry. It returns the id of the dropped bucket, or ErrBucketNotFound if the bucket does not exist
+func (registry *bucketRegistry) drop(name string) (uint32, error) {
+	id, ok := registry.Buckets[name]
+	if !ok {
+		return 0, ErrBucketNotFound
+	}
+	delete(registry.Buckets, name)
+	if err := registry.persist(); err != nil {
+		registry.Buckets[name] = id
+		return 0, err
+	}
+	return id, nil
+}
+
+// idOf returns the id of the bucket, and false if the bucket does not exist
+func (registry *bucketRegistry) idOf(name string) (uint32, bool) {
+	id, ok := registry.Buckets[name]
+	return id, ok
+}
+
+// ids returns the ids of all the buckets, in no particular order
+func (registry *bucketRegistry) ids() []uint32 {
+	ids := make([]uint32, 0, len(registry.Buckets))
+	for _, id := range registry.Buckets {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// names returns the names of all the buckets, in the increasing order
+func (registry *bucketRegistry) names() []string {
+	names := make([]string, 0, len(registry.Buckets))
+	for name := range registry.Buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// persist writes the registry to a temporary file, syncs it and renames it over the registry file, so that the registry file is never partially written
+func (registry *bucketRegistry) persist() error {
+	content, err := json.Marshal(registry)
+	if err != nil {
+		return err
+	}
+	temporaryFilePath := registry.filePath + ".tmp"
+	file, err := os.OpenFile(temporaryFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFilePath, registry.filePath)
+}
+
+// remove removes the registry file
+func (registry *bucketRegistry) remove() {
+	_ = os.Remove(registry.filePath)
+}
@@ -0,0 +1,9 @@
+package kv
+
+// BucketStats describes the keys of a bucket. Keys is the number of keys in the bucket, LiveBytes is the sum of the entry lengths of its keys in the segment files
+// and LiveBlobBytes is the sum of the blob entry lengths of its keys in the blob segment files. The garbage of a bucket is not tracked, it is reclaimed by the merge.
+type BucketStats struct {
+	Keys          int
+	LiveBytes     int64
+	LiveBlobBytes int64
+}
@@ -0,0 +1,232 @@
+package kv
+
+import (
+	bitCaskConfig "bitcask/config"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBucketsIsolateTheirKeys(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	users, _ := kv.CreateBucket("users")
+	orders, _ := kv.CreateBucket("orders")
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = users.Put("topic", []byte("bitcask"))
+	_ = orders.Put("topic", []byte("storage"))
+	_ = orders.Delete("topic")
+
+	value, _ := kv.Get("topic")
+	if !reflect.DeepEqual([]byte("microservices"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+	value, _ = users.Get("topic")
+	if !reflect.DeepEqual([]byte("bitcask"), value) {
+		t.Fatalf("Expected value in the bucket to be %v, received %v", "bitcask", string(value))
+	}
+	if _, err := orders.Get("topic"); err == nil {
+		t.Fatalf("Expected %v to have been deleted from the bucket but was found", "topic")
+	}
+	keys, _ := users.Keys()
+	if !reflect.DeepEqual([]serializableKey{"topic"}, keys) {
+		t.Fatalf("Expected the keys of the bucket to be %v, received %v", []serializableKey{"topic"}, keys)
+	}
+	if !reflect.DeepEqual([]string{"orders", "users"}, kv.BucketNames()) {
+		t.Fatalf("Expected the buckets to be %v, received %v", []string{"orders", "users"}, kv.BucketNames())
+	}
+}
+
+func TestCreateAnExistingBucket(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_, _ = kv.CreateBucket("users")
+	if _, err := kv.CreateBucket("users"); !errors.Is(err, ErrBucketExists) {
+		t.Fatalf("Expected ErrBucketExists, received %v", err)
+	}
+	if _, err := kv.Bucket("orders"); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("Expected ErrBucketNotFound, received %v", err)
+	}
+}
+
+func TestBucketsSurviveReload(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	users, _ := kv.CreateBucket("users")
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = users.Put("topic", []byte("bitcask"))
+	_ = users.Put("disk", []byte("ssd"))
+	_ = users.Delete("disk")
+
+	kv.Sync()
+	kv.Shutdown()
+
+	kv, _ = NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	users, err := kv.Bucket("users")
+	if err != nil {
+		t.Fatalf("Expected the bucket to survive the reload, received %v", err)
+	}
+	value, _ := users.Get("topic")
+	if !reflect.DeepEqual([]byte("bitcask"), value) {
+		t.Fatalf("Expected value in the bucket to be %v, received %v", "bitcask", string(value))
+	}
+	if _, err := users.Get("disk"); err == nil {
+		t.Fatalf("Expected %v to have been deleted from the bucket but was found", "disk")
+	}
+	value, _ = kv.Get("topic")
+	if !reflect.DeepEqual([]byte("microservices"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+}
+
+func TestDropABucket(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	users, _ := kv.CreateBucket("users")
+	_ = users.Put("topic", []byte("bitcask"))
+
+	_ = kv.DropBucket("users")
+	if err := users.Put("disk", []byte("ssd")); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("Expected ErrBucketNotFound for a dropped bucket, received %v", err)
+	}
+	if err := kv.DropBucket("users"); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("Expected ErrBucketNotFound for a dropped bucket, received %v", err)
+	}
+
+	users, _ = kv.CreateBucket("users")
+	if _, err := users.Get("topic"); err == nil {
+		t.Fatalf("Expected a bucket created after a drop to not see the keys of the dropped bucket")
+	}
+
+	kv.Sync()
+	kv.Shutdown()
+
+	kv, _ = NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	users, _ = kv.Bucket("users")
+	if _, err := users.Get("topic"); err == nil {
+		t.Fatalf("Expected the keys of the dropped bucket to be skipped on reload")
+	}
+}
+
+func TestMergeSegmentsReclaimsTheEntriesOfADroppedBucket(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	users, _ := kv.CreateBucket("users")
+	orders, _ := kv.CreateBucket("orders")
+	_ = users.Put("topic", []byte("bitcask"))
+	_ = users.Delete("topic")
+	_ = users.Put("disk", []byte("ssd"))
+	_ = orders.Put("topic", []byte("storage"))
+	_ = kv.Put("engine", []byte("bitcask"))
+	_ = kv.DropBucket("users")
+
+	fileIds := kv.segments.InactiveSegmentIds()
+	response, _ := kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+	if response.EntriesDropped != 3 {
+		t.Fatalf("Expected %v entries to be dropped, received %v", 3, response.EntriesDropped)
+	}
+
+	value, _ := orders.Get("topic")
+	if !reflect.DeepEqual([]byte("storage"), value) {
+		t.Fatalf("Expected value in the bucket to be %v, received %v", "storage", string(value))
+	}
+	_, contents, _ := kv.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	for _, entries := range contents {
+		for _, entry := range entries {
+			if entry.Bucket == users.id {
+				t.Fatalf("Expected the entries of the dropped bucket to be reclaimed, found %v", entry.Key)
+			}
+		}
+	}
+}
+
+func TestMergeBlobSegmentsRetainsTheBucketOfTheBlobEntries(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithBlobValueThreshold(8)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	users, _ := kv.CreateBucket("users")
+	_ = users.Put("topic", []byte("distributed systems"))
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("topic", []byte("bitcask storage"))
+
+	var fileIds []uint64
+	for _, stats := range kv.InactiveBlobSegmentStats() {
+		fileIds = append(fileIds, stats.FileId)
+	}
+	_, _ = kv.MergeBlobSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+
+	kv.Sync()
+	kv.Shutdown()
+	kv, _ = NewKVStore[serializableKey](config)
+
+	users, _ = kv.Bucket("users")
+	value, _ := users.Get("topic")
+	if !reflect.DeepEqual([]byte("distributed systems"), value) {
+		t.Fatalf("Expected value in the bucket to be %v, received %v", "distributed systems", string(value))
+	}
+	value, _ = kv.Get("topic")
+	if !reflect.DeepEqual([]byte("bitcask storage"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask storage", string(value))
+	}
+}
+
+func TestBucketStats(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	users, _ := kv.CreateBucket("users")
+	_ = kv.Put("engine", []byte("bitcask"))
+	_ = users.Put("topic", []byte("microservices"))
+	_ = users.Put("disk", []byte("ssd"))
+	_ = users.Delete("disk")
+
+	stats, _ := users.Stats()
+	if stats.Keys != 1 {
+		t.Fatalf("Expected the bucket to have %v key, received %v", 1, stats.Keys)
+	}
+	entry, _ := kv.bucketDirectories[users.id].Get("topic")
+	if stats.LiveBytes != int64(entry.EntryLength) || stats.LiveBlobBytes != 0 {
+		t.Fatalf("Expected the live bytes of the bucket to be %v and %v, received %v and %v", entry.EntryLength, 0, stats.LiveBytes, stats.LiveBlobBytes)
+	}
+
+	_ = kv.DropBucket("users")
+	if _, err := users.Stats(); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("Expected ErrBucketNotFound for a dropped bucket, received %v", err)
+	}
+}
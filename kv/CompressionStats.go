@@ -0,0 +1,17 @@
+package kv
+
+// CompressionStats describes the compression of the values put since the KVStore was created.
+// RawBytes is the total size of the values as provided by the user and CompressedBytes is the total size of the values as written to the segment files.
+// A value that does not shrink on compression is written uncompressed, so CompressedBytes never exceeds RawBytes.
+type CompressionStats struct {
+	RawBytes        int64
+	CompressedBytes int64
+}
+
+// Ratio returns RawBytes / CompressedBytes, 1 if no value has been put
+func (stats *CompressionStats) Ratio() float64 {
+	if stats.CompressedBytes == 0 {
+		return 1
+	}
+	return float64(stats.RawBytes) / float64(stats.CompressedBytes)
+}
@@ -6,15 +6,23 @@ import (
 
 // Entry (pointer to the Entry) is used as a value in the KeyDirectory
 // It identifies the file containing the key, the offset of the key-value in the file and the entry length.
+// Blob is the reference to the value in a blob segment file if the value was separated from the key, else nil. Refer to BlobSegments.go inside log/ package.
 // Refer to Entry.go inside log/ package to understand encoding and decoding.
 type Entry struct {
 	FileId      uint64
 	Offset      int64
 	EntryLength uint32
+	Blob        *log.BlobReference
 }
 
 func NewEntryFrom(response *log.AppendEntryResponse) *Entry {
-	return NewEntry(response.FileId, response.Offset, response.EntryLength)
+	return NewEntryWithBlob(response.FileId, response.Offset, response.EntryLength, response.Blob)
+}
+
+func NewEntryWithBlob(fileId uint64, offset int64, entryLength uint32, blob *log.BlobReference) *Entry {
+	entry := NewEntry(fileId, offset, entryLength)
+	entry.Blob = blob
+	return entry
 }
 
 func NewEntry(fileId uint64, offset int64, entryLength uint32) *Entry {
@@ -24,3 +32,11 @@ func NewEntry(fileId uint64, offset int64, entryLength uint32) *Entry {
 		EntryLength: entryLength,
 	}
 }
+
+// sizeInBytes returns the length of the entry, including the length of its blob entry if the value was separated from the key
+func (entry *Entry) sizeInBytes() int64 {
+	if entry.Blob != nil {
+		return int64(entry.EntryLength) + int64(entry.Blob.EntryLength)
+	}
+	return int64(entry.EntryLength)
+}
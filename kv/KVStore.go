@@ -3,34 +3,168 @@ package kv
 import (
 	"bitcask/config"
 	appendOnlyLog "bitcask/kv/log"
+	"bitcask/metrics"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"sort"
 	"sync"
+	"time"
 )
 
+// ErrShutdown is returned by the merge of KVStore (and by PutReader) once KVStore is shut down, refer to KVStore.Shutdown
+var ErrShutdown = errors.New("key value store is shut down")
+
 // KVStore encapsulates append-only log segments and KeyDirectory which is an in-memory hashmap
 // Segments is an abstraction that manages the active and K inactive segments.
 // KVStore also maintains a RWLock that allows an exclusive writer and N readers
+// The values of the memory-mapped segments are copied before the read lock is released, because a merge unmaps the segments it removes
+// Every bucket has its own KeyDirectory, keyDirectory is the KeyDirectory of the log.DefaultBucket. Refer to Bucket
+// KVStore records the latencies, the bytes and the lock waits of the operations in the metrics, if config.Config.WithMetrics is set. Refer to metrics.Metrics
+// KVStore notifies the config.EventListener of the reload progress and of the corruptions, and passes it to Segments for the rollovers and the removals.
 type KVStore[Key config.BitCaskKey] struct {
-	segments     *appendOnlyLog.Segments[Key]
-	keyDirectory *KeyDirectory[Key]
-	lock         sync.RWMutex
+	segments          *appendOnlyLog.Segments[Key]
+	keyDirectory      *KeyDirectory[Key]
+	bucketDirectories map[uint32]*KeyDirectory[Key]
+	buckets           *bucketRegistry
+	lock              sync.RWMutex
+	memoryMappedReads bool
+	readBuffers       sync.Pool
+	multiGetWorkers   int
+	operations        operationCounters
+	metrics           *metrics.Metrics
+	eventListener     config.EventListener
+	closed            bool
+}
+
+// MultiGetResult is the result of MultiGet for a key: the value if the key exists, else the error
+type MultiGetResult struct {
+	Value []byte
+	Err   error
+}
+
+// KeyValuePair is a key and its value, used by MultiPut
+type KeyValuePair[Key config.BitCaskKey] struct {
+	Key   Key
+	Value []byte
+}
+
+// reloadedSegment is the outcome of decoding an inactive segment during reload
+type reloadedSegment[Key config.BitCaskKey] struct {
+	entries []*appendOnlyLog.MappedStoredEntry[Key]
+	err     error
+}
+
+// multiGetRead is the Entry of a key of MultiGet, index identifies the key (and its MultiGetResult)
+type multiGetRead struct {
+	index int
+	entry *Entry
+}
+
+// MergeSegmentsResponse describes the outcome of MergeSegments.
+// SegmentsRead is the number of merged (and removed) segments, BytesRead is the number of bytes read from the segments (counted per chunk, like BytesWritten,
+// so that a merge cancelled in the middle of a segment reads and writes the same entries), SegmentsWritten and BytesWritten describe the new inactive segments,
+// and EntriesDropped is the number of older values and deleted entries that were not written back.
+type MergeSegmentsResponse struct {
+	SegmentsRead    int
+	SegmentsWritten int
+	BytesRead       int64
+	BytesWritten    int64
+	EntriesDropped  int
+}
+
+// Add adds the counts of another MergeSegmentsResponse to the response
+func (response *MergeSegmentsResponse) Add(other *MergeSegmentsResponse) {
+	response.SegmentsRead = response.SegmentsRead + other.SegmentsRead
+	response.SegmentsWritten = response.SegmentsWritten + other.SegmentsWritten
+	response.BytesRead = response.BytesRead + other.BytesRead
+	response.BytesWritten = response.BytesWritten + other.BytesWritten
+	response.EntriesDropped = response.EntriesDropped + other.EntriesDropped
 }
 
-// NewKVStore creates a new instance of KVStore
+// pendingBlobWriteBack is a blob entry that has been written back to a new inactive blob segment, but is yet to be referred to by the segments and the KeyDirectory.
+// previousFileId and previousOffset identify the position of the blob entry in the blob segment being merged.
+type pendingBlobWriteBack[Key config.BitCaskKey] struct {
+	bucket         uint32
+	key            Key
+	reference      *appendOnlyLog.BlobReference
+	timestamp      uint32
+	previousFileId uint64
+	previousOffset int64
+}
+
+// pendingWriteBack is an entry that has been written back to a new inactive segment, but is yet to be updated in the KeyDirectory.
+// previous is the Entry of the key in the KeyDirectory observed before the entry was written back, nil if the key was absent.
+type pendingWriteBack[Key config.BitCaskKey] struct {
+	bucket   uint32
+	response *appendOnlyLog.WriteBackResponse[Key]
+	previous *Entry
+}
+
+// MergeThrottle controls the pace of MergeSegments. Acquire is invoked, without holding the lock of KVStore, after every chunk of a segment is merged
+// with the number of bytes read and written for the chunk. It may block to limit the rate of merge I/O or to pause the merge, and returns an error to abort the merge.
+type MergeThrottle interface {
+	Acquire(ctx context.Context, bytes int64) error
+}
+
+// mergeChunkSizeBytes is the number of bytes read and written by a merge between two acquisitions of the MergeThrottle
+const mergeChunkSizeBytes = int64(64 * 1024)
+
+// maxPooledReadBufferBytes is the capacity beyond which a read buffer of GetInto and View is not returned to the pool
+const maxPooledReadBufferBytes = 1024 * 1024
+
+// NewKVStore creates a new instance of KVStore. It returns an error if the keys can not be decoded, refer to config.MergeConfig.KeyMapper
 // It also performs a reload operation `store.reload(config)` that is responsible for reloading the state of KeyDirectory from inactive segments
 func NewKVStore[Key config.BitCaskKey](config *config.Config[Key]) (*KVStore[Key], error) {
-	segments, err := appendOnlyLog.NewSegments[Key](config.Directory(), config.MaxSegmentSizeInBytes(), config.Clock())
+	if config.MergeConfig().KeyMapper() == nil {
+		return nil, errors.New("MergeConfig requires a keyMapper for a key type which does not implement config.Deserializable")
+	}
+	segments, err := appendOnlyLog.NewSegmentsWithOptions[Key](
+		config.Directory(),
+		config.MaxSegmentSizeInBytes(),
+		config.Clock(),
+		appendOnlyLog.SegmentsOptions{
+			BlobValueThresholdBytes: config.BlobValueThresholdInBytes(),
+			Compressor:              config.Compressor(),
+			KeyProvider:             config.KeyProvider(),
+			ValueCacheBytes:         config.ValueCacheSizeInBytes(),
+			MemoryMappedReads:       config.MemoryMappedReads(),
+			MaxKeySizeBytes:         config.MaxKeySizeInBytes(),
+			MaxValueSizeBytes:       config.MaxValueSizeInBytes(),
+			PreallocateSegments:     config.SegmentPreallocation(),
+			MaxSegmentAge:           config.MaxSegmentAge(),
+			Metrics:                 config.Metrics(),
+			EventListener:           config.EventListener(),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := loadBucketRegistry(config.Directory())
 	if err != nil {
 		return nil, err
 	}
 	store := &KVStore[Key]{
-		segments:     segments,
-		keyDirectory: NewKeyDirectory[Key](config.KeyDirectoryCapacity()),
+		segments:          segments,
+		keyDirectory:      NewKeyDirectory[Key](config.KeyDirectoryCapacity()),
+		bucketDirectories: make(map[uint32]*KeyDirectory[Key]),
+		buckets:           buckets,
+		memoryMappedReads: config.MemoryMappedReads(),
+		multiGetWorkers:   config.MultiGetParallelism(),
+		metrics:           config.Metrics(),
+		eventListener:     config.EventListener(),
+	}
+	store.bucketDirectories[appendOnlyLog.DefaultBucket] = store.keyDirectory
+	for _, bucket := range buckets.ids() {
+		store.bucketDirectories[bucket] = NewKeyDirectory[Key](0)
 	}
+	reloadStartTime := time.Now()
 	if err := store.reload(config); err != nil {
 		return nil, err
 	}
+	store.metrics.ObserveReload(time.Since(reloadStartTime))
 	return store, nil
 }
 
@@ -39,14 +173,77 @@ func NewKVStore[Key config.BitCaskKey](config *config.Config[Key]) (*KVStore[Key
 // - Segments abstraction will append the key and the value to the active segment if the size of the active segment is less than the threshold, else it will perform a rollover of the active segment
 // 2.Once the append operation is successful, it will write the key and the Entry to the KeyDirectory, which is an in-memory representation of the key and its position in an append-only segment
 func (kv *KVStore[Key]) Put(key Key, value []byte) error {
-	kv.lock.Lock()
+	return kv.putInBucket(appendOnlyLog.DefaultBucket, key, value)
+}
+
+// putInBucket puts the key and the value in the bucket, refer to Put. It returns ErrBucketNotFound if the bucket does not exist
+func (kv *KVStore[Key]) putInBucket(bucket uint32, key Key, value []byte) error {
+	startTime := time.Now()
+	kv.lockExclusively()
+	defer kv.lock.Unlock()
+
+	keyDirectory, ok := kv.bucketDirectories[bucket]
+	if !ok {
+		return ErrBucketNotFound
+	}
+	appendEntryResponse, err := kv.segments.AppendInBucket(bucket, key, value)
+	if err != nil {
+		return err
+	}
+	entry := NewEntryFrom(appendEntryResponse)
+	keyDirectory.Put(key, entry)
+	kv.operations.puts.Add(1)
+	kv.metrics.ObservePut(time.Since(startTime), entry.sizeInBytes())
+	return nil
+}
+
+// PutReader puts the key and a value of size bytes which is copied from the reader to the append-only log, without holding the value in memory.
+// The value is streamed to a staging file without holding the lock of KVStore, so a slow reader never blocks the other operations, and the exclusive lock
+// is held only to append the staged value (or the BlobReference to it) and to update the KeyDirectory. Refer to log.Segments.Stage and log.Segments.AppendStaged.
+// A value can not be streamed if encryption is enabled, PutReader then returns log.ErrEncryptedStream
+func (kv *KVStore[Key]) PutReader(key Key, reader io.Reader, size int64) error {
+	startTime := time.Now()
+	staged, err := kv.segments.Stage(key, reader, size)
+	if err != nil {
+		return err
+	}
+
+	kv.lockExclusively()
 	defer kv.lock.Unlock()
 
-	appendEntryResponse, err := kv.segments.Append(key, value)
+	if kv.closed {
+		staged.Discard()
+		return ErrShutdown
+	}
+	appendEntryResponse, err := kv.segments.AppendStaged(staged)
 	if err != nil {
 		return err
 	}
-	kv.keyDirectory.Put(key, NewEntryFrom(appendEntryResponse))
+	entry := NewEntryFrom(appendEntryResponse)
+	kv.keyDirectory.Put(key, entry)
+	kv.operations.puts.Add(1)
+	kv.metrics.ObservePut(time.Since(startTime), entry.sizeInBytes())
+	return nil
+}
+
+// MultiPut puts all the key value pairs with a single acquisition of the exclusive lock. The pairs are appended in order.
+// MultiPut is not atomic: if an append fails, MultiPut returns the error and the pairs appended before the failure remain in bitcask.
+// The latency of every pair is recorded in the metrics as a put, excluding the wait for the lock.
+func (kv *KVStore[Key]) MultiPut(pairs []KeyValuePair[Key]) error {
+	kv.lockExclusively()
+	defer kv.lock.Unlock()
+
+	for _, pair := range pairs {
+		startTime := time.Now()
+		appendEntryResponse, err := kv.segments.Append(pair.Key, pair.Value)
+		if err != nil {
+			return err
+		}
+		entry := NewEntryFrom(appendEntryResponse)
+		kv.keyDirectory.Put(pair.Key, entry)
+		kv.operations.puts.Add(1)
+		kv.metrics.ObservePut(time.Since(startTime), entry.sizeInBytes())
+	}
 	return nil
 }
 
@@ -57,13 +254,26 @@ func (kv *KVStore[Key]) Update(key Key, value []byte) error {
 
 // Delete appends the key and the value to the log and performs an in-place delete in the KeyDirectory
 func (kv *KVStore[Key]) Delete(key Key) error {
-	kv.lock.Lock()
+	return kv.deleteInBucket(appendOnlyLog.DefaultBucket, key)
+}
+
+// deleteInBucket deletes the key in the bucket, refer to Delete. It returns ErrBucketNotFound if the bucket does not exist
+func (kv *KVStore[Key]) deleteInBucket(bucket uint32, key Key) error {
+	startTime := time.Now()
+	kv.lockExclusively()
 	defer kv.lock.Unlock()
 
-	if _, err := kv.segments.AppendDeleted(key); err != nil {
+	keyDirectory, ok := kv.bucketDirectories[bucket]
+	if !ok {
+		return ErrBucketNotFound
+	}
+	appendEntryResponse, err := kv.segments.AppendDeletedInBucket(bucket, key)
+	if err != nil {
 		return err
 	}
-	kv.keyDirectory.Delete(key)
+	keyDirectory.Delete(key)
+	kv.operations.deletes.Add(1)
+	kv.metrics.ObserveDelete(time.Since(startTime), int64(appendEntryResponse.EntryLength))
 	return nil
 }
 
@@ -71,17 +281,22 @@ func (kv *KVStore[Key]) Delete(key Key) error {
 // In order to perform SilentGet, a Get operation is performed in the KeyDirectory which returns an Entry indicating the fileId containing the key, offset of the key and the entry length
 // If an Entry corresponding to the key is found, a Read operation is performed in the Segments abstraction, which performs an in-memory lookup to identify the segment based on the fileId, and then a Read operation is performed in that Segment
 func (kv *KVStore[Key]) SilentGet(key Key) ([]byte, bool) {
-	kv.lock.RLock()
+	startTime := time.Now()
+	kv.lockShared()
 	defer kv.lock.RUnlock()
 
+	kv.operations.gets.Add(1)
 	entry, ok := kv.keyDirectory.Get(key)
 	if ok {
 		storedEntry, err := kv.segments.Read(entry.FileId, entry.Offset, entry.EntryLength)
 		if err != nil {
 			return nil, false
 		}
-		return storedEntry.Value, true
+		value := kv.valueOf(storedEntry)
+		kv.metrics.ObserveGet(time.Since(startTime), entry.sizeInBytes())
+		return value, true
 	}
+	kv.metrics.ObserveGet(time.Since(startTime), 0)
 	return nil, false
 }
 
@@ -89,20 +304,280 @@ func (kv *KVStore[Key]) SilentGet(key Key) ([]byte, bool) {
 // In order to perform Get, a Get operation is performed in the KeyDirectory which returns an Entry indicating the fileId, offset of the key and the entry length
 // If an Entry corresponding to the key is found, a Read operation is performed in the Segments abstraction, which performs an in-memory lookup to identify the segment based on the fileId, and then a Read operation is performed in that Segment
 func (kv *KVStore[Key]) Get(key Key) ([]byte, error) {
-	kv.lock.RLock()
+	return kv.getInBucket(appendOnlyLog.DefaultBucket, key)
+}
+
+// getInBucket gets the value corresponding to the key in the bucket, refer to Get. It returns ErrBucketNotFound if the bucket does not exist
+func (kv *KVStore[Key]) getInBucket(bucket uint32, key Key) ([]byte, error) {
+	startTime := time.Now()
+	kv.lockShared()
 	defer kv.lock.RUnlock()
 
-	entry, ok := kv.keyDirectory.Get(key)
+	keyDirectory, ok := kv.bucketDirectories[bucket]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	kv.operations.gets.Add(1)
+	entry, ok := keyDirectory.Get(key)
 	if ok {
 		storedEntry, err := kv.segments.Read(entry.FileId, entry.Offset, entry.EntryLength)
 		if err != nil {
 			return nil, err
 		}
-		return storedEntry.Value, nil
+		value := kv.valueOf(storedEntry)
+		kv.metrics.ObserveGet(time.Since(startTime), entry.sizeInBytes())
+		return value, nil
 	}
+	kv.metrics.ObserveGet(time.Since(startTime), 0)
 	return nil, errors.New(fmt.Sprintf("Key %v does not exist", key))
 }
 
+// Keys returns a snapshot of all the keys, in no particular order
+func (kv *KVStore[Key]) Keys() []Key {
+	keys, _ := kv.keysInBucket(appendOnlyLog.DefaultBucket)
+	return keys
+}
+
+// keysInBucket returns a snapshot of all the keys in the bucket, in no particular order. It returns ErrBucketNotFound if the bucket does not exist
+func (kv *KVStore[Key]) keysInBucket(bucket uint32) ([]Key, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	keyDirectory, ok := kv.bucketDirectories[bucket]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	return keyDirectory.Keys(), nil
+}
+
+// Iterate invokes fn with every key and its value, and stops at the first error returned by fn (or by a read), which it returns.
+// The keys are a snapshot taken when Iterate begins: a key deleted after the snapshot is skipped, and a key put after the snapshot is not visited.
+// Each value is read with the read lock held, but fn is invoked without holding any lock, so fn may put or delete keys.
+func (kv *KVStore[Key]) Iterate(fn func(key Key, value []byte) error) error {
+	return kv.iterateBucket(appendOnlyLog.DefaultBucket, fn)
+}
+
+// iterateBucket invokes fn with every key of the bucket and its value, refer to Iterate. It returns ErrBucketNotFound if the bucket does not exist
+// (or is dropped during the iteration)
+func (kv *KVStore[Key]) iterateBucket(bucket uint32, fn func(key Key, value []byte) error) error {
+	keys, err := kv.keysInBucket(bucket)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		value, ok, err := kv.getIfPresent(bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getIfPresent gets the value corresponding to the key in the bucket under the read lock. It returns false if the key does not exist
+func (kv *KVStore[Key]) getIfPresent(bucket uint32, key Key) ([]byte, bool, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	keyDirectory, ok := kv.bucketDirectories[bucket]
+	if !ok {
+		return nil, false, ErrBucketNotFound
+	}
+	entry, ok := keyDirectory.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	storedEntry, err := kv.segments.Read(entry.FileId, entry.Offset, entry.EntryLength)
+	if err != nil {
+		return nil, false, err
+	}
+	return kv.valueOf(storedEntry), true, nil
+}
+
+// GetReader returns an io.ReadCloser of the value corresponding to the key, which reads the value from a section of the segment file without reading it in memory.
+// The reader has its own file pointer, so it remains readable after a merge removes the segment, and it must be closed by the caller.
+// Returns nil and an error if the key does not exist.
+func (kv *KVStore[Key]) GetReader(key Key) (io.ReadCloser, error) {
+	kv.lockShared()
+	defer kv.lock.RUnlock()
+
+	kv.operations.gets.Add(1)
+	entry, ok := kv.keyDirectory.Get(key)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Key %v does not exist", key))
+	}
+	return kv.segments.ValueReader(entry.FileId, entry.Offset, entry.EntryLength)
+}
+
+// MultiGet gets the values corresponding to all the keys with a single acquisition of the read lock, and returns a MultiGetResult for every key, in the order of the keys.
+// All the Entries are looked up in the KeyDirectory first, and the reads are then performed in the increasing order of fileId and offset, so the reads of a segment are sequential.
+// If the MultiGet parallelism is more than 1 (refer to config.Config.WithMultiGetParallelism), the segments are read concurrently by up to that many goroutines.
+// The latency of every read is recorded in the metrics as a get, excluding the wait for the lock.
+func (kv *KVStore[Key]) MultiGet(keys []Key) []MultiGetResult {
+	kv.lockShared()
+	defer kv.lock.RUnlock()
+
+	kv.operations.gets.Add(int64(len(keys)))
+	results := make([]MultiGetResult, len(keys))
+	reads := make([]multiGetRead, 0, len(keys))
+	for index, key := range keys {
+		entry, ok := kv.keyDirectory.Get(key)
+		if !ok {
+			results[index].Err = errors.New(fmt.Sprintf("Key %v does not exist", key))
+			continue
+		}
+		reads = append(reads, multiGetRead{index: index, entry: entry})
+	}
+	sort.Slice(reads, func(i, j int) bool {
+		if reads[i].entry.FileId != reads[j].entry.FileId {
+			return reads[i].entry.FileId < reads[j].entry.FileId
+		}
+		return reads[i].entry.Offset < reads[j].entry.Offset
+	})
+
+	var readsBySegment [][]multiGetRead
+	start := 0
+	for index := 1; index <= len(reads); index++ {
+		if index == len(reads) || reads[index].entry.FileId != reads[start].entry.FileId {
+			readsBySegment = append(readsBySegment, reads[start:index])
+			start = index
+		}
+	}
+	if kv.multiGetWorkers <= 1 || len(readsBySegment) <= 1 {
+		for _, segmentReads := range readsBySegment {
+			kv.readAll(segmentReads, results)
+		}
+		return results
+	}
+
+	segmentReadsChannel := make(chan []multiGetRead, len(readsBySegment))
+	for _, segmentReads := range readsBySegment {
+		segmentReadsChannel <- segmentReads
+	}
+	close(segmentReadsChannel)
+
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < kv.multiGetWorkers && worker < len(readsBySegment); worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for segmentReads := range segmentReadsChannel {
+				kv.readAll(segmentReads, results)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	return results
+}
+
+// readAll reads the values of the multiGetReads into their MultiGetResults, reusing a read buffer across the reads. It must be invoked with the read lock held.
+func (kv *KVStore[Key]) readAll(reads []multiGetRead, results []MultiGetResult) {
+	buffer := kv.readBuffer()
+	defer kv.releaseReadBuffer(buffer)
+
+	for _, read := range reads {
+		startTime := time.Now()
+		storedEntry, err := kv.segments.ReadInto(read.entry.FileId, read.entry.Offset, read.entry.EntryLength, buffer)
+		if err != nil {
+			results[read.index].Err = err
+			continue
+		}
+		results[read.index].Value = append([]byte(nil), storedEntry.Value...)
+		kv.metrics.ObserveGet(time.Since(startTime), read.entry.sizeInBytes())
+	}
+}
+
+// GetInto gets the value corresponding to the key into dst, and returns dst (or a larger slice if the capacity of dst is not sufficient) resliced to the length of the value.
+// GetInto reads the entry into a pooled buffer and copies only the value into dst, so a caller that reuses dst across reads does not allocate per read.
+// Returns nil and an error if the key does not exist.
+func (kv *KVStore[Key]) GetInto(key Key, dst []byte) ([]byte, error) {
+	var value []byte
+	err := kv.View(key, func(viewed []byte) error {
+		value = append(dst[:0], viewed...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// View gets the value corresponding to the key and invokes fn with it, without copying the value. It returns the error returned by fn, or an error if the key does not exist.
+// The value is a slice of a pooled buffer (or of the memory mapping of a segment), it remains valid only until fn returns and fn must not modify it.
+// fn is invoked with the read lock of KVStore held, so fn must not invoke an operation that needs the exclusive lock (for example, Put or Delete).
+func (kv *KVStore[Key]) View(key Key, fn func(value []byte) error) error {
+	startTime := time.Now()
+	kv.lockShared()
+	defer kv.lock.RUnlock()
+
+	kv.operations.gets.Add(1)
+	entry, ok := kv.keyDirectory.Get(key)
+	if !ok {
+		kv.metrics.ObserveGet(time.Since(startTime), 0)
+		return errors.New(fmt.Sprintf("Key %v does not exist", key))
+	}
+	buffer := kv.readBuffer()
+	defer kv.releaseReadBuffer(buffer)
+
+	storedEntry, err := kv.segments.ReadInto(entry.FileId, entry.Offset, entry.EntryLength, buffer)
+	if err != nil {
+		return err
+	}
+	kv.metrics.ObserveGet(time.Since(startTime), entry.sizeInBytes())
+	return fn(storedEntry.Value)
+}
+
+// lockExclusively acquires the exclusive lock, and records the time spent waiting for it in the metrics
+func (kv *KVStore[Key]) lockExclusively() {
+	if kv.metrics == nil {
+		kv.lock.Lock()
+		return
+	}
+	startTime := time.Now()
+	kv.lock.Lock()
+	kv.metrics.ObserveWriteLockWait(time.Since(startTime))
+}
+
+// lockShared acquires the read lock, and records the time spent waiting for it in the metrics
+func (kv *KVStore[Key]) lockShared() {
+	if kv.metrics == nil {
+		kv.lock.RLock()
+		return
+	}
+	startTime := time.Now()
+	kv.lock.RLock()
+	kv.metrics.ObserveReadLockWait(time.Since(startTime))
+}
+
+// readBuffer returns a buffer from the pool of read buffers, or a new empty buffer if the pool is empty
+func (kv *KVStore[Key]) readBuffer() *[]byte {
+	if buffer, ok := kv.readBuffers.Get().(*[]byte); ok {
+		return buffer
+	}
+	return new([]byte)
+}
+
+// releaseReadBuffer returns the buffer to the pool of read buffers, unless it has grown beyond maxPooledReadBufferBytes (for example, to read a large blob value)
+func (kv *KVStore[Key]) releaseReadBuffer(buffer *[]byte) {
+	if cap(*buffer) <= maxPooledReadBufferBytes {
+		kv.readBuffers.Put(buffer)
+	}
+}
+
+// valueOf returns the value of the stored entry. The value is copied if the segments are memory-mapped, because the value may be a slice of
+// the mapping of a segment which is unmapped when a merge removes the segment
+func (kv *KVStore[Key]) valueOf(storedEntry *appendOnlyLog.StoredEntry) []byte {
+	if kv.memoryMappedReads {
+		return append([]byte(nil), storedEntry.Value...)
+	}
+	return storedEntry.Value
+}
+
 // ReadInactiveSegments reads inactive segments identified by `totalSegments`. This operation is performed during merge.
 // keyMapper is used to map a byte slice Key to a generically typed Key. keyMapper is basically a means to perform deserialization of keys which is necessary to update the state in KeyDirectory after the merge operation is done, more on this is mentioned in KeyDirectory.go
 func (kv *KVStore[Key]) ReadInactiveSegments(totalSegments int, keyMapper func([]byte) Key) ([]uint64, [][]*appendOnlyLog.MappedStoredEntry[Key], error) {
@@ -121,29 +596,328 @@ func (kv *KVStore[Key]) ReadAllInactiveSegments(keyMapper func([]byte) Key) ([]u
 	return kv.segments.ReadAllInactiveSegments(keyMapper)
 }
 
+// InactiveSegmentStats returns the SegmentStats of all the inactive segments in the increasing order of their fileIds (oldest first).
+// It is computed from the in-memory state of Segments and KeyDirectory, without reading the segment files, and is used to select the segments for merge.
+func (kv *KVStore[Key]) InactiveSegmentStats() []*SegmentStats {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	return kv.inactiveSegmentStats()
+}
+
+// inactiveSegmentStats returns the SegmentStats of all the inactive segments, it must be invoked with the lock held. Refer to InactiveSegmentStats
+func (kv *KVStore[Key]) inactiveSegmentStats() []*SegmentStats {
+	sizes, inactiveSegments := kv.segments.InactiveSegmentSizes(), kv.segments.AllInactiveSegments()
+	stats := make([]*SegmentStats, 0, len(sizes))
+	for _, fileId := range kv.segments.InactiveSegmentIds() {
+		keyId, encrypted := inactiveSegments[fileId].KeyId()
+		stats = append(stats, &SegmentStats{
+			FileId:     fileId,
+			TotalBytes: sizes[fileId],
+			LiveBytes:  kv.liveBytes(fileId),
+			KeyId:      keyId,
+			Encrypted:  encrypted,
+			Tombstones: inactiveSegments[fileId].Tombstones(),
+		})
+	}
+	return stats
+}
+
+// Stats returns the Stats of the KVStore, computed under the read lock from the in-memory state of Segments and the KeyDirectories. Refer to Stats
+func (kv *KVStore[Key]) Stats() *Stats {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	segmentStats := kv.inactiveSegmentStats()
+	stats := &Stats{InactiveSegments: len(segmentStats), Segments: segmentStats, Operations: kv.operations.snapshot()}
+	for _, keyDirectory := range kv.bucketDirectories {
+		stats.Keys = stats.Keys + keyDirectory.Len()
+	}
+	for _, segment := range segmentStats {
+		stats.TotalBytes = stats.TotalBytes + segment.TotalBytes
+		stats.LiveBytes = stats.LiveBytes + segment.LiveBytes
+		stats.Tombstones = stats.Tombstones + segment.Tombstones
+	}
+	if activeSegment := kv.segments.ActiveSegment(); activeSegment != nil {
+		stats.ActiveSegmentFileId, stats.ActiveSegmentBytes = activeSegment.FileId(), activeSegment.SizeInBytes()
+		stats.TotalBytes = stats.TotalBytes + activeSegment.SizeInBytes()
+		stats.LiveBytes = stats.LiveBytes + kv.liveBytes(activeSegment.FileId())
+		stats.Tombstones = stats.Tombstones + activeSegment.Tombstones()
+	}
+	stats.DeadBytes = stats.TotalBytes - stats.LiveBytes
+	return stats
+}
+
+// CurrentKeyId returns the id of the key that encrypts the new segments, and false if encryption is not enabled
+func (kv *KVStore[Key]) CurrentKeyId() (uint32, bool) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	return kv.segments.CurrentKeyId()
+}
+
+// Metrics returns the metrics of KVStore, nil if the metrics are not enabled. Refer to config.Config.WithMetrics
+func (kv *KVStore[Key]) Metrics() *metrics.Metrics {
+	return kv.metrics
+}
+
+// EventListener returns the config.EventListener of KVStore, refer to config.Config.WithEventListener
+func (kv *KVStore[Key]) EventListener() config.EventListener {
+	return kv.eventListener
+}
+
+// CompressionStats returns the CompressionStats of the values put since the KVStore was created
+func (kv *KVStore[Key]) CompressionStats() *CompressionStats {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	rawBytes, compressedBytes := kv.segments.ValueBytes()
+	return &CompressionStats{RawBytes: rawBytes, CompressedBytes: compressedBytes}
+}
+
+// ValueCacheStats returns the ValueCacheStats of the cache of the recently read values, nil if the cache is not enabled
+func (kv *KVStore[Key]) ValueCacheStats() *ValueCacheStats {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	valueCache := kv.segments.ValueCache()
+	if valueCache == nil {
+		return nil
+	}
+	hits, misses, entries, sizeBytes := valueCache.Stats()
+	return &ValueCacheStats{Hits: hits, Misses: misses, Entries: entries, SizeBytes: sizeBytes}
+}
+
+// InactiveBlobSegmentStats returns the SegmentStats of all the inactive blob segments in the increasing order of their fileIds (oldest first).
+// LiveBytes of a blob segment is the sum of the lengths of the blob entries referred to by the KeyDirectory, refer to MergeBlobSegments.
+func (kv *KVStore[Key]) InactiveBlobSegmentStats() []*SegmentStats {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	blobSegments := kv.segments.BlobSegments()
+	sizes, inactiveSegments := blobSegments.InactiveSegmentSizes(), blobSegments.AllInactiveSegments()
+	stats := make([]*SegmentStats, 0, len(sizes))
+	for _, fileId := range blobSegments.InactiveSegmentIds() {
+		keyId, encrypted := inactiveSegments[fileId].KeyId()
+		stats = append(stats, &SegmentStats{
+			FileId:     fileId,
+			TotalBytes: sizes[fileId],
+			LiveBytes:  kv.liveBlobBytes(fileId),
+			KeyId:      keyId,
+			Encrypted:  encrypted,
+		})
+	}
+	return stats
+}
+
 // WriteBack writes back the changes (merged changes) to new inactive segments. This operation is performed during merge.
-// It writes all the changes into M new inactive segments and once those changes are written to the new inactive segment(s), the state of the keys present in the `changes` parameter is updated in the KeyDirectory. More on this is mentioned in Worker.go inside merge/ package.
+// It writes all the changes into M new inactive segments without holding the lock, and once those changes are written to the new inactive segment(s),
+// the state of the keys present in the `changes` parameter is updated in the KeyDirectory under the exclusive lock. More on this is mentioned in Worker.go inside merge/ package.
+// A key that is put or deleted while its change is being written back keeps its newer state, refer to KeyDirectory.CompareAndPut.
 // Once the state is updated in the KeyDirectory, the old segments identified by `fileIds` are removed from disk.
 func (kv *KVStore[Key]) WriteBack(fileIds []uint64, changes map[Key]*appendOnlyLog.MappedStoredEntry[Key]) error {
+	writer := kv.segments.NewWriteBackWriter()
+	defer func() {
+		kv.lock.Lock()
+		writer.Close()
+		kv.lock.Unlock()
+	}()
+
+	pendingWriteBacks := make([]*pendingWriteBack[Key], 0, len(changes))
+	for key, value := range changes {
+		if err := kv.maybeRolloverWriteBack(writer, key, value); err != nil {
+			return err
+		}
+		kv.lock.RLock()
+		keyDirectory, ok := kv.bucketDirectories[value.Bucket]
+		var previous *Entry
+		if ok {
+			previous, _ = keyDirectory.Get(key)
+		}
+		kv.lock.RUnlock()
+		if !ok {
+			continue
+		}
+
+		writeBackResponse, err := writer.Append(key, value)
+		if err != nil {
+			return err
+		}
+		pendingWriteBacks = append(pendingWriteBacks, &pendingWriteBack[Key]{bucket: value.Bucket, response: writeBackResponse, previous: previous})
+	}
+	writer.Sync()
+
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
 
-	writeBackResponses, err := kv.segments.WriteBack(changes)
+	kv.applyWriteBacks(pendingWriteBacks)
+	kv.segments.Remove(fileIds)
+	return nil
+}
+
+// MergeSegments merges the inactive segments identified by `fileIds`. This operation is performed during merge.
+// Each segment is streamed entry by entry using a SegmentIterator, so a segment is never loaded in memory in its entirety.
+// An entry is live if the KeyDirectory still points to its fileId and offset, only the live entries are written to the new inactive segment(s)
+// and the KeyDirectory is updated to point to their new position. Older values are not live, and are dropped.
+// The liveness rule does not depend on the timestamps of the entries, so merge is correct regardless of clock skew or timestamp collisions.
+//
+// A deleted entry (tombstone) is dropped only if there is no inactive segment older than the segment containing the tombstone.
+// Otherwise, an older segment may still contain a value of the deleted key and dropping the tombstone would bring that value back on reload.
+// Such a tombstone is written back unless the key has been put again after the deletion, in which case the newer value already overrides the older ones.
+// The segments are merged in the increasing order of their fileIds.
+// The new segments are written without holding the lock of KVStore, the exclusive lock is held only to update the KeyDirectory after every chunk of a segment
+// and to remove the segment once all its live entries are written back. The throttle is acquired after every chunk, without holding the lock.
+// The context is checked before merging every segment (and by the throttle), a cancelled merge returns the context error along with the response of the segments merged so far.
+// A merge which runs (or continues to run) after KVStore is shut down returns ErrShutdown, refer to Shutdown.
+// keyMapper is used to map a byte slice Key to a generically typed Key, more on this is mentioned in KeyDirectory.go.
+func (kv *KVStore[Key]) MergeSegments(
+	ctx context.Context,
+	fileIds []uint64,
+	keyMapper func([]byte) Key,
+	throttle MergeThrottle) (*MergeSegmentsResponse, error) {
+
+	kv.lock.Lock()
+	if kv.closed {
+		kv.lock.Unlock()
+		return &MergeSegmentsResponse{}, ErrShutdown
+	}
+	writer := kv.segments.NewWriteBackWriter()
+	kv.lock.Unlock()
+
+	response := &MergeSegmentsResponse{}
+	defer func() {
+		kv.lock.Lock()
+		writer.Close()
+		kv.lock.Unlock()
+		response.SegmentsWritten, response.BytesWritten = writer.SegmentsWritten(), writer.BytesWritten()
+	}()
+
+	sortedFileIds := make([]uint64, len(fileIds))
+	copy(sortedFileIds, fileIds)
+	sort.Slice(sortedFileIds, func(i, j int) bool {
+		return sortedFileIds[i] < sortedFileIds[j]
+	})
+	for _, fileId := range sortedFileIds {
+		if err := ctx.Err(); err != nil {
+			return response, err
+		}
+		if err := kv.mergeSegment(ctx, fileId, writer, keyMapper, throttle, response); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// MergeBlobSegments performs the garbage collection of the inactive blob segments identified by `fileIds`, independently of the merge of segments.
+// A blob entry is live if the KeyDirectory refers to its blob fileId and offset. Each blob segment is streamed entry by entry, the live blob entries are
+// written to new inactive blob segment(s) without holding the lock of KVStore, and the dead blob entries are dropped.
+// For every live blob entry that is written back, a new BlobReference is appended to the active segment under the exclusive lock,
+// and the KeyDirectory is updated to point to it, unless the key has been put or deleted in the meantime.
+// Appending the new BlobReference to the active segment ensures that it wins over the older BlobReference on reload, refer to Segments.AppendBlobReference.
+// The blob segment is removed once the active segment is synced, so that a BlobReference never refers to a removed blob segment after a crash.
+// The throttle and the context are used just like in MergeSegments.
+func (kv *KVStore[Key]) MergeBlobSegments(
+	ctx context.Context,
+	fileIds []uint64,
+	keyMapper func([]byte) Key,
+	throttle MergeThrottle) (*MergeSegmentsResponse, error) {
+
+	kv.lock.Lock()
+	if kv.closed {
+		kv.lock.Unlock()
+		return &MergeSegmentsResponse{}, ErrShutdown
+	}
+	writer := kv.segments.BlobSegments().NewWriteBackWriter()
+	kv.lock.Unlock()
+
+	response := &MergeSegmentsResponse{}
+	defer func() {
+		kv.lock.Lock()
+		writer.Close()
+		kv.lock.Unlock()
+		response.SegmentsWritten, response.BytesWritten = writer.SegmentsWritten(), writer.BytesWritten()
+	}()
+
+	for _, fileId := range fileIds {
+		if err := ctx.Err(); err != nil {
+			return response, err
+		}
+		if err := kv.mergeBlobSegment(ctx, fileId, writer, keyMapper, throttle, response); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// CreateBucket creates a new bucket with an empty KeyDirectory and returns it. It returns ErrBucketExists if a bucket with the same name already exists
+func (kv *KVStore[Key]) CreateBucket(name string) (*Bucket[Key], error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	id, err := kv.buckets.create(name)
+	if err != nil {
+		return nil, err
+	}
+	kv.bucketDirectories[id] = NewKeyDirectory[Key](0)
+	return &Bucket[Key]{kvStore: kv, name: name, id: id}, nil
+}
+
+// Bucket returns the bucket identified by the name, or ErrBucketNotFound if the bucket does not exist
+func (kv *KVStore[Key]) Bucket(name string) (*Bucket[Key], error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	id, ok := kv.buckets.idOf(name)
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	return &Bucket[Key]{kvStore: kv, name: name, id: id}, nil
+}
+
+// DropBucket drops the bucket identified by the name, or returns ErrBucketNotFound if the bucket does not exist.
+// Dropping a bucket is a logical operation: the bucket is removed from the bucket registry and its KeyDirectory is discarded, but its entries remain in the segments.
+// They are not live anymore, so the merge reclaims their space, and the reload skips them.
+func (kv *KVStore[Key]) DropBucket(name string) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	id, err := kv.buckets.drop(name)
 	if err != nil {
 		return err
 	}
-	kv.keyDirectory.BulkUpdate(writeBackResponses)
-	kv.segments.Remove(fileIds)
+	delete(kv.bucketDirectories, id)
 	return nil
 }
 
-// ClearLog removes all the log files
+// BucketNames returns the names of all the buckets, in the increasing order
+func (kv *KVStore[Key]) BucketNames() []string {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	return kv.buckets.names()
+}
+
+// bucketStats returns the BucketStats of the bucket. It returns ErrBucketNotFound if the bucket does not exist
+func (kv *KVStore[Key]) bucketStats(bucket uint32) (*BucketStats, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	keyDirectory, ok := kv.bucketDirectories[bucket]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	liveBytes, liveBlobBytes := keyDirectory.TotalLiveBytes()
+	return &BucketStats{Keys: keyDirectory.Len(), LiveBytes: liveBytes, LiveBlobBytes: liveBlobBytes}, nil
+}
+
+// ClearLog removes all the log files, along with the bucket registry
 func (kv *KVStore[Key]) ClearLog() {
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
 
 	kv.segments.RemoveActive()
 	kv.segments.RemoveAllInactive()
+	kv.buckets.remove()
 }
 
 // Sync performs a sync of all the active and inactive segments. This implementation uses the Segment vocabulary over DataFile vocabulary
@@ -154,25 +928,439 @@ func (kv *KVStore[Key]) Sync() {
 	kv.segments.Sync()
 }
 
-// Shutdown performs a shutdown of the segments which involves setting the active segment to nil and removing the entire in-memory representation of the inactive segments
+// RolloverExpiredSegments rolls over the active segment and the active blob segment under the exclusive lock if their first entry is older than the max segment age,
+// and returns true if the active segment is rolled over. It returns ErrShutdown once KVStore is shut down. Refer to config.Config.WithMaxSegmentAge and RolloverWorker
+func (kv *KVStore[Key]) RolloverExpiredSegments() (bool, error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.closed {
+		return false, ErrShutdown
+	}
+	return kv.segments.RolloverExpiredActiveSegments()
+}
+
+// Shutdown performs a shutdown of the segments which involves setting the active segment to nil and removing the entire in-memory representation of the inactive segments.
+// KVStore is marked closed, so a merge which is still running returns ErrShutdown instead of writing to the segments, refer to MergeSegments
 func (kv *KVStore[Key]) Shutdown() {
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
 
+	kv.closed = true
 	kv.segments.Shutdown()
 }
 
-// reload the entire state during start-up.
-func (kv *KVStore[Key]) reload(cfg *config.Config[Key]) error {
+// isClosed returns true if KVStore is shut down
+func (kv *KVStore[Key]) isClosed() bool {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	return kv.closed
+}
+
+// mergeSegment writes back the live entries of the inactive segment identified by fileId and removes the segment.
+// The segment is merged in chunks of `mergeChunkSizeBytes` and the throttle is acquired after every chunk. The entries are written to the new segments
+// without holding the lock of KVStore, the lock is held only to decide the liveness of an entry, to update the KeyDirectory for a chunk and to remove the segment.
+func (kv *KVStore[Key]) mergeSegment(
+	ctx context.Context,
+	fileId uint64,
+	writer *appendOnlyLog.WriteBackWriter[Key],
+	keyMapper func([]byte) Key,
+	throttle MergeThrottle,
+	response *MergeSegmentsResponse) error {
+
+	kv.lock.RLock()
+	iterator, err := kv.segments.Iterator(fileId, keyMapper)
+	retainTombstones := kv.segments.HasInactiveSegmentOlderThan(fileId)
+	kv.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer iterator.Close()
+
+	for done := false; !done; {
+		var chunkBytes int64
+		done, chunkBytes, err = kv.mergeChunk(fileId, iterator, writer, retainTombstones, response)
+		if err != nil {
+			return err
+		}
+		if err := throttle.Acquire(ctx, chunkBytes); err != nil {
+			return err
+		}
+	}
+	writer.Sync()
+
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.closed {
+		return ErrShutdown
+	}
+	kv.segments.Remove([]uint64{fileId})
+	response.SegmentsRead = response.SegmentsRead + 1
+	return nil
+}
+
+// mergeChunk writes back the live entries from the iterator until `mergeChunkSizeBytes` are read and written, or the iterator is exhausted.
+// It returns true if the iterator is exhausted, along with the number of bytes read and written. The bytes read are added to the response.
+//
+// The liveness of an entry is decided under the read lock, after the writer has been rolled over (if needed, the liveness is decided again after the rollover).
+// The live entry is then written to the new segment without any lock,
+// and the KeyDirectory is updated for all the live entries of the chunk under the exclusive lock, only if the KeyDirectory still points to the merged segment.
+// If a key is put (or deleted) after its liveness is decided, the KeyDirectory is not updated and the copy in the new segment remains as garbage.
+// That copy never wins on reload because the new put goes to an active segment which is newer than the new segment, refer to WriteBackWriter.Rollover.
+func (kv *KVStore[Key]) mergeChunk(
+	fileId uint64,
+	iterator *appendOnlyLog.SegmentIterator[Key],
+	writer *appendOnlyLog.WriteBackWriter[Key],
+	retainTombstones bool,
+	response *MergeSegmentsResponse) (bool, int64, error) {
+
+	if kv.isClosed() {
+		return false, 0, ErrShutdown
+	}
+	var pendingWriteBacks []*pendingWriteBack[Key]
+	defer func() {
+		kv.lock.Lock()
+		kv.applyWriteBacks(pendingWriteBacks)
+		kv.lock.Unlock()
+	}()
+
+	bytesWrittenBefore, bytesRead := writer.BytesWritten(), int64(0)
+	chunkBytes := func() int64 {
+		return bytesRead + writer.BytesWritten() - bytesWrittenBefore
+	}
+	for chunkBytes() < mergeChunkSizeBytes {
+		entry, err := iterator.Next()
+		if err == io.EOF {
+			return true, chunkBytes(), nil
+		}
+		if err != nil {
+			return false, chunkBytes(), err
+		}
+		bytesRead = bytesRead + int64(entry.EntryLength)
+		response.BytesRead = response.BytesRead + int64(entry.EntryLength)
+
+		shouldWriteBack, previous := kv.shouldWriteBack(fileId, entry, retainTombstones)
+		if shouldWriteBack && writer.ShouldRollover(entry.Key, entry) {
+			if err := kv.maybeRolloverWriteBack(writer, entry.Key, entry); err != nil {
+				return false, chunkBytes(), err
+			}
+			shouldWriteBack, previous = kv.shouldWriteBack(fileId, entry, retainTombstones)
+		}
+		if !shouldWriteBack {
+			response.EntriesDropped = response.EntriesDropped + 1
+			continue
+		}
+		writeBackResponse, err := writer.Append(entry.Key, entry)
+		if err != nil {
+			return false, chunkBytes(), err
+		}
+		if !entry.Deleted {
+			pendingWriteBacks = append(pendingWriteBacks, &pendingWriteBack[Key]{bucket: entry.Bucket, response: writeBackResponse, previous: previous})
+		}
+	}
+	return false, chunkBytes(), nil
+}
+
+// shouldWriteBack decides under the read lock if the entry of the segment identified by fileId is to be written back, and returns the Entry of its key in the KeyDirectory of its bucket.
+// A value is written back if the KeyDirectory points to it, and a tombstone is written back if it is to be retained and its key is absent in the KeyDirectory.
+// No entry of a dropped bucket is written back, its id is never reused so its tombstones are not needed either.
+func (kv *KVStore[Key]) shouldWriteBack(fileId uint64, entry *appendOnlyLog.MappedStoredEntry[Key], retainTombstones bool) (bool, *Entry) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	keyDirectory, ok := kv.bucketDirectories[entry.Bucket]
+	if !ok {
+		return false, nil
+	}
+	previous, ok := keyDirectory.Get(entry.Key)
+	if entry.Deleted {
+		return retainTombstones && !ok, nil
+	}
+	return ok && previous.FileId == fileId && previous.Offset == int64(entry.KeyOffset), previous
+}
+
+// maybeRolloverWriteBack rolls over the writer under the exclusive lock if its segment is missing or can not fit the entry, refer to WriteBackWriter.Rollover.
+// It returns ErrShutdown if KVStore is shut down, because the rollover syncs the active segment which does not exist anymore
+func (kv *KVStore[Key]) maybeRolloverWriteBack(writer *appendOnlyLog.WriteBackWriter[Key], key Key, entry *appendOnlyLog.MappedStoredEntry[Key]) error {
+	if !writer.ShouldRollover(key, entry) {
+		return nil
+	}
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.closed {
+		return ErrShutdown
+	}
+	return writer.Rollover()
+}
+
+// applyWriteBacks updates the KeyDirectory to point to the new positions of the written back entries, unless the keys have changed since. It must be invoked with the exclusive lock held
+// The entries of a bucket dropped in the meantime are skipped.
+func (kv *KVStore[Key]) applyWriteBacks(pendingWriteBacks []*pendingWriteBack[Key]) {
+	for _, pending := range pendingWriteBacks {
+		keyDirectory, ok := kv.bucketDirectories[pending.bucket]
+		if !ok {
+			continue
+		}
+		keyDirectory.CompareAndPut(pending.response.Key, pending.previous, NewEntryFrom(pending.response.AppendEntryResponse))
+	}
+}
+
+// mergeBlobSegment writes back the live blob entries of the inactive blob segment identified by fileId and removes the blob segment, refer to MergeBlobSegments
+func (kv *KVStore[Key]) mergeBlobSegment(
+	ctx context.Context,
+	fileId uint64,
+	writer *appendOnlyLog.BlobWriteBackWriter[Key],
+	keyMapper func([]byte) Key,
+	throttle MergeThrottle,
+	response *MergeSegmentsResponse) error {
+
+	kv.lock.RLock()
+	blobSegments := kv.segments.BlobSegments()
+	iterator, err := blobSegments.Iterator(fileId, keyMapper)
+	kv.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer iterator.Close()
+
+	for done := false; !done; {
+		var chunkBytes int64
+		done, chunkBytes, err = kv.mergeBlobChunk(fileId, iterator, writer, response)
+		if err != nil {
+			return err
+		}
+		if err := throttle.Acquire(ctx, chunkBytes); err != nil {
+			return err
+		}
+	}
+	writer.Sync()
+
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.closed {
+		return ErrShutdown
+	}
+	kv.segments.SyncActive()
+	blobSegments.Remove([]uint64{fileId})
+	response.SegmentsRead = response.SegmentsRead + 1
+	return nil
+}
+
+// mergeBlobChunk writes back the live blob entries from the iterator until `mergeChunkSizeBytes` are read and written, or the iterator is exhausted.
+// It returns true if the iterator is exhausted, along with the number of bytes read and written. The bytes read are added to the response.
+// The liveness of a blob entry is decided under the read lock, the live blob entry is written to the new blob segment without any lock and
+// the new BlobReferences of the chunk are appended to the active segment under the exclusive lock.
+func (kv *KVStore[Key]) mergeBlobChunk(
+	fileId uint64,
+	iterator *appendOnlyLog.SegmentIterator[Key],
+	writer *appendOnlyLog.BlobWriteBackWriter[Key],
+	response *MergeSegmentsResponse) (bool, int64, error) {
+
+	if kv.isClosed() {
+		return false, 0, ErrShutdown
+	}
+	var pendingBlobWriteBacks []*pendingBlobWriteBack[Key]
+	bytesWrittenBefore, bytesRead := writer.BytesWritten(), int64(0)
+	chunkBytes := func() int64 {
+		return bytesRead + writer.BytesWritten() - bytesWrittenBefore
+	}
+	done := false
+	for chunkBytes() < mergeChunkSizeBytes {
+		entry, err := iterator.Next()
+		if err == io.EOF {
+			done = true
+			break
+		}
+		if err != nil {
+			return false, chunkBytes(), err
+		}
+		bytesRead = bytesRead + int64(entry.EntryLength)
+		response.BytesRead = response.BytesRead + int64(entry.EntryLength)
+
+		live := kv.isLiveBlobEntry(fileId, entry)
+		if live && writer.ShouldRollover(entry.Key, entry) {
+			if err := kv.maybeRolloverBlobWriteBack(writer, entry); err != nil {
+				return false, chunkBytes(), err
+			}
+			live = kv.isLiveBlobEntry(fileId, entry)
+		}
+		if !live {
+			response.EntriesDropped = response.EntriesDropped + 1
+			continue
+		}
+		reference, err := writer.Append(entry.Key, entry)
+		if err != nil {
+			return false, chunkBytes(), err
+		}
+		pendingBlobWriteBacks = append(pendingBlobWriteBacks, &pendingBlobWriteBack[Key]{
+			bucket:         entry.Bucket,
+			key:            entry.Key,
+			reference:      reference,
+			timestamp:      entry.Timestamp,
+			previousFileId: fileId,
+			previousOffset: int64(entry.KeyOffset),
+		})
+	}
+	return done, chunkBytes(), kv.applyBlobWriteBacks(pendingBlobWriteBacks)
+}
+
+// isLiveBlobEntry decides under the read lock if the KeyDirectory of the bucket of the blob entry refers to the blob entry of the blob segment identified by fileId
+func (kv *KVStore[Key]) isLiveBlobEntry(fileId uint64, entry *appendOnlyLog.MappedStoredEntry[Key]) bool {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	keyDirectory, ok := kv.bucketDirectories[entry.Bucket]
+	return ok && keyDirectory.PointsToBlob(entry.Key, fileId, int64(entry.KeyOffset))
+}
+
+// maybeRolloverBlobWriteBack rolls over the blob writer under the exclusive lock if its blob segment is missing or can not fit the blob entry. It returns ErrShutdown if KVStore is shut down
+func (kv *KVStore[Key]) maybeRolloverBlobWriteBack(writer *appendOnlyLog.BlobWriteBackWriter[Key], entry *appendOnlyLog.MappedStoredEntry[Key]) error {
+	if !writer.ShouldRollover(entry.Key, entry) {
+		return nil
+	}
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.closed {
+		return ErrShutdown
+	}
+	return writer.Rollover()
+}
+
+// applyBlobWriteBacks appends the new BlobReferences to the active segment and updates the KeyDirectory under the exclusive lock,
+// only for the keys which still refer to the blob entries being merged. A key that is put or deleted in the meantime does not refer to them anymore.
+// It returns ErrShutdown if KVStore is shut down, because the active segment does not exist anymore.
+func (kv *KVStore[Key]) applyBlobWriteBacks(pendingBlobWriteBacks []*pendingBlobWriteBack[Key]) error {
+	if len(pendingBlobWriteBacks) == 0 {
+		return nil
+	}
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
 
-	for fileId, segment := range kv.segments.AllInactiveSegments() {
-		entries, err := segment.ReadFull(cfg.MergeConfig().KeyMapper())
+	if kv.closed {
+		return ErrShutdown
+	}
+	for _, pending := range pendingBlobWriteBacks {
+		keyDirectory, ok := kv.bucketDirectories[pending.bucket]
+		if !ok || !keyDirectory.PointsToBlob(pending.key, pending.previousFileId, pending.previousOffset) {
+			continue
+		}
+		appendEntryResponse, err := kv.segments.AppendBlobReference(pending.bucket, pending.key, pending.reference, pending.timestamp)
 		if err != nil {
 			return err
 		}
-		kv.keyDirectory.Reload(fileId, entries)
+		keyDirectory.Put(pending.key, NewEntryFrom(appendEntryResponse))
 	}
 	return nil
 }
+
+// reload the entire state during start-up. The inactive segments, and the active segment if the previous active segment is reused, are reloaded
+// in the increasing order of their fileIds, so that the latest entry of a key wins.
+// The segments are read and decoded concurrently by up to config.Config.ReloadParallelism goroutines (so the keyMapper must be safe for concurrent use),
+// whereas the decoded segments are applied to the KeyDirectory one at a time, in the increasing order of their fileIds. A segment is decoded only if fewer than
+// ReloadParallelism decoded segments are waiting to be applied, which bounds the memory used by the reload.
+// The config.Config.ReloadProgress callback, if any, and the config.EventListener are invoked after every segment is applied to the KeyDirectory.
+// A segment which can not be read or decoded is reported to the config.EventListener as a corruption, and fails the reload.
+// A segment which ends with a partial entry (left by a crash during a merge) is reported as a corruption too, but its complete entries are reloaded
+// and the partial entry is truncated, refer to log.Segments.TruncatePartialTail.
+// The entries are applied to the KeyDirectory of their bucket, and the entries of the dropped buckets are skipped.
+func (kv *KVStore[Key]) reload(cfg *config.Config[Key]) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	parallelism := cfg.ReloadParallelism()
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	fileIds, segments, sizes := kv.segments.SegmentsToReload()
+	progress := config.ReloadProgress{TotalSegments: len(fileIds)}
+	for _, fileId := range fileIds {
+		progress.TotalBytes = progress.TotalBytes + sizes[fileId]
+	}
+
+	decoded := make([]chan reloadedSegment[Key], len(fileIds))
+	for index := range decoded {
+		decoded[index] = make(chan reloadedSegment[Key], 1)
+	}
+	slots, done := make(chan struct{}, parallelism), make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for index, fileId := range fileIds {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(segment *appendOnlyLog.Segment[Key], result chan<- reloadedSegment[Key]) {
+				entries, err := segment.ReadFull(cfg.MergeConfig().KeyMapper())
+				result <- reloadedSegment[Key]{entries: entries, err: err}
+			}(segments[fileId], decoded[index])
+		}
+	}()
+
+	for index, fileId := range fileIds {
+		reloaded := <-decoded[index]
+		<-slots
+		if reloaded.err != nil {
+			kv.eventListener.CorruptionDetected(config.CorruptionEvent{FileId: fileId, Err: reloaded.err})
+			if err := kv.truncatePartialTail(fileId, reloaded.err); err != nil {
+				return err
+			}
+		}
+		kv.reloadBuckets(fileId, reloaded.entries)
+
+		progress.SegmentsReloaded = progress.SegmentsReloaded + 1
+		progress.BytesReloaded = progress.BytesReloaded + sizes[fileId]
+		if reloadProgress := cfg.ReloadProgress(); reloadProgress != nil {
+			reloadProgress(progress)
+		}
+		kv.eventListener.ReloadProgressed(progress)
+	}
+	return nil
+}
+
+// truncatePartialTail truncates the partial entry at the end of the segment identified by fileId if err is caused by log.ErrTruncatedEntry, else it returns err
+func (kv *KVStore[Key]) truncatePartialTail(fileId uint64, err error) error {
+	var corruptSegmentError *appendOnlyLog.CorruptSegmentError
+	if !errors.Is(err, appendOnlyLog.ErrTruncatedEntry) || !errors.As(err, &corruptSegmentError) {
+		return err
+	}
+	return kv.segments.TruncatePartialTail(fileId, corruptSegmentError.Offset)
+}
+
+// reloadBuckets applies the reloaded entries of the segment identified by fileId to the KeyDirectory of their bucket, refer to reload.
+// The entries of the buckets which are not registered (the dropped buckets) are skipped.
+func (kv *KVStore[Key]) reloadBuckets(fileId uint64, entries []*appendOnlyLog.MappedStoredEntry[Key]) {
+	entriesByBucket := make(map[uint32][]*appendOnlyLog.MappedStoredEntry[Key])
+	for _, entry := range entries {
+		entriesByBucket[entry.Bucket] = append(entriesByBucket[entry.Bucket], entry)
+	}
+	for bucket, bucketEntries := range entriesByBucket {
+		if keyDirectory, ok := kv.bucketDirectories[bucket]; ok {
+			keyDirectory.Reload(fileId, bucketEntries)
+		}
+	}
+}
+
+// liveBytes returns the live bytes of the segment identified by fileId across the KeyDirectories of all the buckets
+func (kv *KVStore[Key]) liveBytes(fileId uint64) int64 {
+	var liveBytes int64
+	for _, keyDirectory := range kv.bucketDirectories {
+		liveBytes = liveBytes + keyDirectory.LiveBytes(fileId)
+	}
+	return liveBytes
+}
+
+// liveBlobBytes returns the live bytes of the blob segment identified by fileId across the KeyDirectories of all the buckets
+func (kv *KVStore[Key]) liveBlobBytes(fileId uint64) int64 {
+	var liveBytes int64
+	for _, keyDirectory := range kv.bucketDirectories {
+		liveBytes = liveBytes + keyDirectory.LiveBlobBytes(fileId)
+	}
+	return liveBytes
+}
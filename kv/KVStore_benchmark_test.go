@@ -0,0 +1,94 @@
+package kv
+
+import (
+	bitCaskConfig "bitcask/config"
+	"context"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchmarkGetDuringMerge measures the latency of Get while the inactive segments are being merged continuously.
+// The merge writes the new segments without holding the lock of KVStore, so the p99 latency of Get should stay close to the latency without a merge.
+// Run with: go test -run=^$ -bench=BenchmarkGetDuringMerge ./kv/
+func BenchmarkGetDuringMerge(b *testing.B) {
+	config := bitCaskConfig.NewConfig(b.TempDir(), 64*1024, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	totalKeys, value := 20_000, make([]byte, 128)
+	for round := 1; round <= 2; round++ {
+		for count := 0; count < totalKeys; count++ {
+			_ = kv.Put(serializableKey(strconv.Itoa(count)), value)
+		}
+	}
+
+	var stop atomic.Bool
+	merged := make(chan struct{})
+	go func() {
+		defer close(merged)
+		for !stop.Load() {
+			kv.lock.RLock()
+			fileIds := kv.segments.InactiveSegmentIds()
+			kv.lock.RUnlock()
+
+			_, _ = kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+				return serializableKey(key)
+			}, unlimitedMergeThrottle{})
+		}
+	}()
+
+	latencies := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for index := 0; index < b.N; index++ {
+		key := serializableKey(strconv.Itoa(rand.Intn(totalKeys)))
+		startTime := time.Now()
+		_, _ = kv.Get(key)
+		latencies[index] = time.Since(startTime)
+	}
+	b.StopTimer()
+
+	stop.Store(true)
+	<-merged
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+}
+
+// BenchmarkGetInto compares the allocations of Get and GetInto with a reused buffer.
+// Run with: go test -run=^$ -bench=BenchmarkGetInto -benchmem ./kv/
+func BenchmarkGetInto(b *testing.B) {
+	config := bitCaskConfig.NewConfig(b.TempDir(), 64*1024, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	totalKeys, value := 10_000, make([]byte, 128)
+	for count := 0; count < totalKeys; count++ {
+		_ = kv.Put(serializableKey(strconv.Itoa(count)), value)
+	}
+	keys := make([]serializableKey, totalKeys)
+	for count := 0; count < totalKeys; count++ {
+		keys[count] = serializableKey(strconv.Itoa(count))
+	}
+
+	b.Run("Get", func(b *testing.B) {
+		for index := 0; index < b.N; index++ {
+			_, _ = kv.Get(keys[index%totalKeys])
+		}
+	})
+	b.Run("GetInto", func(b *testing.B) {
+		dst := make([]byte, 0, len(value))
+		for index := 0; index < b.N; index++ {
+			dst, _ = kv.GetInto(keys[index%totalKeys], dst)
+		}
+	})
+}
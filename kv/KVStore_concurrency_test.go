@@ -2,6 +2,7 @@ package kv
 
 import (
 	bitCaskConfig "bitcask/config"
+	"context"
 	"reflect"
 	"strconv"
 	"sync"
@@ -73,3 +74,52 @@ func TestPutConcurrentlyAcrossManyGoroutines(t *testing.T) {
 		}
 	}
 }
+
+func TestPutConcurrentlyWithMerge(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 64, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	for count := 1; count <= 100; count++ {
+		countAsString := strconv.Itoa(count)
+		_ = kv.Put(serializableKey(countAsString), []byte(countAsString))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		kv.lock.RLock()
+		fileIds := kv.segments.InactiveSegmentIds()
+		kv.lock.RUnlock()
+
+		_, _ = kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+			return serializableKey(key)
+		}, unlimitedMergeThrottle{})
+	}()
+	go func() {
+		defer wg.Done()
+		for count := 1; count <= 100; count++ {
+			countAsString := strconv.Itoa(count)
+			_ = kv.Put(serializableKey(countAsString), []byte("updated-"+countAsString))
+		}
+	}()
+
+	wg.Wait()
+	kv.Sync()
+	kv.Shutdown()
+
+	kv, _ = NewKVStore[serializableKey](config)
+	for count := 1; count <= 100; count++ {
+		countAsString := strconv.Itoa(count)
+		value, _ := kv.SilentGet(serializableKey(countAsString))
+		if string(value) != "updated-"+countAsString {
+			t.Fatalf("Expected value to be %v for the key %v, received %v", "updated-"+countAsString, countAsString, string(value))
+		}
+	}
+}
@@ -3,8 +3,21 @@ package kv
 import (
 	bitCaskConfig "bitcask/config"
 	"bitcask/kv/log"
+	"bitcask/metrics"
+	"compress/flate"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPutAndDoASilentGet(t *testing.T) {
@@ -248,3 +261,1022 @@ func TestReload(t *testing.T) {
 		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
 	}
 }
+
+type unlimitedMergeThrottle struct{}
+
+func (throttle unlimitedMergeThrottle) Acquire(ctx context.Context, bytes int64) error {
+	return nil
+}
+
+func TestMergeSegmentsRetainsOnlyLiveEntries(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("topic", []byte("bitcask"))
+	_ = kv.Delete("disk")
+	_ = kv.Put("engine", []byte("bitcask"))
+
+	fileIds := kv.segments.InactiveSegmentIds()
+	response, _ := kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+	if response.SegmentsRead != len(fileIds) || response.EntriesDropped != 3 {
+		t.Fatalf("Expected %v segments to be read and %v entries to be dropped, received %v and %v", len(fileIds), 3, response.SegmentsRead, response.EntriesDropped)
+	}
+
+	value, _ := kv.SilentGet("topic")
+	if !reflect.DeepEqual([]byte("bitcask"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
+	}
+	_, exists := kv.SilentGet("disk")
+	if exists {
+		t.Fatalf("Expected %v to have been deleted but was found in the database", "disk")
+	}
+	for _, fileId := range fileIds {
+		if _, ok := kv.segments.AllInactiveSegments()[fileId]; ok {
+			t.Fatalf("Expected the merged segment %v to have been removed but was not", fileId)
+		}
+	}
+
+	_, contents, _ := kv.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	var keys []serializableKey
+	for _, entries := range contents {
+		for _, entry := range entries {
+			if entry.Key != "engine" {
+				keys = append(keys, entry.Key)
+			}
+		}
+	}
+	if !reflect.DeepEqual([]serializableKey{"topic"}, keys) {
+		t.Fatalf("Expected merged segments to contain only the live keys %v, received %v", []serializableKey{"topic"}, keys)
+	}
+}
+
+// failingMergeThrottle fails the first time it is acquired, like a merge which is cancelled after its first chunk
+type failingMergeThrottle struct{}
+
+func (throttle failingMergeThrottle) Acquire(ctx context.Context, bytes int64) error {
+	return context.Canceled
+}
+
+func TestMergeSegmentsCancelledInTheMiddleOfASegmentCountsTheBytesReadByTheChunk(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 256*1024, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	value := make([]byte, 1024)
+	for count := 0; count < 300; count++ {
+		_ = kv.Put(serializableKey("key-"+strconv.Itoa(count)), value)
+	}
+
+	fileIds := kv.segments.InactiveSegmentIds()
+	response, err := kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, failingMergeThrottle{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the merge to be cancelled, received %v", err)
+	}
+	if response.SegmentsRead != 0 || response.BytesWritten == 0 || response.BytesRead != response.BytesWritten {
+		t.Fatalf("Expected the bytes read by the first chunk to match the bytes written, received %v read and %v written", response.BytesRead, response.BytesWritten)
+	}
+}
+
+// shutdownMergeThrottle shuts the KVStore down the first time it is acquired, like a DB which is shut down while a merge is in progress
+type shutdownMergeThrottle struct {
+	kv *KVStore[serializableKey]
+}
+
+func (throttle shutdownMergeThrottle) Acquire(ctx context.Context, bytes int64) error {
+	throttle.kv.Shutdown()
+	return nil
+}
+
+func TestMergeSegmentsAfterShutdown(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("engine", []byte("bitcask"))
+
+	fileIds := kv.segments.InactiveSegmentIds()
+	_, err := kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, shutdownMergeThrottle{kv: kv})
+	if !errors.Is(err, ErrShutdown) {
+		t.Fatalf("Expected %v for a merge in progress during shutdown, received %v", ErrShutdown, err)
+	}
+	_, err = kv.MergeSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+	if !errors.Is(err, ErrShutdown) {
+		t.Fatalf("Expected %v for a merge after shutdown, received %v", ErrShutdown, err)
+	}
+	if _, err := kv.RolloverExpiredSegments(); !errors.Is(err, ErrShutdown) {
+		t.Fatalf("Expected %v for a rollover after shutdown, received %v", ErrShutdown, err)
+	}
+
+	kv, _ = NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	value, _ := kv.Get("topic")
+	if !reflect.DeepEqual([]byte("microservices"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+}
+
+func TestMergeBlobSegmentsRetainsOnlyLiveBlobEntries(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithBlobValueThreshold(8)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("solid state drive"))
+	_ = kv.Put("topic", []byte("distributed systems"))
+	_ = kv.Delete("disk")
+	_ = kv.Put("engine", []byte("bitcask storage"))
+
+	var fileIds []uint64
+	for _, stats := range kv.InactiveBlobSegmentStats() {
+		fileIds = append(fileIds, stats.FileId)
+	}
+	response, _ := kv.MergeBlobSegments(context.Background(), fileIds, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+	if response.SegmentsRead != 3 || response.SegmentsWritten != 1 || response.EntriesDropped != 2 {
+		t.Fatalf("Expected 3 blob segments to be read, 1 to be written and 2 entries to be dropped, received %v, %v and %v",
+			response.SegmentsRead, response.SegmentsWritten, response.EntriesDropped)
+	}
+
+	kv.Sync()
+	kv.Shutdown()
+	kv, _ = NewKVStore[serializableKey](config)
+
+	value, _ := kv.SilentGet("topic")
+	if !reflect.DeepEqual([]byte("distributed systems"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "distributed systems", string(value))
+	}
+	value, _ = kv.SilentGet("engine")
+	if !reflect.DeepEqual([]byte("bitcask storage"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask storage", string(value))
+	}
+	_, exists := kv.SilentGet("disk")
+	if exists {
+		t.Fatalf("Expected %v to have been deleted but was found in the database", "disk")
+	}
+	for _, stats := range kv.InactiveBlobSegmentStats() {
+		if stats.GarbageBytes() != 0 {
+			t.Fatalf("Expected the blob segment %v to have no garbage, received %v garbage bytes", stats.FileId, stats.GarbageBytes())
+		}
+	}
+}
+
+func TestCompressedValuesSurviveReloadAndMerge(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithCompressor(bitCaskConfig.NewFlateCompressor(flate.BestSpeed))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	value := []byte(strings.Repeat(`{"topic":"microservices"}`, 10))
+	_ = kv.Put("topic", value)
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("topic", value)
+
+	stats := kv.CompressionStats()
+	if stats.RawBytes != int64(2*len(value)+3) || stats.Ratio() <= 1 {
+		t.Fatalf("Expected %v raw bytes and a compression ratio greater than 1, received %v and %v", 2*len(value)+3, stats.RawBytes, stats.Ratio())
+	}
+
+	kv.Sync()
+	kv.Shutdown()
+	kv, _ = NewKVStore[serializableKey](bitCaskConfig.NewConfig(".", 8, 16, config.MergeConfig()))
+
+	_, _ = kv.MergeSegments(context.Background(), kv.segments.InactiveSegmentIds(), func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+
+	topicValue, _ := kv.SilentGet("topic")
+	if !reflect.DeepEqual(value, topicValue) {
+		t.Fatalf("Expected value to be %v, received %v", string(value), string(topicValue))
+	}
+	diskValue, _ := kv.SilentGet("disk")
+	if !reflect.DeepEqual([]byte("ssd"), diskValue) {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(diskValue))
+	}
+}
+
+func TestEncryptedValuesSurviveReloadAndMerge(t *testing.T) {
+	keyProvider := bitCaskConfig.NewInMemoryKeyProvider(1, []byte("0123456789abcdef"))
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithKeyProvider(keyProvider).WithBlobValueThreshold(16)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("solid state drive with a large value"))
+	keyProvider.Rotate(2, []byte("fedcba9876543210"))
+	_ = kv.Put("topic", []byte("distributed systems"))
+	_ = kv.Put("engine", []byte("bitcask"))
+
+	kv.Sync()
+	kv.Shutdown()
+	kv, _ = NewKVStore[serializableKey](config)
+
+	_, _ = kv.MergeSegments(context.Background(), kv.segments.InactiveSegmentIds(), func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+
+	for key, expected := range map[serializableKey]string{"topic": "distributed systems", "disk": "solid state drive with a large value", "engine": "bitcask"} {
+		value, _ := kv.SilentGet(key)
+		if string(value) != expected {
+			t.Fatalf("Expected value of %v to be %v, received %v", key, expected, string(value))
+		}
+	}
+	for _, stats := range kv.InactiveSegmentStats() {
+		if !stats.Encrypted {
+			t.Fatalf("Expected the inactive segment %v to be encrypted", stats.FileId)
+		}
+	}
+	if keyId, encrypted := kv.CurrentKeyId(); !encrypted || keyId != 2 {
+		t.Fatalf("Expected the current key id to be %v, received %v and %v", 2, keyId, encrypted)
+	}
+}
+
+func TestGetServesTheRecentlyReadValuesFromTheValueCache(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithValueCache(1024)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_, _ = kv.Get("topic")
+	_, _ = kv.Get("topic")
+
+	_ = kv.Put("topic", []byte("bitcask"))
+	value, _ := kv.Get("topic")
+	if string(value) != "bitcask" {
+		t.Fatalf("Expected the updated value to be %v, received %v", "bitcask", string(value))
+	}
+
+	stats := kv.ValueCacheStats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Fatalf("Expected 1 hit, 2 misses and 2 entries, received %v, %v and %v", stats.Hits, stats.Misses, stats.Entries)
+	}
+}
+
+func TestValueCacheStatsWithoutTheValueCache(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	if kv.ValueCacheStats() != nil {
+		t.Fatalf("Expected no ValueCacheStats without the value cache")
+	}
+}
+
+func TestMemoryMappedReadsSurviveMerge(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithMemoryMappedReads(true)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("topic", []byte("bitcask"))
+	_ = kv.Put("engine", []byte("storage"))
+
+	valueBeforeMerge, _ := kv.Get("disk")
+	_, _ = kv.MergeSegments(context.Background(), kv.segments.InactiveSegmentIds(), func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+
+	if string(valueBeforeMerge) != "ssd" {
+		t.Fatalf("Expected the value read before the merge to remain %v, received %v", "ssd", string(valueBeforeMerge))
+	}
+	for key, expected := range map[serializableKey]string{"topic": "bitcask", "disk": "ssd", "engine": "storage"} {
+		value, _ := kv.Get(key)
+		if string(value) != expected {
+			t.Fatalf("Expected value of %v to be %v, received %v", key, expected, string(value))
+		}
+	}
+}
+
+func TestGetIntoReusesTheBuffer(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+
+	dst := make([]byte, 0, 64)
+	value, _ := kv.GetInto("topic", dst)
+	if string(value) != "microservices" || &value[0] != &dst[:1][0] {
+		t.Fatalf("Expected value to be %v in the provided buffer, received %v", "microservices", string(value))
+	}
+	value, _ = kv.GetInto("disk", value)
+	if string(value) != "ssd" {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(value))
+	}
+	_, err := kv.GetInto("engine", dst)
+	if err == nil {
+		t.Fatalf("Expected an error while getting a non-existent key but received none")
+	}
+}
+
+func TestViewAValueAcrossSegmentsAndBlobs(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithBlobValueThreshold(8).WithMemoryMappedReads(true)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("engine", []byte("bitcask"))
+
+	for key, expected := range map[serializableKey]string{"topic": "microservices", "disk": "ssd", "engine": "bitcask"} {
+		var viewed string
+		err := kv.View(key, func(value []byte) error {
+			viewed = string(value)
+			return nil
+		})
+		if err != nil || viewed != expected {
+			t.Fatalf("Expected value of %v to be %v, received %v and %v", key, expected, viewed, err)
+		}
+	}
+}
+
+func TestViewReturnsTheErrorOfTheCallback(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	callbackErr := errors.New("callback failed")
+	err := kv.View("topic", func(value []byte) error {
+		return callbackErr
+	})
+	if err != callbackErr {
+		t.Fatalf("Expected the error of the callback, received %v", err)
+	}
+}
+
+func TestPutReaderAndGetReaderAcrossMerge(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	value := strings.Repeat("microservices", 100)
+	_ = kv.PutReader("topic", strings.NewReader(value), int64(len(value)))
+	_ = kv.Put("disk", []byte("ssd"))
+
+	reader, _ := kv.GetReader("topic")
+	defer reader.Close()
+
+	_, _ = kv.MergeSegments(context.Background(), kv.segments.InactiveSegmentIds(), func(key []byte) serializableKey {
+		return serializableKey(key)
+	}, unlimitedMergeThrottle{})
+
+	streamed, _ := io.ReadAll(reader)
+	if string(streamed) != value {
+		t.Fatalf("Expected the value read after the merge to be %v, received %v", value, string(streamed))
+	}
+	topicValue, _ := kv.Get("topic")
+	if string(topicValue) != value {
+		t.Fatalf("Expected value to be %v, received %v", value, string(topicValue))
+	}
+}
+
+func TestPutReaderWithAShortReader(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	err := kv.PutReader("topic", strings.NewReader("micro"), 13)
+	if err == nil {
+		t.Fatalf("Expected an error while putting from a short reader but received none")
+	}
+	if _, err := kv.GetReader("topic"); err == nil {
+		t.Fatalf("Expected the key to not exist after a failed PutReader")
+	}
+}
+
+func TestPutReaderWithEncryption(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithKeyProvider(bitCaskConfig.NewInMemoryKeyProvider(1, []byte("0123456789abcdef")))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	err := kv.PutReader("topic", strings.NewReader("microservices"), 13)
+	if !errors.Is(err, log.ErrEncryptedStream) {
+		t.Fatalf("Expected %v while streaming a value with encryption, received %v", log.ErrEncryptedStream, err)
+	}
+	if _, exists := kv.SilentGet("topic"); exists {
+		t.Fatalf("Expected the key to not exist after a failed PutReader")
+	}
+}
+
+// blockingReader provides its value only once it is released, like a stalled network reader
+type blockingReader struct {
+	released chan struct{}
+	reader   io.Reader
+}
+
+func (reader *blockingReader) Read(p []byte) (int, error) {
+	<-reader.released
+	return reader.reader.Read(p)
+}
+
+func TestPutReaderDoesNotBlockOtherOperationsWhileReading(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithBlobValueThreshold(8)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	for _, value := range []string{"ssd", strings.Repeat("microservices", 10)} {
+		reader := &blockingReader{released: make(chan struct{}), reader: strings.NewReader(value)}
+		putDone := make(chan error, 1)
+		go func() {
+			putDone <- kv.PutReader("topic", reader, int64(len(value)))
+		}()
+
+		operationsDone := make(chan struct{})
+		go func() {
+			_ = kv.Put("disk", []byte("ssd"))
+			_, _ = kv.Get("disk")
+			close(operationsDone)
+		}()
+		select {
+		case <-operationsDone:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected Put and Get to complete while PutReader waits for its reader")
+		}
+
+		close(reader.released)
+		if err := <-putDone; err != nil {
+			t.Fatalf("Expected PutReader to succeed, received %v", err)
+		}
+		streamed, _ := kv.Get("topic")
+		if string(streamed) != value {
+			t.Fatalf("Expected value to be %v, received %v", value, string(streamed))
+		}
+	}
+	if stagingFilePaths, _ := filepath.Glob("*_staging.data"); len(stagingFilePaths) != 0 {
+		t.Fatalf("Expected no staging file to remain, received %v", stagingFilePaths)
+	}
+}
+
+func TestReloadRemovesAStagingFileLeftBehindByACrash(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	_ = kv.Put("topic", []byte("microservices"))
+	kv.Sync()
+	kv.Shutdown()
+
+	_ = os.WriteFile("1_staging.data", []byte("partial"), 0644)
+
+	kv, err := NewKVStore[serializableKey](config)
+	if err != nil {
+		t.Fatalf("Expected the reload to ignore a staging file, received %v", err)
+	}
+	defer kv.ClearLog()
+
+	if _, err := os.Stat("1_staging.data"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the staging file to be removed on reload, received %v", err)
+	}
+	value, _ := kv.Get("topic")
+	if string(value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+}
+
+func TestMultiPutAndMultiGet(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.MultiPut([]KeyValuePair[serializableKey]{
+		{Key: "topic", Value: []byte("microservices")},
+		{Key: "disk", Value: []byte("ssd")},
+		{Key: "engine", Value: []byte("bitcask")},
+	})
+
+	results := kv.MultiGet([]serializableKey{"engine", "paper", "topic", "disk"})
+	expected := []string{"bitcask", "", "microservices", "ssd"}
+	for index, result := range results {
+		if index == 1 {
+			if result.Err == nil {
+				t.Fatalf("Expected an error for a non-existent key but received none")
+			}
+			continue
+		}
+		if result.Err != nil || string(result.Value) != expected[index] {
+			t.Fatalf("Expected value at %v to be %v, received %v and %v", index, expected[index], string(result.Value), result.Err)
+		}
+	}
+}
+
+func TestMultiGetReadsTheSegmentsInParallel(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithMultiGetParallelism(4).WithBlobValueThreshold(10)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	var keys []serializableKey
+	for count := 0; count < 50; count++ {
+		key := serializableKey("key-" + strconv.Itoa(count))
+		_ = kv.Put(key, []byte("value-of-"+string(key)))
+		keys = append(keys, key)
+	}
+
+	for index, result := range kv.MultiGet(keys) {
+		expected := "value-of-" + string(keys[index])
+		if result.Err != nil || string(result.Value) != expected {
+			t.Fatalf("Expected value of %v to be %v, received %v and %v", keys[index], expected, string(result.Value), result.Err)
+		}
+	}
+}
+
+func TestReloadInParallelReportsTheProgress(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	for count := 0; count < 20; count++ {
+		_ = kv.Put(serializableKey("key-"+strconv.Itoa(count%5)), []byte("value-"+strconv.Itoa(count)))
+	}
+	kv.Sync()
+	kv.Shutdown()
+
+	var progresses []bitCaskConfig.ReloadProgress
+	kv, _ = NewKVStore[serializableKey](config.WithReloadParallelism(4).WithReloadProgress(func(progress bitCaskConfig.ReloadProgress) {
+		progresses = append(progresses, progress)
+	}))
+
+	last := progresses[len(progresses)-1]
+	if len(progresses) != last.TotalSegments || !last.Done() || last.BytesReloaded != last.TotalBytes || last.TotalSegments < 20 {
+		t.Fatalf("Expected a progress for each of the %v segments, received %v progresses and %v", last.TotalSegments, len(progresses), last)
+	}
+	for count := 15; count < 20; count++ {
+		key := serializableKey("key-" + strconv.Itoa(count%5))
+		value, _ := kv.Get(key)
+		if string(value) != "value-"+strconv.Itoa(count) {
+			t.Fatalf("Expected the latest value of %v to be %v, received %v", key, "value-"+strconv.Itoa(count), string(value))
+		}
+	}
+}
+
+func TestReloadInParallelFailsOnceForACorruptSegmentInTheMiddle(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithKeyProvider(bitCaskConfig.NewInMemoryKeyProvider(1, []byte("0123456789abcdef")))
+	kv, _ := NewKVStore[serializableKey](config)
+	for count := 0; count < 20; count++ {
+		_ = kv.Put(serializableKey("key-"+strconv.Itoa(count)), []byte("value-"+strconv.Itoa(count)))
+	}
+	kv.Sync()
+	kv.Shutdown()
+
+	filePaths, _ := filepath.Glob("*_bitcask.data")
+	sort.Slice(filePaths, func(i, j int) bool {
+		first, _ := strconv.ParseUint(strings.Split(filePaths[i], "_")[0], 10, 64)
+		second, _ := strconv.ParseUint(strings.Split(filePaths[j], "_")[0], 10, 64)
+		return first < second
+	})
+	corruptFilePath := filePaths[len(filePaths)/2]
+	content, _ := os.ReadFile(corruptFilePath)
+	corruptContent := append([]byte(nil), content...)
+	corruptContent[len(corruptContent)-1] = corruptContent[len(corruptContent)-1] ^ 0xff
+	_ = os.WriteFile(corruptFilePath, corruptContent, 0644)
+
+	goroutines := runtime.NumGoroutine()
+	listener := &recordingEventListener{}
+	if _, err := NewKVStore[serializableKey](config.WithReloadParallelism(4).WithEventListener(listener)); err == nil {
+		t.Fatalf("Expected the reload of a corrupt segment to fail")
+	}
+	if len(listener.corruptions) != 1 || listener.corruptions[0].Err == nil {
+		t.Fatalf("Expected a single corruption to be notified, received %v", listener.corruptions)
+	}
+	for deadline := time.Now().Add(2 * time.Second); runtime.NumGoroutine() > goroutines; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the goroutines of the reload to exit, received %v goroutines instead of %v", runtime.NumGoroutine(), goroutines)
+		}
+	}
+
+	_ = os.WriteFile(corruptFilePath, content, 0644)
+	kv, _ = NewKVStore[serializableKey](config.WithEventListener(bitCaskConfig.NoOpEventListener{}))
+	defer kv.ClearLog()
+}
+
+func TestReloadDecodesAtMostReloadParallelismSegmentsConcurrently(t *testing.T) {
+	var decoding, maxDecoding atomic.Int32
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		current := decoding.Add(1)
+		defer decoding.Add(-1)
+		for {
+			previous := maxDecoding.Load()
+			if current <= previous || maxDecoding.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	for count := 0; count < 20; count++ {
+		_ = kv.Put(serializableKey("key-"+strconv.Itoa(count)), []byte("value-"+strconv.Itoa(count)))
+	}
+	kv.Sync()
+	kv.Shutdown()
+
+	maxDecoding.Store(0)
+	kv, _ = NewKVStore[serializableKey](config.WithReloadParallelism(2))
+	defer kv.ClearLog()
+
+	if maxDecoding.Load() < 1 || maxDecoding.Load() > 2 {
+		t.Fatalf("Expected at most %v segments to be decoded concurrently, received %v", 2, maxDecoding.Load())
+	}
+	value, _ := kv.Get("key-19")
+	if string(value) != "value-19" {
+		t.Fatalf("Expected value to be %v, received %v", "value-19", string(value))
+	}
+}
+
+func TestRestartsReuseTheActiveSegment(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 1024, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer func() {
+		kv.ClearLog()
+	}()
+
+	for restart := 0; restart < 3; restart++ {
+		_ = kv.Put(serializableKey("key-"+strconv.Itoa(restart)), []byte("value-"+strconv.Itoa(restart)))
+		kv.Sync()
+		kv.Shutdown()
+		kv, _ = NewKVStore[serializableKey](config)
+	}
+
+	if len(kv.segments.InactiveSegmentIds()) != 0 {
+		t.Fatalf("Expected no inactive segments after the restarts, received %v", len(kv.segments.InactiveSegmentIds()))
+	}
+	for restart := 0; restart < 3; restart++ {
+		value, _ := kv.Get(serializableKey("key-" + strconv.Itoa(restart)))
+		if string(value) != "value-"+strconv.Itoa(restart) {
+			t.Fatalf("Expected value to be %v, received %v", "value-"+strconv.Itoa(restart), string(value))
+		}
+	}
+}
+
+func TestPutFailsForAValueLargerThanTheMaxValueSize(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithMaxKeySize(8).WithMaxValueSize(8)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	if err := kv.Put("topic", []byte("microservices")); !errors.Is(err, log.ErrValueTooLarge) {
+		t.Fatalf("Expected ErrValueTooLarge, received %v", err)
+	}
+	if err := kv.Put("distributed", []byte("ssd")); !errors.Is(err, log.ErrKeyTooLarge) {
+		t.Fatalf("Expected ErrKeyTooLarge, received %v", err)
+	}
+	if _, err := kv.Get("topic"); err == nil {
+		t.Fatalf("Expected the key %v to be absent after a failed put", "topic")
+	}
+}
+
+func TestNewKVStoreFailsWithoutAKeyMapper(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig[serializableKey](2, nil))
+	if _, err := NewKVStore[serializableKey](config); err == nil {
+		t.Fatalf("Expected an error for a key type which is not deserializable and no keyMapper")
+	}
+}
+
+func TestIterateVisitsTheKeysPresentAtTheStart(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 32, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("engine", []byte("bitcask"))
+
+	values := make(map[serializableKey]string)
+	err := kv.Iterate(func(key serializableKey, value []byte) error {
+		values[key] = string(value)
+		for _, other := range []serializableKey{"topic", "disk", "engine"} {
+			if other != key {
+				_ = kv.Delete(other)
+			}
+		}
+		_ = kv.Put("paper", []byte("riak"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 {
+		t.Fatalf("Expected the keys deleted during the iteration to be skipped, received %v", values)
+	}
+	if _, ok := values["paper"]; ok {
+		t.Fatalf("Expected the key put during the iteration not to be visited")
+	}
+}
+
+func TestStats(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	users, _ := kv.CreateBucket("users")
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("topic", []byte("bitcask"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Delete("disk")
+	_ = users.Put("topic", []byte("storage"))
+	_, _ = kv.Get("topic")
+	_, _ = kv.Get("disk")
+	_ = kv.MultiGet([]serializableKey{"topic", "engine"})
+
+	stats := kv.Stats()
+	if stats.Keys != 2 {
+		t.Fatalf("Expected %v keys, received %v", 2, stats.Keys)
+	}
+	if stats.InactiveSegments != 4 || len(stats.Segments) != 4 {
+		t.Fatalf("Expected %v inactive segments, received %v and %v", 4, stats.InactiveSegments, len(stats.Segments))
+	}
+	if stats.ActiveSegmentFileId != kv.segments.ActiveSegment().FileId() || stats.ActiveSegmentBytes == 0 {
+		t.Fatalf("Expected the active segment %v to have a non-zero size, received %v with %v bytes", kv.segments.ActiveSegment().FileId(), stats.ActiveSegmentFileId, stats.ActiveSegmentBytes)
+	}
+	if stats.Tombstones != 1 {
+		t.Fatalf("Expected %v tombstone, received %v", 1, stats.Tombstones)
+	}
+	topic, _ := kv.keyDirectory.Get("topic")
+	userTopic, _ := kv.bucketDirectories[users.id].Get("topic")
+	if stats.LiveBytes != int64(topic.EntryLength+userTopic.EntryLength) || stats.DeadBytes != stats.TotalBytes-stats.LiveBytes || stats.DeadBytes <= 0 {
+		t.Fatalf("Expected %v live bytes and some dead bytes out of %v, received %v live and %v dead bytes",
+			topic.EntryLength+userTopic.EntryLength, stats.TotalBytes, stats.LiveBytes, stats.DeadBytes)
+	}
+	expectedOperations := OperationStats{Puts: 4, Gets: 4, Deletes: 1}
+	if stats.Operations != expectedOperations {
+		t.Fatalf("Expected the operations to be %v, received %v", expectedOperations, stats.Operations)
+	}
+
+	kv.Sync()
+	kv.Shutdown()
+
+	kv, _ = NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	stats = kv.Stats()
+	if stats.Keys != 2 || stats.Tombstones != 1 {
+		t.Fatalf("Expected %v keys and %v tombstone after reload, received %v and %v", 2, 1, stats.Keys, stats.Tombstones)
+	}
+	if stats.Operations != (OperationStats{}) {
+		t.Fatalf("Expected no operations after reload, received %v", stats.Operations)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	storeMetrics := metrics.NewMetrics()
+	config := bitCaskConfig.NewConfig(".", 64, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithMetrics(storeMetrics)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("solid state drive"))
+	_ = kv.Put("engine", []byte("bitcask"))
+	_ = kv.Delete("disk")
+	_, _ = kv.Get("topic")
+	_, _ = kv.Get("disk")
+
+	topic, _ := kv.keyDirectory.Get("topic")
+	stats := kv.Stats()
+	if stats.InactiveSegments == 0 {
+		t.Fatalf("Expected the puts to roll over the active segment, received %v inactive segments", stats.InactiveSegments)
+	}
+
+	builder := &strings.Builder{}
+	_ = kv.Metrics().Write(builder)
+	written := builder.String()
+	for _, expected := range []string{
+		`bitcask_operation_duration_seconds_count{operation="put"} 3` + "\n",
+		`bitcask_operation_duration_seconds_count{operation="get"} 2` + "\n",
+		`bitcask_operation_duration_seconds_count{operation="delete"} 1` + "\n",
+		`bitcask_lock_wait_seconds_count{lock="read"} 2` + "\n",
+		`bitcask_lock_wait_seconds_count{lock="write"} 4` + "\n",
+		"bitcask_written_bytes_total " + strconv.FormatInt(stats.TotalBytes, 10) + "\n",
+		"bitcask_read_bytes_total " + strconv.Itoa(int(topic.EntryLength)) + "\n",
+		"bitcask_segment_rollovers_total " + strconv.Itoa(stats.InactiveSegments) + "\n",
+	} {
+		if !strings.Contains(written, expected) {
+			t.Fatalf("Expected the metrics to contain %q, received\n%v", expected, written)
+		}
+	}
+}
+
+type recordingEventListener struct {
+	bitCaskConfig.NoOpEventListener
+	rollovers   []bitCaskConfig.SegmentRolloverEvent
+	removals    []bitCaskConfig.SegmentRemovalEvent
+	progress    []bitCaskConfig.ReloadProgress
+	corruptions []bitCaskConfig.CorruptionEvent
+}
+
+func (listener *recordingEventListener) SegmentRolledOver(event bitCaskConfig.SegmentRolloverEvent) {
+	listener.rollovers = append(listener.rollovers, event)
+}
+
+func (listener *recordingEventListener) SegmentRemoved(event bitCaskConfig.SegmentRemovalEvent) {
+	listener.removals = append(listener.removals, event)
+}
+
+func (listener *recordingEventListener) ReloadProgressed(progress bitCaskConfig.ReloadProgress) {
+	listener.progress = append(listener.progress, progress)
+}
+
+func (listener *recordingEventListener) CorruptionDetected(event bitCaskConfig.CorruptionEvent) {
+	listener.corruptions = append(listener.corruptions, event)
+}
+
+func TestEventListenerIsNotifiedOfRolloversAndReloadProgress(t *testing.T) {
+	listener := &recordingEventListener{}
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithEventListener(listener)
+	kv, _ := NewKVStore[serializableKey](config)
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+	_ = kv.Put("engine", []byte("bitcask"))
+
+	inactiveSegmentIds := kv.segments.InactiveSegmentIds()
+	if len(listener.rollovers) != len(inactiveSegmentIds) {
+		t.Fatalf("Expected %v rollovers, received %v", len(inactiveSegmentIds), len(listener.rollovers))
+	}
+	for _, rollover := range listener.rollovers {
+		if rollover.SizeInBytes == 0 || rollover.Blob {
+			t.Fatalf("Expected a rollover of a non-empty segment, received %v", rollover)
+		}
+	}
+
+	kv.Sync()
+	kv.Shutdown()
+
+	listener = &recordingEventListener{}
+	kv, _ = NewKVStore[serializableKey](config.WithEventListener(listener))
+	defer kv.ClearLog()
+
+	if len(listener.progress) == 0 || !listener.progress[len(listener.progress)-1].Done() {
+		t.Fatalf("Expected the reload progress to be notified until the reload is done, received %v", listener.progress)
+	}
+	if len(listener.corruptions) != 0 {
+		t.Fatalf("Expected no corruption, received %v", listener.corruptions)
+	}
+}
+
+func TestEventListenerIsNotifiedOfACorruptSegment(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithKeyProvider(bitCaskConfig.NewInMemoryKeyProvider(1, []byte("0123456789abcdef")))
+	kv, _ := NewKVStore[serializableKey](config)
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+
+	kv.Sync()
+	kv.Shutdown()
+
+	filePaths, _ := filepath.Glob("*_bitcask.data")
+	corruptFilePath := filePaths[0]
+	content, _ := os.ReadFile(corruptFilePath)
+	corruptContent := append([]byte(nil), content...)
+	corruptContent[len(corruptContent)-1] = corruptContent[len(corruptContent)-1] ^ 0xff
+	_ = os.WriteFile(corruptFilePath, corruptContent, 0644)
+
+	listener := &recordingEventListener{}
+	if _, err := NewKVStore[serializableKey](config.WithEventListener(listener)); err == nil {
+		t.Fatalf("Expected the reload of a corrupt segment to fail")
+	}
+	if len(listener.corruptions) != 1 || listener.corruptions[0].Err == nil {
+		t.Fatalf("Expected a corruption to be notified, received %v", listener.corruptions)
+	}
+
+	_ = os.WriteFile(corruptFilePath, content, 0644)
+	kv, _ = NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+}
+
+func TestReloadFailsForAKeyWhoseSizeDiffersFromTheKeyType(t *testing.T) {
+	stringKeyConfig := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](stringKeyConfig)
+	_ = kv.Put("topic", []byte("microservices"))
+	kv.Sync()
+	kv.Shutdown()
+
+	listener := &recordingEventListener{}
+	config := bitCaskConfig.NewConfig[bitCaskConfig.Uint64Key](".", 8, 16, bitCaskConfig.NewMergeConfig[bitCaskConfig.Uint64Key](2, nil))
+	_, err := NewKVStore[bitCaskConfig.Uint64Key](config.WithEventListener(listener))
+	if !errors.Is(err, bitCaskConfig.ErrInvalidKeySize) {
+		t.Fatalf("Expected the reload to fail with ErrInvalidKeySize, received %v", err)
+	}
+	var corruptSegmentError *log.CorruptSegmentError
+	if !errors.As(err, &corruptSegmentError) {
+		t.Fatalf("Expected a CorruptSegmentError, received %v", err)
+	}
+	if len(listener.corruptions) != 1 || !errors.Is(listener.corruptions[0].Err, bitCaskConfig.ErrInvalidKeySize) {
+		t.Fatalf("Expected a corruption to be notified, received %v", listener.corruptions)
+	}
+
+	kv, _ = NewKVStore[serializableKey](stringKeyConfig)
+	defer kv.ClearLog()
+}
+
+func TestEventListenerIsNotifiedOfATruncatedPlainSegment(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	kv, _ := NewKVStore[serializableKey](config)
+	_ = kv.Put("topic", []byte("microservices"))
+	_ = kv.Put("disk", []byte("ssd"))
+
+	kv.Sync()
+	kv.Shutdown()
+
+	filePaths, _ := filepath.Glob("*_bitcask.data")
+	truncatedFilePath := filePaths[0]
+	content, _ := os.ReadFile(truncatedFilePath)
+	_ = os.Truncate(truncatedFilePath, int64(len(content)-10))
+
+	listener := &recordingEventListener{}
+	kv, err := NewKVStore[serializableKey](config.WithEventListener(listener))
+	if err != nil {
+		t.Fatalf("Expected the partial entry of a truncated segment to be truncated on reload, received %v", err)
+	}
+	defer kv.ClearLog()
+
+	if len(listener.corruptions) != 1 || !errors.Is(listener.corruptions[0].Err, log.ErrTruncatedEntry) {
+		t.Fatalf("Expected a corruption to be notified, received %v", listener.corruptions)
+	}
+	if _, exists := kv.SilentGet("topic"); exists {
+		t.Fatalf("Expected the partial entry of %v to be dropped", "topic")
+	}
+	value, _ := kv.Get("disk")
+	if !reflect.DeepEqual([]byte("ssd"), value) {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(value))
+	}
+}
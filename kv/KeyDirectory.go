@@ -8,8 +8,13 @@ import (
 // KeyDirectory is the in-memory storage which maintains a mapping between keys and the position of those keys in the datafiles called segment.
 // Entry maintains `FileId` identifying the file containing the key, `Offset` identifying the position in the file where the key is stored and
 // the `EntryLength` identifying the length of the entry
+// KeyDirectory also maintains the live bytes of every segment file: the sum of the entry lengths of all the keys pointing to that file.
+// Whatever is not live in a segment file is garbage which can be reclaimed by merge.
+// Similarly, it maintains the live bytes of every blob segment file: the sum of the blob entry lengths of all the keys whose Entry refers to that blob file.
 type KeyDirectory[Key config.BitCaskKey] struct {
-	entryByKey map[Key]*Entry
+	entryByKey            map[Key]*Entry
+	liveBytesByFileId     map[uint64]int64
+	liveBlobBytesByFileId map[uint64]int64
 }
 
 // NewKeyDirectory Creates a new instance of KeyDirectory
@@ -33,7 +38,9 @@ type KeyDirectory[Key config.BitCaskKey] struct {
 // it makes sense to replace a generically typed HashMap with an alternative data structure that will store key as a byte slice.
 func NewKeyDirectory[Key config.BitCaskKey](initialCapacity uint64) *KeyDirectory[Key] {
 	return &KeyDirectory[Key]{
-		entryByKey: make(map[Key]*Entry, initialCapacity),
+		entryByKey:            make(map[Key]*Entry, initialCapacity),
+		liveBytesByFileId:     make(map[uint64]int64),
+		liveBlobBytesByFileId: make(map[uint64]int64),
 	}
 }
 
@@ -41,29 +48,135 @@ func NewKeyDirectory[Key config.BitCaskKey](initialCapacity uint64) *KeyDirector
 // and the keys from all the inactive segments are stored in the KeyDirectory.
 // Riak's paper optimizes reloading by creating small sized hint files during merge and compaction.
 // Hint files contain the keys and the metadata fields like fileId, fileOffset and entryLength, these hint files are referred during reload. This implementation does not create Hint file
+// Reload must be called in the increasing order of fileIds, so that a later entry (or a later deletion) of a key wins over the earlier one.
 func (keyDirectory *KeyDirectory[Key]) Reload(fileId uint64, entries []*log.MappedStoredEntry[Key]) {
 	for _, entry := range entries {
-		keyDirectory.entryByKey[entry.Key] = NewEntry(fileId, int64(entry.KeyOffset), entry.EntryLength)
+		if entry.Deleted {
+			keyDirectory.Delete(entry.Key)
+		} else {
+			keyDirectory.Put(entry.Key, NewEntryWithBlob(fileId, int64(entry.KeyOffset), entry.EntryLength, entry.Blob))
+		}
 	}
 }
 
 // Put puts a key and its entry as the value in the KeyDirectory
 func (keyDirectory *KeyDirectory[Key]) Put(key Key, value *Entry) {
+	keyDirectory.release(key)
 	keyDirectory.entryByKey[key] = value
+	keyDirectory.liveBytesByFileId[value.FileId] += int64(value.EntryLength)
+	if value.Blob != nil {
+		keyDirectory.liveBlobBytesByFileId[value.Blob.FileId] += int64(value.Blob.EntryLength)
+	}
 }
 
 // BulkUpdate performs bulk changes to the KeyDirectory state. This method is called during merge and compaction from KeyStore.
 func (keyDirectory *KeyDirectory[Key]) BulkUpdate(changes []*log.WriteBackResponse[Key]) {
 	for _, change := range changes {
-		keyDirectory.entryByKey[change.Key] = NewEntryFrom(change.AppendEntryResponse)
+		keyDirectory.Put(change.Key, NewEntryFrom(change.AppendEntryResponse))
 	}
 }
 
 // Delete removes the key from the KeyDirectory
 func (keyDirectory *KeyDirectory[Key]) Delete(key Key) {
+	keyDirectory.release(key)
 	delete(keyDirectory.entryByKey, key)
 }
 
+// PointsTo returns true if the key is present in the KeyDirectory and its Entry points to exactly the fileId and the offset.
+// This is the liveness rule used by merge: an entry in a segment file is live only if the KeyDirectory still points to it,
+// any other entry of the key in a segment file is either an older value or a deleted value.
+func (keyDirectory *KeyDirectory[Key]) PointsTo(key Key, fileId uint64, offset int64) bool {
+	entry, ok := keyDirectory.entryByKey[key]
+	return ok && entry.FileId == fileId && entry.Offset == offset
+}
+
+// PointsToBlob returns true if the key is present in the KeyDirectory and its Entry refers to exactly the blob fileId and the offset.
+// This is the liveness rule used by the garbage collection of blob segments.
+func (keyDirectory *KeyDirectory[Key]) PointsToBlob(key Key, blobFileId uint64, offset int64) bool {
+	entry, ok := keyDirectory.entryByKey[key]
+	return ok && entry.Blob != nil && entry.Blob.FileId == blobFileId && entry.Blob.Offset == offset
+}
+
+// CompareAndPut puts the key and its entry only if the current Entry of the key points to the same fileId and offset as the `expected` Entry,
+// or if both the `expected` Entry is nil and the key is absent. It returns true if the entry was put.
+// This is used by merge which writes the entries to new segments without holding the lock of KVStore, and must not override a Put or a Delete
+// of the key performed in the meantime.
+func (keyDirectory *KeyDirectory[Key]) CompareAndPut(key Key, expected *Entry, value *Entry) bool {
+	current, ok := keyDirectory.entryByKey[key]
+	if expected == nil && ok {
+		return false
+	}
+	if expected != nil && (!ok || current.FileId != expected.FileId || current.Offset != expected.Offset) {
+		return false
+	}
+	keyDirectory.Put(key, value)
+	return true
+}
+
+// Contains returns true if the key is present in the KeyDirectory
+func (keyDirectory *KeyDirectory[Key]) Contains(key Key) bool {
+	_, ok := keyDirectory.entryByKey[key]
+	return ok
+}
+
+// LiveBytes returns the sum of the entry lengths of all the keys that point to the segment file identified by fileId
+func (keyDirectory *KeyDirectory[Key]) LiveBytes(fileId uint64) int64 {
+	return keyDirectory.liveBytesByFileId[fileId]
+}
+
+// LiveBlobBytes returns the sum of the blob entry lengths of all the keys that refer to the blob segment file identified by fileId
+func (keyDirectory *KeyDirectory[Key]) LiveBlobBytes(fileId uint64) int64 {
+	return keyDirectory.liveBlobBytesByFileId[fileId]
+}
+
+// Len returns the number of keys present in the KeyDirectory
+func (keyDirectory *KeyDirectory[Key]) Len() int {
+	return len(keyDirectory.entryByKey)
+}
+
+// TotalLiveBytes returns the live bytes across all the segment files, and the live bytes across all the blob segment files
+func (keyDirectory *KeyDirectory[Key]) TotalLiveBytes() (int64, int64) {
+	var liveBytes, liveBlobBytes int64
+	for _, bytes := range keyDirectory.liveBytesByFileId {
+		liveBytes = liveBytes + bytes
+	}
+	for _, bytes := range keyDirectory.liveBlobBytesByFileId {
+		liveBlobBytes = liveBlobBytes + bytes
+	}
+	return liveBytes, liveBlobBytes
+}
+
+// release reduces the live bytes of the segment file (and the blob segment file) that the existing entry of the key points to
+func (keyDirectory *KeyDirectory[Key]) release(key Key) {
+	existing, ok := keyDirectory.entryByKey[key]
+	if !ok {
+		return
+	}
+	reduceLiveBytes(keyDirectory.liveBytesByFileId, existing.FileId, int64(existing.EntryLength))
+	if existing.Blob != nil {
+		reduceLiveBytes(keyDirectory.liveBlobBytesByFileId, existing.Blob.FileId, int64(existing.Blob.EntryLength))
+	}
+}
+
+// reduceLiveBytes reduces the live bytes of the file identified by fileId, and removes the file from liveBytesByFileId once no bytes are live
+func reduceLiveBytes(liveBytesByFileId map[uint64]int64, fileId uint64, bytes int64) {
+	liveBytes := liveBytesByFileId[fileId] - bytes
+	if liveBytes <= 0 {
+		delete(liveBytesByFileId, fileId)
+	} else {
+		liveBytesByFileId[fileId] = liveBytes
+	}
+}
+
+// Keys returns all the keys present in the KeyDirectory, in no particular order
+func (keyDirectory *KeyDirectory[Key]) Keys() []Key {
+	keys := make([]Key, 0, len(keyDirectory.entryByKey))
+	for key := range keyDirectory.entryByKey {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 // Get returns the Entry and a boolean to indicate if the value corresponding to the key is present in the KeyDirectory.
 // Get returns nil, false if the value corresponding to the key is not present
 // Get returns a pointer to an Entry, true if the value corresponding to the key is present
@@ -77,3 +77,33 @@ func TestBulkUpdatesKeys(t *testing.T) {
 		t.Fatalf("Expected %v, received %v from key directory", NewEntry(20, 40, 46), entry)
 	}
 }
+
+func TestMaintainsLiveBytesOfSegments(t *testing.T) {
+	keyDirectory := NewKeyDirectory[serializableKey](16)
+	keyDirectory.Put("topic", NewEntry(1, 0, 20))
+	keyDirectory.Put("disk", NewEntry(1, 20, 30))
+	keyDirectory.Put("topic", NewEntry(2, 0, 25))
+
+	if keyDirectory.LiveBytes(1) != 30 {
+		t.Fatalf("Expected live bytes of file %v to be %v, received %v", 1, 30, keyDirectory.LiveBytes(1))
+	}
+	if keyDirectory.LiveBytes(2) != 25 {
+		t.Fatalf("Expected live bytes of file %v to be %v, received %v", 2, 25, keyDirectory.LiveBytes(2))
+	}
+
+	keyDirectory.Delete("disk")
+	if keyDirectory.LiveBytes(1) != 0 {
+		t.Fatalf("Expected live bytes of file %v to be %v, received %v", 1, 0, keyDirectory.LiveBytes(1))
+	}
+}
+
+func TestReloadsADeletedKey(t *testing.T) {
+	keyDirectory := NewKeyDirectory[serializableKey](16)
+	keyDirectory.Reload(1, []*log2.MappedStoredEntry[serializableKey]{{Key: "topic", KeyOffset: 0, EntryLength: 20}})
+	keyDirectory.Reload(2, []*log2.MappedStoredEntry[serializableKey]{{Key: "topic", Deleted: true, KeyOffset: 0, EntryLength: 18}})
+
+	_, ok := keyDirectory.Get("topic")
+	if ok {
+		t.Fatalf("Expected the key %v to have been deleted but was not", "topic")
+	}
+}
@@ -0,0 +1,28 @@
+package kv
+
+import "sync/atomic"
+
+// OperationStats counts the operations performed since the KVStore was created, across all the buckets.
+// Puts and Deletes count the successful writes (every pair of MultiPut is a put), whereas Gets counts every read of a key, including the reads of the keys which do not exist
+// (every key of MultiGet is a get). The reads performed by Iterate are not counted.
+type OperationStats struct {
+	Puts    int64
+	Gets    int64
+	Deletes int64
+}
+
+// operationCounters are the counters behind OperationStats. They are atomic because the reads are counted with only the read lock of KVStore held
+type operationCounters struct {
+	puts    atomic.Int64
+	gets    atomic.Int64
+	deletes atomic.Int64
+}
+
+// snapshot returns the OperationStats of the current counts
+func (counters *operationCounters) snapshot() OperationStats {
+	return OperationStats{
+		Puts:    counters.puts.Load(),
+		Gets:    counters.gets.Load(),
+		Deletes: counters.deletes.Load(),
+	}
+}
@@ -0,0 +1,51 @@
+package kv
+
+import (
+	"bitcask/config"
+	"time"
+)
+
+// minRolloverCheckInterval is the minimum duration between two checks of the RolloverWorker
+const minRolloverCheckInterval = 10 * time.Millisecond
+
+// RolloverWorker encapsulates the goroutine that rolls over the expired active segment of KVStore. A write rolls over the active segment once it has expired,
+// but under a low write volume no write may follow for a long time, and the RolloverWorker closes such a segment so that it becomes eligible for merge and backup.
+// The RolloverWorker checks the age of the active segment every tenth of the max segment age, so a segment is rolled over at most 10% later than its max age.
+type RolloverWorker[Key config.BitCaskKey] struct {
+	kvStore *KVStore[Key]
+	quit    chan struct{}
+}
+
+// NewRolloverWorker creates an instance of RolloverWorker that rolls over the active segment of KVStore older than maxSegmentAge, and starts the RolloverWorker
+func NewRolloverWorker[Key config.BitCaskKey](kvStore *KVStore[Key], maxSegmentAge time.Duration) *RolloverWorker[Key] {
+	worker := &RolloverWorker[Key]{
+		kvStore: kvStore,
+		quit:    make(chan struct{}),
+	}
+	worker.start(maxSegmentAge / 10)
+	return worker
+}
+
+// start spins a goroutine that rolls over the expired segments every checkInterval. A failed rollover is retried on the next check
+func (worker *RolloverWorker[Key]) start(checkInterval time.Duration) {
+	if checkInterval < minRolloverCheckInterval {
+		checkInterval = minRolloverCheckInterval
+	}
+	ticker := time.NewTicker(checkInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = worker.kvStore.RolloverExpiredSegments()
+			case <-worker.quit:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop closes the quit channel which is used to signal the rollover goroutine to stop
+func (worker *RolloverWorker[Key]) Stop() {
+	close(worker.quit)
+}
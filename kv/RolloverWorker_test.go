@@ -0,0 +1,32 @@
+package kv
+
+import (
+	bitCaskConfig "bitcask/config"
+	"testing"
+	"time"
+)
+
+func TestRolloverWorkerRollsOverTheExpiredActiveSegment(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 1024, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithMaxSegmentAge(50 * time.Millisecond)
+	kv, _ := NewKVStore[serializableKey](config)
+	defer kv.ClearLog()
+
+	worker := NewRolloverWorker[serializableKey](kv, config.MaxSegmentAge())
+	defer worker.Stop()
+
+	_ = kv.Put("topic", []byte("microservices"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(kv.InactiveSegmentStats()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(kv.InactiveSegmentStats()) != 1 {
+		t.Fatalf("Expected the active segment to be rolled over without a write, received %v inactive segments", len(kv.InactiveSegmentStats()))
+	}
+	value, _ := kv.Get("topic")
+	if string(value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+}
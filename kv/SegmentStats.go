@@ -0,0 +1,23 @@
+package kv
+
+// SegmentStats describes an inactive segment file for the purpose of merge.
+// TotalBytes is the size of the segment file and LiveBytes is the sum of the entry lengths of all the keys in the KeyDirectory that point to this file.
+// The difference between the two is the garbage (updated or deleted entries) that a merge of this segment would reclaim.
+// Encrypted is true if the segment file is encrypted, and KeyId identifies the key that encrypts it.
+// Tombstones is the number of deleted entries in the segment file, it is always 0 for a blob segment file.
+type SegmentStats struct {
+	FileId     uint64
+	TotalBytes int64
+	LiveBytes  int64
+	KeyId      uint32
+	Encrypted  bool
+	Tombstones int64
+}
+
+// GarbageBytes returns the bytes in the segment that are not pointed to by the KeyDirectory
+func (stats *SegmentStats) GarbageBytes() int64 {
+	if stats.LiveBytes >= stats.TotalBytes {
+		return 0
+	}
+	return stats.TotalBytes - stats.LiveBytes
+}
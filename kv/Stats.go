@@ -0,0 +1,18 @@
+package kv
+
+// Stats describes the size of a KVStore, computed from the in-memory state of Segments and the KeyDirectories without reading the segment files.
+// Keys is the number of keys across all the buckets. Segments describes the inactive segments in the increasing order of their fileIds, whereas
+// TotalBytes, LiveBytes and DeadBytes add up the inactive segments and the active segment. Tombstones is the number of deleted entries in the segments,
+// which are reclaimed by the merge. The blob segments are not included, refer to KVStore.InactiveBlobSegmentStats.
+type Stats struct {
+	Keys                int
+	ActiveSegmentFileId uint64
+	ActiveSegmentBytes  int64
+	InactiveSegments    int
+	Segments            []*SegmentStats
+	TotalBytes          int64
+	LiveBytes           int64
+	DeadBytes           int64
+	Tombstones          int64
+	Operations          OperationStats
+}
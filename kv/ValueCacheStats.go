@@ -0,0 +1,19 @@
+package kv
+
+// ValueCacheStats describes the cache of the recently read values since the KVStore was created.
+// Hits and Misses count the Get (and SilentGet) operations served from the cache and from the segment files respectively.
+// Entries is the number of cached entries and SizeBytes is the size of their keys and values.
+type ValueCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Entries   int
+	SizeBytes uint64
+}
+
+// HitRatio returns Hits / (Hits + Misses), 0 if no value has been read
+func (stats *ValueCacheStats) HitRatio() float64 {
+	if stats.Hits+stats.Misses == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+}
@@ -0,0 +1,45 @@
+package log
+
+import "unsafe"
+
+var reservedBlobFileIdSize, reservedBlobOffsetSize = uint32(unsafe.Sizeof(uint64(0))), uint32(unsafe.Sizeof(int64(0)))
+var reservedBlobEntryLengthSize = uint32(unsafe.Sizeof(uint32(0)))
+var blobReferenceSize = reservedBlobFileIdSize + reservedBlobOffsetSize + reservedBlobEntryLengthSize
+
+// BlobReference identifies a value that is stored in a blob segment file: FileId identifies the blob segment, Offset identifies the position of the blob entry
+// in the blob segment and EntryLength identifies the length of the blob entry.
+// With key-value separation, a value larger than the blob value threshold is appended to the active blob segment, and the segment stores only
+// the encoded BlobReference in place of the value. So, the merge of segments rewrites only the references and never the large values.
+// Encoding scheme consists of the following structure:
+//
+//	┌─────────┬────────┬──────────────┐
+//	│ file_id │ offset │ entry_length │
+//	└─────────┴────────┴──────────────┘
+//
+// file_id and offset consist of 64 bits each, and entry_length consists of 32 bits.
+type BlobReference struct {
+	FileId      uint64
+	Offset      int64
+	EntryLength uint32
+}
+
+// encode converts the BlobReference to a byte slice which is stored as the value of an entry in the segment
+func (reference *BlobReference) encode() []byte {
+	encoded := make([]byte, blobReferenceSize)
+	littleEndian.PutUint64(encoded, reference.FileId)
+	littleEndian.PutUint64(encoded[reservedBlobFileIdSize:], uint64(reference.Offset))
+	littleEndian.PutUint32(encoded[reservedBlobFileIdSize+reservedBlobOffsetSize:], reference.EntryLength)
+	return encoded
+}
+
+// decodeBlobReferenceIfMarked decodes the value as a BlobReference if the tombstone byte carries the blobReferenceMarker, else it returns nil
+func decodeBlobReferenceIfMarked(value []byte, tombstone byte) *BlobReference {
+	if tombstone&blobReferenceMarker != blobReferenceMarker || uint32(len(value)) != blobReferenceSize {
+		return nil
+	}
+	return &BlobReference{
+		FileId:      littleEndian.Uint64(value),
+		Offset:      int64(littleEndian.Uint64(value[reservedBlobFileIdSize:])),
+		EntryLength: littleEndian.Uint32(value[reservedBlobFileIdSize+reservedBlobOffsetSize:]),
+	}
+}
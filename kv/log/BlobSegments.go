@@ -0,0 +1,374 @@
+package log
+
+import (
+	"bitcask/clock"
+	"bitcask/config"
+	"bitcask/kv/log/id"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BlobSegments is an abstraction that manages the active blob segment and K inactive blob segments. Blob segments implement key-value separation:
+// a value larger than the blob value threshold is appended to the active blob segment, and the segment stores only a BlobReference to it.
+// A blob entry has the same encoding as an entry in the segment (refer to Entry.go), so a blob segment can be iterated like a segment during garbage collection.
+// The active blob segment is created lazily on the first append, so no blob segment file is created if no value is larger than the threshold.
+// Blob segments are garbage collected independently of the segments, a blob entry is live only if the KeyDirectory points to a BlobReference to it.
+// A value threshold of 0 disables key-value separation for new values, the existing blob segments are still reloaded and read.
+type BlobSegments[Key config.BitCaskKey] struct {
+	activeSegment       *Segment[Key]
+	inactiveSegments    map[uint64]*Segment[Key]
+	fileIdGenerator     *id.TimestampBasedFileIdGenerator
+	clock               clock.Clock
+	maxSegmentSizeBytes uint64
+	valueThresholdBytes uint64
+	directory           string
+	compressor          config.Compressor
+	keyProvider         config.KeyProvider
+	memoryMappedReads   bool
+	preallocateSegments bool
+	maxSegmentAge       time.Duration
+	activeSegmentSince  int64
+	eventListener       config.EventListener
+}
+
+// BlobWriteBackWriter writes the live blob entries to new inactive blob segments during the garbage collection of blob segments.
+// Unlike WriteBackWriter, it does not roll over the active segment, the order of the blob segments does not matter because a blob entry is
+// reachable only through a BlobReference.
+type BlobWriteBackWriter[Key config.BitCaskKey] struct {
+	blobSegments    *BlobSegments[Key]
+	segment         *Segment[Key]
+	segmentsWritten int
+	bytesWritten    int64
+}
+
+// newBlobSegments creates a new instance of BlobSegments and reloads all the blob segments as inactive blob segments.
+// BlobSegments shares the fileIdGenerator with Segments, so the fileIds of the segments and the blob segments are a single strictly increasing sequence
+func newBlobSegments[Key config.BitCaskKey](
+	directory string,
+	maxSegmentSizeBytes uint64,
+	options SegmentsOptions,
+	clock clock.Clock,
+	fileIdGenerator *id.TimestampBasedFileIdGenerator) (*BlobSegments[Key], error) {
+
+	blobSegments := &BlobSegments[Key]{
+		inactiveSegments:    make(map[uint64]*Segment[Key]),
+		fileIdGenerator:     fileIdGenerator,
+		clock:               clock,
+		maxSegmentSizeBytes: maxSegmentSizeBytes,
+		valueThresholdBytes: options.BlobValueThresholdBytes,
+		directory:           directory,
+		compressor:          options.Compressor,
+		keyProvider:         options.KeyProvider,
+		memoryMappedReads:   options.MemoryMappedReads,
+		preallocateSegments: options.PreallocateSegments,
+		maxSegmentAge:       options.MaxSegmentAge,
+		eventListener:       options.EventListener,
+	}
+	if err := blobSegments.reload(); err != nil {
+		return nil, err
+	}
+	return blobSegments, nil
+}
+
+// shouldSeparate returns true if the value of valueSize bytes is larger than the blob value threshold
+func (blobSegments *BlobSegments[Key]) shouldSeparate(valueSize uint64) bool {
+	return blobSegments.valueThresholdBytes > 0 && valueSize > blobSegments.valueThresholdBytes
+}
+
+// Append appends the key in the bucket and the value to the active blob segment and returns the BlobReference to the blob entry. compressed signifies that the value is compressed.
+// The active blob segment is created if it does not exist, or rolled over if it can not fit the blob entry within the segment size threshold.
+func (blobSegments *BlobSegments[Key]) Append(bucket uint32, key Key, value []byte, compressed bool) (*BlobReference, error) {
+	if err := blobSegments.maybeRolloverActiveSegment(blobSegments.entryLength(bucket, key, uint64(len(value)))); err != nil {
+		return nil, err
+	}
+	entry := NewEntry[Key](key, value, blobSegments.clock).inBucket(bucket)
+	if compressed {
+		entry.markCompressed()
+	}
+	appendEntryResponse, err := blobSegments.activeSegment.append(entry)
+	if err != nil {
+		return nil, err
+	}
+	return newBlobReference(appendEntryResponse), nil
+}
+
+// maybeRolloverActiveSegment creates the active blob segment if it does not exist, or rolls it over if it can not fit a blob entry of entryLength bytes within the segment size threshold
+// or if it has expired
+func (blobSegments *BlobSegments[Key]) maybeRolloverActiveSegment(entryLength uint64) error {
+	blobSegments.maybeRolloverExpiredActiveSegment()
+	if blobSegments.activeSegment != nil && blobSegments.activeSegment.canFit(entryLength, blobSegments.maxSegmentSizeBytes) {
+		return nil
+	}
+	segment, err := blobSegments.nextSegment()
+	if err != nil {
+		return err
+	}
+	blobSegments.deactivateActiveSegment()
+	blobSegments.activeSegment = segment
+	blobSegments.activeSegmentSince = blobSegments.clock.Now()
+	return nil
+}
+
+// maybeRolloverExpiredActiveSegment makes the active blob segment inactive if its first blob entry is older than the max segment age.
+// The next active blob segment is created lazily on the next append
+func (blobSegments *BlobSegments[Key]) maybeRolloverExpiredActiveSegment() {
+	if blobSegments.maxSegmentAge == 0 || blobSegments.activeSegment == nil {
+		return
+	}
+	if blobSegments.clock.Now()-blobSegments.activeSegmentSince < int64(blobSegments.maxSegmentAge) {
+		return
+	}
+	blobSegments.deactivateActiveSegment()
+	blobSegments.activeSegment = nil
+}
+
+// deactivateActiveSegment closes the active blob segment for writes and adds it to the inactive blob segments, if the active blob segment exists
+func (blobSegments *BlobSegments[Key]) deactivateActiveSegment() {
+	if blobSegments.activeSegment != nil {
+		blobSegments.activeSegment.stopWrites()
+		blobSegments.inactiveSegments[blobSegments.activeSegment.fileId] = blobSegments.activeSegment
+		blobSegments.eventListener.SegmentRolledOver(config.SegmentRolloverEvent{FileId: blobSegments.activeSegment.fileId, SizeInBytes: blobSegments.activeSegment.sizeInBytes(), Blob: true})
+	}
+}
+
+// Read reads the value identified by the BlobReference from the active or an inactive blob segment
+func (blobSegments *BlobSegments[Key]) Read(reference *BlobReference) ([]byte, error) {
+	var buffer []byte
+	storedEntry, err := blobSegments.readInto(reference, &buffer)
+	if err != nil {
+		return nil, err
+	}
+	return storedEntry.Value, nil
+}
+
+// readInto reads the blob entry identified by the BlobReference into the buffer, refer to Segment.readInto
+func (blobSegments *BlobSegments[Key]) readInto(reference *BlobReference, buffer *[]byte) (*StoredEntry, error) {
+	segment, err := blobSegments.segmentOf(reference)
+	if err != nil {
+		return nil, err
+	}
+	return segment.readInto(reference.Offset, reference.EntryLength, buffer)
+}
+
+// valueReader returns an io.ReadCloser of the value identified by the BlobReference, refer to Segment.valueReader
+func (blobSegments *BlobSegments[Key]) valueReader(reference *BlobReference) (io.ReadCloser, error) {
+	segment, err := blobSegments.segmentOf(reference)
+	if err != nil {
+		return nil, err
+	}
+	reader, _, err := segment.valueReader(reference.Offset, reference.EntryLength)
+	return reader, err
+}
+
+// segmentOf returns the active or the inactive blob segment identified by the fileId of the BlobReference
+func (blobSegments *BlobSegments[Key]) segmentOf(reference *BlobReference) (*Segment[Key], error) {
+	segment, ok := blobSegments.inactiveSegments[reference.FileId]
+	if !ok && blobSegments.activeSegment != nil && blobSegments.activeSegment.fileId == reference.FileId {
+		segment, ok = blobSegments.activeSegment, true
+	}
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Invalid blob file id %v", reference.FileId))
+	}
+	return segment, nil
+}
+
+// InactiveSegmentIds returns the fileIds of all the inactive blob segments in the increasing order (oldest first)
+func (blobSegments *BlobSegments[Key]) InactiveSegmentIds() []uint64 {
+	fileIds := make([]uint64, 0, len(blobSegments.inactiveSegments))
+	for fileId := range blobSegments.inactiveSegments {
+		fileIds = append(fileIds, fileId)
+	}
+	sort.Slice(fileIds, func(i, j int) bool {
+		return fileIds[i] < fileIds[j]
+	})
+	return fileIds
+}
+
+// InactiveSegmentSizes returns the size in bytes of all the inactive blob segments, keyed by fileId
+func (blobSegments *BlobSegments[Key]) InactiveSegmentSizes() map[uint64]int64 {
+	sizes := make(map[uint64]int64, len(blobSegments.inactiveSegments))
+	for fileId, segment := range blobSegments.inactiveSegments {
+		sizes[fileId] = segment.sizeInBytes()
+	}
+	return sizes
+}
+
+// Iterator returns a SegmentIterator over the inactive blob segment identified by fileId. This operation is performed during the garbage collection of blob segments.
+func (blobSegments *BlobSegments[Key]) Iterator(fileId uint64, keyMapper func([]byte) Key) (*SegmentIterator[Key], error) {
+	segment, ok := blobSegments.inactiveSegments[fileId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Invalid inactive blob file id %v", fileId))
+	}
+	return segment.Iterator(keyMapper)
+}
+
+// AllInactiveSegments returns all the inactive blob segments
+func (blobSegments *BlobSegments[Key]) AllInactiveSegments() map[uint64]*Segment[Key] {
+	return blobSegments.inactiveSegments
+}
+
+// Remove removes all the inactive blob files identified by fileIds
+func (blobSegments *BlobSegments[Key]) Remove(fileIds []uint64) {
+	for _, fileId := range fileIds {
+		segment, ok := blobSegments.inactiveSegments[fileId]
+		if ok {
+			segment.remove()
+			delete(blobSegments.inactiveSegments, fileId)
+			blobSegments.eventListener.SegmentRemoved(config.SegmentRemovalEvent{FileId: fileId, Blob: true, Reason: config.SegmentMerged})
+		}
+	}
+}
+
+// NewWriteBackWriter creates a new instance of BlobWriteBackWriter which writes the live blob entries to new inactive blob segments
+func (blobSegments *BlobSegments[Key]) NewWriteBackWriter() *BlobWriteBackWriter[Key] {
+	return &BlobWriteBackWriter[Key]{blobSegments: blobSegments}
+}
+
+// ShouldRollover returns true if the writer does not have a blob segment yet, or if its current blob segment can not fit the blob entry within the size threshold
+func (writer *BlobWriteBackWriter[Key]) ShouldRollover(key Key, entry *MappedStoredEntry[Key]) bool {
+	if writer.segment == nil {
+		return true
+	}
+	entryLength := writer.blobSegments.entryLength(entry.Bucket, key, uint64(len(entry.Value)))
+	return !writer.segment.canFit(entryLength, writer.blobSegments.maxSegmentSizeBytes)
+}
+
+// Rollover closes the current blob segment of the writer and creates a new inactive blob segment.
+// Rollover changes the state of BlobSegments, so it must be invoked with the exclusive lock of KVStore held.
+func (writer *BlobWriteBackWriter[Key]) Rollover() error {
+	writer.Close()
+	segment, err := writer.blobSegments.nextSegment()
+	if err != nil {
+		return err
+	}
+	writer.blobSegments.inactiveSegments[segment.fileId] = segment
+	writer.segment = segment
+	writer.segmentsWritten = writer.segmentsWritten + 1
+	return nil
+}
+
+// Append appends the key and the value of the blob entry, preserving its timestamp and its compression, to the current blob segment of the writer and returns the new BlobReference.
+// Append performs a Rollover if ShouldRollover returns true. If the caller has already performed the Rollover, Append does not need the lock of KVStore.
+func (writer *BlobWriteBackWriter[Key]) Append(key Key, entry *MappedStoredEntry[Key]) (*BlobReference, error) {
+	if writer.ShouldRollover(key, entry) {
+		if err := writer.Rollover(); err != nil {
+			return nil, err
+		}
+	}
+	blobEntry := NewEntryPreservingTimestamp(key, entry.Value, entry.Timestamp, writer.blobSegments.clock).inBucket(entry.Bucket)
+	if entry.Compressed {
+		blobEntry.markCompressed()
+	}
+	appendEntryResponse, err := writer.segment.append(blobEntry)
+	if err != nil {
+		return nil, err
+	}
+	writer.bytesWritten = writer.bytesWritten + int64(appendEntryResponse.EntryLength)
+	return newBlobReference(appendEntryResponse), nil
+}
+
+// SegmentsWritten returns the number of new inactive blob segments created by the writer
+func (writer *BlobWriteBackWriter[Key]) SegmentsWritten() int {
+	return writer.segmentsWritten
+}
+
+// BytesWritten returns the number of bytes appended by the writer
+func (writer *BlobWriteBackWriter[Key]) BytesWritten() int64 {
+	return writer.bytesWritten
+}
+
+// Sync performs a file sync of the current blob segment of the writer
+func (writer *BlobWriteBackWriter[Key]) Sync() {
+	if writer.segment != nil {
+		writer.segment.sync()
+	}
+}
+
+// Close syncs and closes the write file pointer of the current blob segment of the writer
+func (writer *BlobWriteBackWriter[Key]) Close() {
+	if writer.segment != nil {
+		writer.segment.sync()
+		writer.segment.stopWrites()
+		writer.segment = nil
+	}
+}
+
+// sync performs a file sync of the active blob segment
+func (blobSegments *BlobSegments[Key]) sync() {
+	if blobSegments.activeSegment != nil {
+		blobSegments.activeSegment.sync()
+	}
+}
+
+// removeAll removes the active and all the inactive blob segment files from disk
+func (blobSegments *BlobSegments[Key]) removeAll() {
+	if blobSegments.activeSegment != nil {
+		blobSegments.activeSegment.remove()
+	}
+	for _, segment := range blobSegments.inactiveSegments {
+		segment.remove()
+	}
+}
+
+// shutdown sets the active blob segment to nil and deletes all the keys from the inactive blob segments
+func (blobSegments *BlobSegments[Key]) shutdown() {
+	blobSegments.activeSegment = nil
+	for fileId := range blobSegments.inactiveSegments {
+		delete(blobSegments.inactiveSegments, fileId)
+	}
+}
+
+func (blobSegments *BlobSegments[Key]) reload() error {
+	entries, err := os.ReadDir(blobSegments.directory)
+	if err != nil {
+		return err
+	}
+	suffix := blobSegmentFilePrefix + "." + segmentFileSuffix
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), suffix) {
+			segment, err := reloadSegmentFile[Key](entry.Name(), blobSegments.directory, blobSegments.compressor, blobSegments.keyProvider, blobSegments.memoryMappedReads)
+			if err != nil {
+				return err
+			}
+			blobSegments.fileIdGenerator.Observe(segment.fileId)
+			if segment.sizeInBytes() == 0 {
+				segment.remove()
+				blobSegments.eventListener.SegmentRemoved(config.SegmentRemovalEvent{FileId: segment.fileId, Blob: true, Reason: config.SegmentEmpty})
+				continue
+			}
+			blobSegments.inactiveSegments[segment.fileId] = segment
+		}
+	}
+	return nil
+}
+
+// nextSegment creates a new blob segment with the next fileId, encrypted with the current key if BlobSegments has a KeyProvider,
+// and preallocated if PreallocateSegments is enabled
+func (blobSegments *BlobSegments[Key]) nextSegment() (*Segment[Key], error) {
+	segment, err := newSegmentFile[Key](blobSegments.fileIdGenerator.Next(), blobSegmentFilePrefix, blobSegments.directory, blobSegments.compressor, blobSegments.keyProvider, blobSegments.memoryMappedReads)
+	if err != nil {
+		return nil, err
+	}
+	if blobSegments.preallocateSegments {
+		segment.preallocate(blobSegments.maxSegmentSizeBytes)
+	}
+	return segment, nil
+}
+
+// entryLength returns the number of bytes that a blob entry with the key in the bucket and a value of valueSize bytes occupies in a blob segment
+func (blobSegments *BlobSegments[Key]) entryLength(bucket uint32, key Key, valueSize uint64) uint64 {
+	return encodedLength(serializedKeySize(bucket, key.Serialize()), valueSize, blobSegments.keyProvider != nil)
+}
+
+func newBlobReference(response *AppendEntryResponse) *BlobReference {
+	return &BlobReference{
+		FileId:      response.FileId,
+		Offset:      response.Offset,
+		EntryLength: response.EntryLength,
+	}
+}
@@ -11,6 +11,21 @@ var reservedKeySize, reservedValueSize = uint32(unsafe.Sizeof(uint32(0))), uint3
 var reservedTimestampSize = uint32(unsafe.Sizeof(uint32(0)))
 var littleEndian = binary.LittleEndian
 var tombstoneMarkerSize = uint32(unsafe.Sizeof(byte(0)))
+var headerSize = reservedTimestampSize + reservedKeySize + reservedValueSize
+var reservedBucketSize = uint32(unsafe.Sizeof(uint32(0)))
+
+// DefaultBucket is the bucket of the entries which are not put in a named bucket. An entry in the DefaultBucket is encoded without a bucket
+const DefaultBucket uint32 = 0
+
+// deletedMarker, blobReferenceMarker, compressedMarker and bucketMarker are the bits of the tombstone byte.
+// deletedMarker signifies a deleted key, blobReferenceMarker signifies that the value is an encoded BlobReference, refer to BlobReference.go,
+// compressedMarker signifies that the value is compressed by the config.Compressor and bucketMarker signifies that the key is prefixed by its bucket
+const (
+	deletedMarker       byte = 0x01
+	blobReferenceMarker byte = 0x02
+	compressedMarker    byte = 0x04
+	bucketMarker        byte = 0x08
+)
 
 type valueReference struct {
 	value     []byte
@@ -22,6 +37,7 @@ type Entry[Key config.Serializable] struct {
 	value     valueReference
 	timestamp uint32
 	clock     clock.Clock
+	bucket    uint32
 }
 
 // NewEntry creates a new instance of Entry with tombstone byte set to 0 (0000 0000)
@@ -54,6 +70,54 @@ func NewDeletedEntry[Key config.Serializable](key Key, clock clock.Clock) *Entry
 	}
 }
 
+// NewDeletedEntryPreservingTimestamp creates a new instance of Entry with tombstone byte set to 1 (0000 0001) and keeping the provided timestamp
+func NewDeletedEntryPreservingTimestamp[Key config.Serializable](key Key, ts uint32, clock clock.Clock) *Entry[Key] {
+	return &Entry[Key]{
+		key:       key,
+		value:     valueReference{value: []byte{}, tombstone: 1},
+		timestamp: ts,
+		clock:     clock,
+	}
+}
+
+// NewBlobReferenceEntryPreservingTimestamp creates a new instance of Entry with tombstone byte set to 2 (0000 0010) and keeping the provided timestamp.
+// The value of the entry is the encoded BlobReference which identifies the actual value in a blob segment file.
+func NewBlobReferenceEntryPreservingTimestamp[Key config.Serializable](key Key, reference *BlobReference, ts uint32, clock clock.Clock) *Entry[Key] {
+	return &Entry[Key]{
+		key:       key,
+		value:     valueReference{value: reference.encode(), tombstone: blobReferenceMarker},
+		timestamp: ts,
+		clock:     clock,
+	}
+}
+
+// markCompressed sets the compressedMarker in the tombstone byte, signifying that the value of the Entry is compressed
+func (entry *Entry[Key]) markCompressed() *Entry[Key] {
+	entry.value.tombstone = entry.value.tombstone | compressedMarker
+	return entry
+}
+
+// inBucket sets the bucket of the Entry. An Entry in a bucket other than the DefaultBucket has the bucketMarker set in the tombstone byte
+func (entry *Entry[Key]) inBucket(bucket uint32) *Entry[Key] {
+	entry.bucket = bucket
+	if bucket != DefaultBucket {
+		entry.value.tombstone = entry.value.tombstone | bucketMarker
+	}
+	return entry
+}
+
+// serializeKey serializes the key of the Entry. The serialized key of an Entry in a bucket other than the DefaultBucket is prefixed by the 32 bits of the bucket
+func (entry *Entry[Key]) serializeKey() []byte {
+	serializedKey := entry.key.Serialize()
+	if entry.bucket == DefaultBucket {
+		return serializedKey
+	}
+	prefixed := make([]byte, reservedBucketSize+uint32(len(serializedKey)))
+	littleEndian.PutUint32(prefixed, entry.bucket)
+	copy(prefixed[reservedBucketSize:], serializedKey)
+	return prefixed
+}
+
 // encode performs the encode operation which converts the Entry to a byte slice which can be written to the disk
 // Encoding scheme consists of the following structure:
 //
@@ -63,13 +127,34 @@ func NewDeletedEntry[Key config.Serializable](key Key, clock clock.Clock) *Entry
 //
 // timestamp, key_size, value_size consist of 32 bits each. The value ([]byte) consists of the value provided by the user and a byte for tombstone, that
 // is used to signify if the key/value pair is deleted or not. Take a look at the NewDeletedEntry function.
+// The second bit of the tombstone byte signifies that the value is a reference to a blob segment file. Take a look at the NewBlobReferenceEntryPreservingTimestamp function.
+// The third bit of the tombstone byte signifies that the value is compressed. Take a look at the markCompressed method.
+// The fourth bit of the tombstone byte signifies that the key is prefixed by the bucket of the entry. Take a look at the inBucket method.
 // A little-endian system, stores the least-significant byte at the smallest address. What is special about 4 bytes key size or 4 bytes value size?
 // The maximum integer stored by 4 bytes is 4,294,967,295 (2 ** 32 - 1), roughly ~4.2GB. This means each key or value size can not be greater than 4.2GB.
 func (entry *Entry[Key]) encode() []byte {
-	serializedKey := entry.key.Serialize()
+	serializedKey := entry.serializeKey()
 	keySize, valueSize := uint32(len(serializedKey)), uint32(len(entry.value.value))+tombstoneMarkerSize
 
-	encoded := make([]byte, reservedTimestampSize+reservedKeySize+reservedValueSize+keySize+valueSize)
+	encoded := make([]byte, headerSize+keySize+valueSize)
+	offset := entry.encodePrefixInto(encoded, serializedKey, valueSize)
+
+	copy(encoded[offset:], entry.value.value)
+	encoded[offset+valueSize-tombstoneMarkerSize] = entry.value.tombstone
+	return encoded
+}
+
+// encodePrefix encodes the timestamp, the key_size, the value_size and the key of the Entry, without the value. valueSize includes the tombstone byte.
+// It is used to stream a value which is not held in memory, refer to Segment.appendFrom
+func (entry *Entry[Key]) encodePrefix(valueSize uint32) []byte {
+	serializedKey := entry.serializeKey()
+	encoded := make([]byte, headerSize+uint32(len(serializedKey)))
+	entry.encodePrefixInto(encoded, serializedKey, valueSize)
+	return encoded
+}
+
+// encodePrefixInto encodes the timestamp, the key_size, the value_size and the key into encoded, and returns the offset at which the value begins
+func (entry *Entry[Key]) encodePrefixInto(encoded []byte, serializedKey []byte, valueSize uint32) uint32 {
 	var offset uint32 = 0
 
 	if entry.timestamp == 0 {
@@ -79,17 +164,24 @@ func (entry *Entry[Key]) encode() []byte {
 	}
 	offset = offset + reservedTimestampSize
 
-	littleEndian.PutUint32(encoded[offset:], keySize)
+	littleEndian.PutUint32(encoded[offset:], uint32(len(serializedKey)))
 	offset = offset + reservedKeySize
 
 	littleEndian.PutUint32(encoded[offset:], valueSize)
 	offset = offset + reservedValueSize
 
 	copy(encoded[offset:], serializedKey)
-	offset = offset + keySize
+	return offset + uint32(len(serializedKey))
+}
 
-	copy(encoded[offset:], append(entry.value.value, entry.value.tombstone))
-	return encoded
+// encodedLength returns the length of an encoded entry with a serialized key of keySize bytes and a value of valueSize bytes, and the length of its record
+// if the entry is encrypted. It is used to decide if an entry fits in a segment before it is encoded, refer to Segments.maybeRolloverActiveSegment
+func encodedLength(keySize uint64, valueSize uint64, encrypted bool) uint64 {
+	length := uint64(headerSize) + keySize + valueSize + uint64(tombstoneMarkerSize)
+	if encrypted {
+		length = length + encryptedRecordOverhead
+	}
+	return length
 }
 
 // decode performs the decode operation and returns an instance of StoredEntry
@@ -101,24 +193,66 @@ func decode(content []byte) *StoredEntry {
 
 // decodeMulti performs multiple decode operations and returns an array of MappedStoredEntry
 // This method is invoked when a segment file needs to be read completely. This happens during reload and merge operations.
-func decodeMulti[Key config.BitCaskKey](content []byte, keyMapper func([]byte) Key) []*MappedStoredEntry[Key] {
+// The length of every entry is validated against the content before the entry is decoded, and a CorruptSegmentError (without the FilePath) is returned
+// for the first entry which is truncated or malformed, along with the entries decoded before it. A key of the wrong size is a CorruptSegmentError as well, refer to config.KeyDecoderOf
+func decodeMulti[Key config.BitCaskKey](content []byte, keyMapper func([]byte) Key) ([]*MappedStoredEntry[Key], error) {
 	contentLength := uint32(len(content))
 	var offset uint32 = 0
 
+	decodeKey := config.KeyDecoderOf(keyMapper)
+
 	var entries []*MappedStoredEntry[Key]
 	for offset < contentLength {
+		entryLength, err := entryLengthAt(content, offset)
+		if err != nil {
+			return entries, &CorruptSegmentError{Offset: int64(offset), Err: err}
+		}
 		entry, traversedOffset := decodeFrom(content, offset)
+		key, err := decodeKey(entry.Key)
+		if err != nil {
+			return nil, &CorruptSegmentError{Offset: int64(offset), Err: err}
+		}
 		entries = append(entries, &MappedStoredEntry[Key]{
-			Key:         keyMapper(entry.Key),
+			Key:         key,
+			Bucket:      entry.Bucket,
 			Value:       entry.Value,
 			Deleted:     entry.Deleted,
+			Blob:        entry.Blob,
+			Compressed:  entry.Compressed,
 			Timestamp:   entry.Timestamp,
 			KeyOffset:   offset,
-			EntryLength: traversedOffset,
+			EntryLength: entryLength,
 		})
 		offset = traversedOffset
 	}
-	return entries
+	return entries, nil
+}
+
+// entryLengthAt returns the length of the entry at the offset of the content. It returns ErrTruncatedEntry if the content ends before the end of the entry,
+// and ErrMalformedEntry if the value size of the entry does not include the tombstone marker, so that decodeFrom never reads beyond the entry.
+func entryLengthAt(content []byte, offset uint32) (uint32, error) {
+	remaining := uint64(len(content)) - uint64(offset)
+	if remaining < uint64(headerSize) {
+		return 0, ErrTruncatedEntry
+	}
+	_, keySize, valueSize := decodeHeader(content[offset:])
+	if valueSize < tombstoneMarkerSize {
+		return 0, ErrMalformedEntry
+	}
+	entryLength := uint64(headerSize) + uint64(keySize) + uint64(valueSize)
+	if entryLength > remaining {
+		return 0, ErrTruncatedEntry
+	}
+	return uint32(entryLength), nil
+}
+
+// decodeHeader decodes the fixed size header (timestamp, key_size and value_size) of an entry.
+// It is used by the SegmentIterator which reads the header first to know how many bytes of key and value follow it.
+func decodeHeader(header []byte) (uint32, uint32, uint32) {
+	timestamp := littleEndian.Uint32(header)
+	keySize := littleEndian.Uint32(header[reservedTimestampSize:])
+	valueSize := littleEndian.Uint32(header[reservedTimestampSize+reservedKeySize:])
+	return timestamp, keySize, valueSize
 }
 
 // decodeFrom performs the decode operation.
@@ -132,8 +266,10 @@ func decodeMulti[Key config.BitCaskKey](content []byte, keyMapper func([]byte) K
 // Note: the value size is the size including the length of the byte slice provided by the user and one byte for the tombstone marker
 // Reading further from the offset to the offset+keySize return the actual key, followed by next read from offset to offset+valueSize which returns the actual value.
 // DeletedFlag is determined by taking the last byte from the `value` byte slice and performing an AND operation with 0x01.
+// Blob is decoded from the value if the AND operation of the last byte with 0x02 is non-zero, and the value is compressed if the AND operation of the last byte with 0x04 is non-zero.
+// The key is prefixed by the bucket if the AND operation of the last byte with 0x08 is non-zero.
 func decodeFrom(content []byte, offset uint32) (*StoredEntry, uint32) {
-	timestamp := littleEndian.Uint32(content)
+	timestamp := littleEndian.Uint32(content[offset:])
 	offset = offset + reservedTimestampSize
 
 	keySize := littleEndian.Uint32(content[offset:])
@@ -149,10 +285,31 @@ func decodeFrom(content []byte, offset uint32) (*StoredEntry, uint32) {
 	offset = offset + valueSize
 
 	valueLength := len(value)
+	bucket, serializedKey := decodeBucket(serializedKey, value[valueLength-1])
 	return &StoredEntry{
-		Key:       serializedKey,
-		Value:     value[:valueLength-1],
-		Deleted:   value[valueLength-1]&0x01 == 0x01,
-		Timestamp: timestamp,
+		Key:        serializedKey,
+		Bucket:     bucket,
+		Value:      value[: valueLength-1 : valueLength-1],
+		Deleted:    value[valueLength-1]&deletedMarker == deletedMarker,
+		Blob:       decodeBlobReferenceIfMarked(value[:valueLength-1], value[valueLength-1]),
+		Compressed: value[valueLength-1]&compressedMarker == compressedMarker,
+		Timestamp:  timestamp,
 	}, offset
 }
+
+// serializedKeySize returns the size of the serialized key of an entry in the bucket, which is prefixed by the bucket unless the bucket is the DefaultBucket
+func serializedKeySize(bucket uint32, serializedKey []byte) uint64 {
+	if bucket == DefaultBucket {
+		return uint64(len(serializedKey))
+	}
+	return uint64(reservedBucketSize) + uint64(len(serializedKey))
+}
+
+// decodeBucket splits the serialized key of an entry into its bucket and the serialized key without the bucket, if the tombstone byte has the bucketMarker set.
+// It returns the DefaultBucket and the serialized key as is otherwise
+func decodeBucket(serializedKey []byte, tombstone byte) (uint32, []byte) {
+	if tombstone&bucketMarker != bucketMarker {
+		return DefaultBucket, serializedKey
+	}
+	return littleEndian.Uint32(serializedKey), serializedKey[reservedBucketSize:]
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bitcask/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+var reservedRecordLengthSize = uint32(unsafe.Sizeof(uint32(0)))
+
+// encryptedRecordOverhead is the number of bytes a record adds to an encoded entry: the record_length, the standard nonce (12 bytes) and the authentication tag (16 bytes) of AES-GCM
+var encryptedRecordOverhead = uint64(reservedRecordLengthSize) + 12 + 16
+
+// entryCipher encrypts and decrypts the entries of an encrypted segment with AES-GCM, using the key identified by keyId.
+// Every entry is encrypted individually (with a random nonce) into a record, so an entry can still be read independently of the other entries of the segment.
+// The fileId of the segment is used as the additional authenticated data, so a record can not be moved to another segment without being detected.
+// Encoding scheme of a record consists of the following structure:
+//
+//	┌───────────────┬───────┬──────────────────────────────────┐
+//	│ record_length │ nonce │ encrypted entry + authentication │
+//	└───────────────┴───────┴──────────────────────────────────┘
+//
+// record_length consists of 32 bits and is the length of the nonce and the encrypted entry (including the authentication tag). The encrypted entry
+// is the entry encoded by Entry.encode. The length of the record (including the record_length) is the EntryLength stored in the KeyDirectory.
+type entryCipher struct {
+	keyId          uint32
+	aead           cipher.AEAD
+	additionalData []byte
+}
+
+// newEntryCipher creates a new instance of entryCipher for the segment identified by fileId, with the key identified by keyId
+func newEntryCipher(keyProvider config.KeyProvider, keyId uint32, fileId uint64) (*entryCipher, error) {
+	if keyProvider == nil {
+		return nil, errors.New(fmt.Sprintf("Segment %v is encrypted with the key id %v but no KeyProvider is configured", fileId, keyId))
+	}
+	key, err := keyProvider.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	additionalData := make([]byte, unsafe.Sizeof(fileId))
+	littleEndian.PutUint64(additionalData, fileId)
+	return &entryCipher{keyId: keyId, aead: aead, additionalData: additionalData}, nil
+}
+
+// seal encrypts the encoded entry and returns the record
+func (entryCipher *entryCipher) seal(encoded []byte) ([]byte, error) {
+	nonceSize := entryCipher.aead.NonceSize()
+	record := make([]byte, int(reservedRecordLengthSize)+nonceSize, int(reservedRecordLengthSize)+nonceSize+len(encoded)+entryCipher.aead.Overhead())
+	nonce := record[reservedRecordLengthSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	record = entryCipher.aead.Seal(record, nonce, encoded, entryCipher.additionalData)
+	littleEndian.PutUint32(record, uint32(len(record))-reservedRecordLengthSize)
+	return record, nil
+}
+
+// open authenticates and decrypts the record (including the record_length) and returns the encoded entry
+func (entryCipher *entryCipher) open(record []byte) ([]byte, error) {
+	nonceSize := entryCipher.aead.NonceSize()
+	if len(record) < int(reservedRecordLengthSize)+nonceSize {
+		return nil, errors.New(fmt.Sprintf("Invalid encrypted record of length %v", len(record)))
+	}
+	nonce, encrypted := record[reservedRecordLengthSize:int(reservedRecordLengthSize)+nonceSize], record[int(reservedRecordLengthSize)+nonceSize:]
+	return entryCipher.aead.Open(nil, nonce, encrypted, entryCipher.additionalData)
+}
+
+// decodeRecordLength returns the length of the record (including the record_length) from its first reservedRecordLengthSize bytes
+func decodeRecordLength(content []byte) uint32 {
+	return littleEndian.Uint32(content) + reservedRecordLengthSize
+}
+
+// recordLengthAt returns the length of the record at the offset of the content, including its record_length, or ErrTruncatedEntry if the content ends before the end of the record
+func recordLengthAt(content []byte, offset uint32) (uint32, error) {
+	remaining := uint64(len(content)) - uint64(offset)
+	if remaining < uint64(reservedRecordLengthSize) {
+		return 0, ErrTruncatedEntry
+	}
+	recordLength := uint64(littleEndian.Uint32(content[offset:])) + uint64(reservedRecordLengthSize)
+	if recordLength > remaining {
+		return 0, ErrTruncatedEntry
+	}
+	return uint32(recordLength), nil
+}
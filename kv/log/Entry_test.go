@@ -2,6 +2,7 @@ package log
 
 import (
 	"bitcask/clock"
+	"errors"
 	"testing"
 )
 
@@ -68,7 +69,7 @@ func TestDecodesMultipleKeyValuePairs(t *testing.T) {
 
 	multipleEntries := append(append(encodedTopic, encodedDisk...), encodedEngine...)
 
-	entries := decodeMulti(multipleEntries, func(key []byte) serializableKey {
+	entries, _ := decodeMulti(multipleEntries, func(key []byte) serializableKey {
 		return serializableKey(key)
 	})
 	if entries[0].Key != "topic" {
@@ -93,6 +94,38 @@ func TestDecodesMultipleKeyValuePairs(t *testing.T) {
 	}
 }
 
+func TestDecodeMultipleEntriesWithATruncatedEntry(t *testing.T) {
+	entry := NewEntry[serializableKey]("topic", []byte("microservices"), clock.NewSystemClock())
+	encodedTopic := entry.encode()
+
+	entry = NewEntry[serializableKey]("disk", []byte("ssd"), clock.NewSystemClock())
+	encodedDisk := entry.encode()
+
+	for _, truncatedBytes := range []int{3, 10, len(encodedDisk) - 1} {
+		multipleEntries := append(append([]byte{}, encodedTopic...), encodedDisk[:len(encodedDisk)-truncatedBytes]...)
+		_, err := decodeMulti(multipleEntries, func(key []byte) serializableKey {
+			return serializableKey(key)
+		})
+		var corruptSegmentError *CorruptSegmentError
+		if !errors.Is(err, ErrTruncatedEntry) || !errors.As(err, &corruptSegmentError) || corruptSegmentError.Offset != int64(len(encodedTopic)) {
+			t.Fatalf("Expected ErrTruncatedEntry at offset %v for %v truncated bytes, received %v", len(encodedTopic), truncatedBytes, err)
+		}
+	}
+}
+
+func TestDecodeMultipleEntriesWithAMalformedEntry(t *testing.T) {
+	entry := NewEntry[serializableKey]("topic", []byte("microservices"), clock.NewSystemClock())
+	encoded := entry.encode()
+	littleEndian.PutUint32(encoded[reservedTimestampSize+reservedKeySize:], 0)
+
+	_, err := decodeMulti(encoded, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	if !errors.Is(err, ErrMalformedEntry) {
+		t.Fatalf("Expected ErrMalformedEntry for an entry without the tombstone marker, received %v", err)
+	}
+}
+
 func TestEncodesAKeyValuePairPreservingTimestamp(t *testing.T) {
 	entry := NewEntryPreservingTimestamp[serializableKey]("topic", []byte("microservices"), 10, clock.NewSystemClock())
 	encoded := entry.encode()
@@ -111,3 +144,41 @@ func TestEncodesAKeyValuePairPreservingTimestamp(t *testing.T) {
 		t.Fatalf("Expected decoded timestamp to be %v, received %v", 10, storedEntry.Timestamp)
 	}
 }
+
+func TestEncodesAKeyValuePairInABucket(t *testing.T) {
+	entry := NewEntry[serializableKey]("topic", []byte("microservices"), clock.NewSystemClock()).inBucket(7)
+	encoded := entry.encode()
+
+	storedEntry := decode(encoded)
+	if storedEntry.Bucket != 7 {
+		t.Fatalf("Expected decoded bucket to be %v, received %v", 7, storedEntry.Bucket)
+	}
+	if string(storedEntry.Key) != "topic" {
+		t.Fatalf("Expected decoded key to be %v, received %v", "topic", string(storedEntry.Key))
+	}
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected decoded value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+}
+
+func TestEncodesADeletedKeyInABucket(t *testing.T) {
+	entry := NewDeletedEntry[serializableKey]("topic", clock.NewSystemClock()).inBucket(3)
+	encoded := entry.encode()
+
+	storedEntry := decode(encoded)
+	if !storedEntry.Deleted || storedEntry.Bucket != 3 {
+		t.Fatalf("Expected a deleted entry in bucket %v, received deleted %v in bucket %v", 3, storedEntry.Deleted, storedEntry.Bucket)
+	}
+	if string(storedEntry.Key) != "topic" {
+		t.Fatalf("Expected decoded key to be %v, received %v", "topic", string(storedEntry.Key))
+	}
+}
+
+func TestEncodesAKeyValuePairInTheDefaultBucketWithoutABucket(t *testing.T) {
+	withoutBucket := NewEntry[serializableKey]("topic", []byte("microservices"), &FixedClock{}).encode()
+	inDefaultBucket := NewEntry[serializableKey]("topic", []byte("microservices"), &FixedClock{}).inBucket(DefaultBucket).encode()
+
+	if string(withoutBucket) != string(inDefaultBucket) {
+		t.Fatalf("Expected an entry in the default bucket to be encoded without a bucket")
+	}
+}
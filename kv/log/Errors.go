@@ -0,0 +1,56 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrKeyTooLarge is the cause of an EntrySizeError for a serialized key larger than the maximum key size
+var ErrKeyTooLarge = errors.New("key too large")
+
+// ErrValueTooLarge is the cause of an EntrySizeError for a value larger than the maximum value size
+var ErrValueTooLarge = errors.New("value too large")
+
+// EntrySizeError is returned by an append operation if the key or the value exceeds its maximum size. Err is ErrKeyTooLarge or ErrValueTooLarge,
+// so the cause can be checked with errors.Is, whereas Size and MaxSize are available with errors.As.
+// The maximum sizes are configured in config.Config, and are always bounded by the encoding of an entry: the entry length is stored in 32 bits, refer to Entry.go
+type EntrySizeError struct {
+	Err     error
+	Size    uint64
+	MaxSize uint64
+}
+
+func (err *EntrySizeError) Error() string {
+	return fmt.Sprintf("%v: %v bytes exceed the maximum of %v bytes", err.Err, err.Size, err.MaxSize)
+}
+
+func (err *EntrySizeError) Unwrap() error {
+	return err.Err
+}
+
+// ErrEncryptedStream is returned by Segments.Stage if encryption is enabled: an encrypted entry is sealed as a whole, so its value can not be streamed
+var ErrEncryptedStream = errors.New("a value can not be streamed when encryption is enabled")
+
+// ErrTruncatedEntry is the cause of a CorruptSegmentError for a segment which ends before the end of an entry (or of a record, if the segment is encrypted)
+var ErrTruncatedEntry = errors.New("truncated entry")
+
+// ErrMalformedEntry is the cause of a CorruptSegmentError for an entry whose value size does not include the tombstone marker
+var ErrMalformedEntry = errors.New("malformed entry")
+
+// CorruptSegmentError is returned by the reload or the merge of a segment which can not be decoded. Err is ErrTruncatedEntry, ErrMalformedEntry or config.ErrInvalidKeySize,
+// so the cause can be checked with errors.Is,
+// whereas FilePath and Offset, the offset of the entry that can not be decoded, are available with errors.As.
+// A partial entry at the end of a segment is left behind by a crash during an append or a merge, and it is truncated during start-up, refer to Segments.TruncatePartialTail
+type CorruptSegmentError struct {
+	FilePath string
+	Offset   int64
+	Err      error
+}
+
+func (err *CorruptSegmentError) Error() string {
+	return fmt.Sprintf("%v at offset %v in %v", err.Err, err.Offset, err.FilePath)
+}
+
+func (err *CorruptSegmentError) Unwrap() error {
+	return err.Err
+}
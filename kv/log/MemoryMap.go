@@ -0,0 +1,21 @@
+//go:build unix
+
+package log
+
+import (
+	"os"
+	"syscall"
+)
+
+// memoryMap maps the first size bytes of the file read-only. It returns nil if the file is empty
+func memoryMap(file *os.File, size int64) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// memoryUnmap unmaps the mapping created by memoryMap
+func memoryUnmap(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
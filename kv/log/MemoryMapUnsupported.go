@@ -0,0 +1,17 @@
+//go:build !unix
+
+package log
+
+import (
+	"errors"
+	"os"
+)
+
+// memoryMap is not supported on this platform, the reads fall back to the read file pointer
+func memoryMap(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("Memory-mapped reads are not supported on this platform")
+}
+
+func memoryUnmap(mapping []byte) error {
+	return nil
+}
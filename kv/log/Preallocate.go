@@ -0,0 +1,16 @@
+//go:build linux
+
+package log
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocateKeepSize is FALLOC_FL_KEEP_SIZE, the allocated disk space is not included in the size of the file
+const fallocateKeepSize = 0x01
+
+// preallocate allocates the disk space of the file up to size bytes using fallocate, without changing the size of the file
+func preallocate(file *os.File, size int64) error {
+	return syscall.Fallocate(int(file.Fd()), fallocateKeepSize, 0, size)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package log
+
+import (
+	"errors"
+	"os"
+)
+
+// preallocate is not supported on this platform, the file is extended by the appends
+func preallocate(file *os.File, size int64) error {
+	return errors.New("Preallocation of segment files is not supported on this platform")
+}
@@ -2,22 +2,36 @@ package log
 
 import (
 	"bitcask/config"
+	"bytes"
+	"compress/flate"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
 type StoredEntry struct {
-	Key       []byte
-	Value     []byte
-	Deleted   bool
-	Timestamp uint32
+	Key        []byte
+	Bucket     uint32
+	Value      []byte
+	Deleted    bool
+	Blob       *BlobReference
+	Compressed bool
+	Timestamp  uint32
 }
 
 type MappedStoredEntry[K config.BitCaskKey] struct {
 	Key         K
+	Bucket      uint32
 	Value       []byte
 	Deleted     bool
+	Blob        *BlobReference
+	Compressed  bool
 	Timestamp   uint32
 	KeyOffset   uint32
 	EntryLength uint32
@@ -27,21 +41,38 @@ type AppendEntryResponse struct {
 	FileId      uint64
 	Offset      int64
 	EntryLength uint32
+	Blob        *BlobReference
 }
 
+// Segment decompresses the compressed values it reads with the compressor, or with config.FlateCompressor if the compressor is nil.
+// Segment encrypts every entry with the entryCipher if the segment is encrypted, else the entryCipher is nil. Refer to EntryCipher.go
+// Segment counts the tombstones appended to it, and the tombstones of a reloaded segment once it is read in full. The count is atomic because a merge appends to a new
+// inactive segment without holding the lock of KVStore.
 type Segment[Key config.BitCaskKey] struct {
-	fileId   uint64
-	filePath string
-	store    *Store
+	fileId     uint64
+	filePath   string
+	store      *Store
+	compressor config.Compressor
+	cipher     *entryCipher
+	tombstones atomic.Int64
 }
 
 const segmentFilePrefix = "bitcask"
 const segmentFileSuffix = "data"
+const blobSegmentFilePrefix = "blob"
 
 // NewSegment represents an append-only log
 func NewSegment[Key config.BitCaskKey](fileId uint64, directory string) (*Segment[Key], error) {
-	filePath, err := createSegment(fileId, directory)
-	if err != nil {
+	return newSegment[Key](fileId, segmentName(fileId, directory), nil, nil)
+}
+
+// ReloadInactiveSegment reloads the inactive segment during start-up. As a part of ReloadInactiveSegment, we just create the in-memory representation of inactive segment and its store
+func ReloadInactiveSegment[Key config.BitCaskKey](fileId uint64, directory string) (*Segment[Key], error) {
+	return reloadSegment[Key](fileId, segmentName(fileId, directory), nil, nil)
+}
+
+func newSegment[Key config.BitCaskKey](fileId uint64, filePath string, compressor config.Compressor, cipher *entryCipher) (*Segment[Key], error) {
+	if err := createSegment(filePath); err != nil {
 		return nil, err
 	}
 	store, err := NewStore(filePath)
@@ -49,35 +80,105 @@ func NewSegment[Key config.BitCaskKey](fileId uint64, directory string) (*Segmen
 		return nil, err
 	}
 	return &Segment[Key]{
-		fileId:   fileId,
-		filePath: filePath,
-		store:    store,
+		fileId:     fileId,
+		filePath:   filePath,
+		store:      store,
+		compressor: compressor,
+		cipher:     cipher,
 	}, nil
 }
 
-// ReloadInactiveSegment reloads the inactive segment during start-up. As a part of ReloadInactiveSegment, we just create the in-memory representation of inactive segment and its store
-func ReloadInactiveSegment[Key config.BitCaskKey](fileId uint64, directory string) (*Segment[Key], error) {
-	filePath := segmentName(fileId, directory)
+func reloadSegment[Key config.BitCaskKey](fileId uint64, filePath string, compressor config.Compressor, cipher *entryCipher) (*Segment[Key], error) {
 	store, err := ReloadStore(filePath)
 	if err != nil {
 		return nil, err
 	}
 	return &Segment[Key]{
-		fileId:   fileId,
-		filePath: filePath,
-		store:    store,
+		fileId:     fileId,
+		filePath:   filePath,
+		store:      store,
+		compressor: compressor,
+		cipher:     cipher,
 	}, nil
 }
 
+// newSegmentFile creates a new segment file (prefix identifies a segment or a blob segment). The segment is encrypted with the current key of the keyProvider,
+// unless the keyProvider is nil, and is memory-mapped once it becomes inactive if memoryMappedReads is true
+func newSegmentFile[Key config.BitCaskKey](
+	fileId uint64,
+	prefix string,
+	directory string,
+	compressor config.Compressor,
+	keyProvider config.KeyProvider,
+	memoryMappedReads bool) (*Segment[Key], error) {
+
+	var cipher *entryCipher
+	if keyProvider != nil {
+		var err error
+		if cipher, err = newEntryCipher(keyProvider, keyProvider.CurrentKeyId(), fileId); err != nil {
+			return nil, err
+		}
+	}
+	segment, err := newSegment[Key](fileId, segmentFileName(fileId, prefix, cipher, directory), compressor, cipher)
+	if err != nil {
+		return nil, err
+	}
+	if memoryMappedReads {
+		segment.store.enableMemoryMappedReads()
+	}
+	return segment, nil
+}
+
+// reloadSegmentFile reloads the segment file identified by its name during start-up. An encrypted segment is decrypted with the key identified by the keyId in its name,
+// so the segments encrypted with an older key remain readable as long as the keyProvider provides the older key.
+// The reloaded segment is inactive, so it is memory-mapped on the first read if memoryMappedReads is true
+func reloadSegmentFile[Key config.BitCaskKey](
+	name string,
+	directory string,
+	compressor config.Compressor,
+	keyProvider config.KeyProvider,
+	memoryMappedReads bool) (*Segment[Key], error) {
+
+	fileId, keyId, encrypted, err := parseSegmentFileName(name)
+	if err != nil {
+		return nil, err
+	}
+	var cipher *entryCipher
+	if encrypted {
+		if cipher, err = newEntryCipher(keyProvider, keyId, fileId); err != nil {
+			return nil, err
+		}
+	}
+	segment, err := reloadSegment[Key](fileId, path.Join(directory, name), compressor, cipher)
+	if err != nil {
+		return nil, err
+	}
+	if memoryMappedReads {
+		segment.store.enableMemoryMappedReads()
+	}
+	return segment, nil
+}
+
 // append performs an append operation in the segment file. Append operation is a 2-step process:
 // 1. Encode the incoming entry, more on this in Entry.go
 // 2. Write the encoded entry ([]byte) to the segment file using the Store abstraction
+// The encoded entry of an encrypted segment is encrypted into a record before it is written, more on this in EntryCipher.go
 func (segment *Segment[Key]) append(entry *Entry[Key]) (*AppendEntryResponse, error) {
 	encoded := entry.encode()
+	if segment.cipher != nil {
+		record, err := segment.cipher.seal(encoded)
+		if err != nil {
+			return nil, err
+		}
+		encoded = record
+	}
 	offset, err := segment.store.append(encoded)
 	if err != nil {
 		return nil, err
 	}
+	if entry.value.tombstone&deletedMarker == deletedMarker {
+		segment.tombstones.Add(1)
+	}
 	return &AppendEntryResponse{
 		FileId:      segment.fileId,
 		Offset:      offset,
@@ -85,24 +186,240 @@ func (segment *Segment[Key]) append(entry *Entry[Key]) (*AppendEntryResponse, er
 	}, nil
 }
 
+// appendFrom performs an append operation of the entry whose value, of size bytes, is copied from the reader to the segment file without being held in memory.
+// The entry (created without a value) provides the key, the timestamp and the tombstone byte. An entry is encrypted as a whole, so a value can not be streamed to an encrypted segment.
+func (segment *Segment[Key]) appendFrom(entry *Entry[Key], reader io.Reader, size int64) (*AppendEntryResponse, error) {
+	if segment.cipher != nil {
+		return nil, errors.New(fmt.Sprintf("A value can not be streamed to the encrypted segment %v", segment.fileId))
+	}
+	serializedKeySize := int64(len(entry.serializeKey()))
+	if size < 0 || int64(headerSize)+serializedKeySize+size+int64(tombstoneMarkerSize) > math.MaxUint32 {
+		return nil, errors.New(fmt.Sprintf("Invalid value size %v, an entry can not be larger than %v bytes", size, uint32(math.MaxUint32)))
+	}
+	prefix := entry.encodePrefix(uint32(size) + tombstoneMarkerSize)
+	offset, err := segment.store.appendFrom(prefix, reader, size, []byte{entry.value.tombstone})
+	if err != nil {
+		return nil, err
+	}
+	return &AppendEntryResponse{
+		FileId:      segment.fileId,
+		Offset:      offset,
+		EntryLength: uint32(len(prefix)) + uint32(size) + tombstoneMarkerSize,
+	}, nil
+}
+
 // read performs a read operation from the offset in the segment file. This method is invoked in the Get operation
+// An encrypted entry is decrypted and a compressed value is decompressed transparently
 func (segment *Segment[Key]) read(offset int64, size uint32) (*StoredEntry, error) {
-	bytes, err := segment.store.read(offset, size)
+	var buffer []byte
+	return segment.readInto(offset, size, &buffer)
+}
+
+// readInto performs a read operation from the offset in the segment file into the buffer, refer to Store.readInto.
+// The key and the value of the returned StoredEntry are slices of the buffer (or of the memory mapping) unless the entry is encrypted or compressed
+func (segment *Segment[Key]) readInto(offset int64, size uint32, buffer *[]byte) (*StoredEntry, error) {
+	bytes, err := segment.store.readInto(offset, size, buffer)
 	if err != nil {
 		return nil, err
 	}
+	if segment.cipher != nil {
+		if bytes, err = segment.cipher.open(bytes); err != nil {
+			return nil, err
+		}
+	}
 	storedEntry := decode(bytes)
+	if storedEntry.Compressed {
+		value, err := segment.decompress(storedEntry.Value)
+		if err != nil {
+			return nil, err
+		}
+		storedEntry.Value, storedEntry.Compressed = value, false
+	}
 	return storedEntry, nil
 }
 
+// valueReader returns an io.ReadCloser of the value of the entry at the offset, without reading the value in memory: only the header and the tombstone byte are read,
+// and the value is read from a section of the segment file. The value of an encrypted or a compressed entry is read (and decrypted or decompressed) in memory.
+// If the entry holds a BlobReference, valueReader returns the BlobReference instead, and the value is read from the blob segment.
+func (segment *Segment[Key]) valueReader(offset int64, size uint32) (io.ReadCloser, *BlobReference, error) {
+	if segment.cipher == nil {
+		tombstone, err := segment.store.read(offset+int64(size-tombstoneMarkerSize), tombstoneMarkerSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tombstone[0]&(blobReferenceMarker|compressedMarker) == 0 {
+			header, err := segment.store.read(offset, headerSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			_, keySize, valueSize := decodeHeader(header)
+			reader, err := segment.store.sectionReader(offset+int64(headerSize+keySize), int64(valueSize-tombstoneMarkerSize))
+			return reader, nil, err
+		}
+	}
+	storedEntry, err := segment.read(offset, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if storedEntry.Blob != nil {
+		return nil, storedEntry.Blob, nil
+	}
+	return io.NopCloser(bytes.NewReader(storedEntry.Value)), nil, nil
+}
+
 // ReadFull performs a full read of the segment file. This method is called by the reload operation that happens during DB start-up
+// The encrypted entries are decrypted and the compressed values are decompressed transparently, and the tombstones of the segment are counted.
+// If the segment ends with a partial entry, ReadFull returns the complete entries along with a CorruptSegmentError caused by ErrTruncatedEntry,
+// whose Offset is the end of the last complete entry, refer to Segments.TruncatePartialTail
 func (segment *Segment[Key]) ReadFull(keyMapper func([]byte) Key) ([]*MappedStoredEntry[Key], error) {
 	bytes, err := segment.store.readFull()
 	if err != nil {
 		return nil, err
 	}
-	storedEntries := decodeMulti(bytes, keyMapper)
-	return storedEntries, nil
+	var storedEntries []*MappedStoredEntry[Key]
+	var decodeErr error
+	if segment.cipher != nil {
+		storedEntries, decodeErr = segment.openMulti(bytes, keyMapper)
+	} else {
+		storedEntries, decodeErr = decodeMulti(bytes, keyMapper)
+	}
+	var corruptSegmentError *CorruptSegmentError
+	if errors.As(decodeErr, &corruptSegmentError) {
+		corruptSegmentError.FilePath = segment.filePath
+	}
+	if decodeErr != nil && !errors.Is(decodeErr, ErrTruncatedEntry) {
+		return nil, decodeErr
+	}
+	var tombstones int64
+	for _, storedEntry := range storedEntries {
+		if storedEntry.Deleted {
+			tombstones = tombstones + 1
+		}
+		if storedEntry.Compressed {
+			value, err := segment.decompress(storedEntry.Value)
+			if err != nil {
+				return nil, err
+			}
+			storedEntry.Value, storedEntry.Compressed = value, false
+		}
+	}
+	segment.tombstones.Store(tombstones)
+	return storedEntries, decodeErr
+}
+
+// Iterator returns a SegmentIterator that reads the entries of the segment file one at a time. This method is called during merge
+func (segment *Segment[Key]) Iterator(keyMapper func([]byte) Key) (*SegmentIterator[Key], error) {
+	return newSegmentIterator[Key](segment.filePath, keyMapper, segment.cipher)
+}
+
+// openMulti decrypts and decodes all the records of an encrypted segment. The KeyOffset and the EntryLength of an entry identify its record.
+// A partial record at the end of the segment returns a CorruptSegmentError along with the entries of the complete records, like decodeMulti
+func (segment *Segment[Key]) openMulti(content []byte, keyMapper func([]byte) Key) ([]*MappedStoredEntry[Key], error) {
+	contentLength := uint32(len(content))
+	var offset uint32 = 0
+
+	decodeKey := config.KeyDecoderOf(keyMapper)
+	var entries []*MappedStoredEntry[Key]
+	for offset < contentLength {
+		recordLength, err := recordLengthAt(content, offset)
+		if err != nil {
+			return entries, &CorruptSegmentError{FilePath: segment.filePath, Offset: int64(offset), Err: err}
+		}
+		encoded, err := segment.cipher.open(content[offset : offset+recordLength])
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entryLengthAt(encoded, 0); err != nil {
+			return nil, &CorruptSegmentError{FilePath: segment.filePath, Offset: int64(offset), Err: err}
+		}
+		entry, _ := decodeFrom(encoded, 0)
+		key, err := decodeKey(entry.Key)
+		if err != nil {
+			return nil, &CorruptSegmentError{FilePath: segment.filePath, Offset: int64(offset), Err: err}
+		}
+		entries = append(entries, &MappedStoredEntry[Key]{
+			Key:         key,
+			Bucket:      entry.Bucket,
+			Value:       entry.Value,
+			Deleted:     entry.Deleted,
+			Blob:        entry.Blob,
+			Compressed:  entry.Compressed,
+			Timestamp:   entry.Timestamp,
+			KeyOffset:   offset,
+			EntryLength: recordLength,
+		})
+		offset = offset + recordLength
+	}
+	return entries, nil
+}
+
+// completeLength returns the length of the segment file up to the end of its last complete entry (or its last complete record if the segment is encrypted).
+// A crash during an append may leave a partial entry at the end of the segment file, which is excluded. It returns a CorruptSegmentError if an entry is malformed.
+// Refer to Segments.truncatePartialTail
+func (segment *Segment[Key]) completeLength() (int64, error) {
+	content, err := segment.store.readFull()
+	if err != nil {
+		return 0, err
+	}
+	contentLength := uint32(len(content))
+	var offset uint32 = 0
+	for offset < contentLength {
+		var length uint32
+		if segment.cipher != nil {
+			length, err = recordLengthAt(content, offset)
+		} else {
+			length, err = entryLengthAt(content, offset)
+		}
+		if errors.Is(err, ErrTruncatedEntry) {
+			break
+		}
+		if err != nil {
+			return 0, &CorruptSegmentError{FilePath: segment.filePath, Offset: int64(offset), Err: err}
+		}
+		offset = offset + length
+	}
+	return int64(offset), nil
+}
+
+// truncate truncates the segment file to sizeInBytes, refer to Store.truncate
+func (segment *Segment[Key]) truncate(sizeInBytes int64) error {
+	return segment.store.truncate(sizeInBytes)
+}
+
+// reopenWrites reopens a reloaded segment for appending, refer to Store.reopenWrites
+func (segment *Segment[Key]) reopenWrites() error {
+	return segment.store.reopenWrites()
+}
+
+// KeyId returns the id of the key that encrypts the segment, and false if the segment is not encrypted
+func (segment *Segment[Key]) KeyId() (uint32, bool) {
+	if segment.cipher == nil {
+		return 0, false
+	}
+	return segment.cipher.keyId, true
+}
+
+// FileId returns the fileId of the segment
+func (segment *Segment[Key]) FileId() uint64 {
+	return segment.fileId
+}
+
+// SizeInBytes returns the segment file size in bytes
+func (segment *Segment[Key]) SizeInBytes() int64 {
+	return segment.sizeInBytes()
+}
+
+// Tombstones returns the number of tombstones (deleted entries) in the segment. The tombstones of a reloaded segment are known only once it is read in full, refer to ReadFull
+func (segment *Segment[Key]) Tombstones() int64 {
+	return segment.tombstones.Load()
+}
+
+// decompress decompresses the value with the compressor of the segment, or with config.FlateCompressor if the segment does not have a compressor
+func (segment *Segment[Key]) decompress(value []byte) ([]byte, error) {
+	if segment.compressor == nil {
+		return config.NewFlateCompressor(flate.DefaultCompression).Decompress(value)
+	}
+	return segment.compressor.Decompress(value)
 }
 
 // sizeInBytes returns the segment file size in bytes
@@ -110,6 +427,18 @@ func (segment *Segment[Key]) sizeInBytes() int64 {
 	return segment.store.sizeInBytes()
 }
 
+// canFit returns true if an entry of entryLength bytes can be appended without the segment exceeding maxSegmentSizeBytes.
+// An empty segment fits any entry, so an entry larger than the size threshold is written to a segment of its own
+func (segment *Segment[Key]) canFit(entryLength uint64, maxSegmentSizeBytes uint64) bool {
+	size := uint64(segment.sizeInBytes())
+	return size == 0 || size+entryLength <= maxSegmentSizeBytes
+}
+
+// preallocate preallocates the disk space of the segment file up to sizeInBytes, refer to Store.preallocate
+func (segment *Segment[Key]) preallocate(sizeInBytes uint64) {
+	segment.store.preallocate(int64(sizeInBytes))
+}
+
 // sync Performs a file sync, ensures all the disk blocks (or pages) at the Kernel page cache are flushed to the disk
 func (segment *Segment[Key]) sync() {
 	segment.store.sync()
@@ -125,17 +454,49 @@ func (segment *Segment[Key]) remove() {
 	segment.store.remove()
 }
 
-// createSegment creates a new segment file. Each segment file has a fixed name format. It is fileId_bitcask.data. FileId is the timestamp based on the clock provided.
-// FileId is generated by TimestampBasedFileIdGenerator
-func createSegment(fileId uint64, directory string) (string, error) {
-	filePath := segmentName(fileId, directory)
-	_, err := os.Create(filePath)
+// close Closes the read file pointer, refer to Store.close
+func (segment *Segment[Key]) close() {
+	segment.store.close()
+}
+
+// createSegment creates a new segment file. Each segment file has a fixed name format. It is fileId_bitcask.data (fileId_blob.data for a blob segment),
+// and the name of an encrypted segment file also contains the keyId, refer to segmentFileName.
+// FileId is the timestamp based on the clock provided. FileId is generated by TimestampBasedFileIdGenerator.
+// createSegment never overwrites an existing segment file, it returns an error (satisfying errors.Is(err, fs.ErrExist)) if the file exists
+func createSegment(filePath string) error {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return filePath, nil
+	return file.Close()
 }
 
 func segmentName(fileId uint64, directory string) string {
-	return path.Join(directory, fmt.Sprintf("%v_%v.%v", fileId, segmentFilePrefix, segmentFileSuffix))
+	return segmentFileName(fileId, segmentFilePrefix, nil, directory)
+}
+
+// segmentFileName returns the path of the segment file. The name of an encrypted segment file contains the id of the key that encrypts it: fileId_keyId_bitcask.data
+func segmentFileName(fileId uint64, prefix string, cipher *entryCipher, directory string) string {
+	if cipher != nil {
+		return path.Join(directory, fmt.Sprintf("%v_%v_%v.%v", fileId, cipher.keyId, prefix, segmentFileSuffix))
+	}
+	return path.Join(directory, fmt.Sprintf("%v_%v.%v", fileId, prefix, segmentFileSuffix))
+}
+
+// parseSegmentFileName parses the fileId from the name of a segment file and, if the segment file is encrypted, the id of the key that encrypts it.
+// It returns the fileId, the keyId and true if the segment file is encrypted
+func parseSegmentFileName(name string) (uint64, uint32, bool, error) {
+	parts := strings.Split(name, "_")
+	fileId, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(parts) < 3 {
+		return fileId, 0, false, nil
+	}
+	keyId, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return fileId, uint32(keyId), true, nil
 }
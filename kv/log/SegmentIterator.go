@@ -0,0 +1,133 @@
+package log
+
+import (
+	"bitcask/config"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const segmentIteratorBufferSize = 64 * 1024
+
+// SegmentIterator iterates over the entries of a segment file one entry at a time.
+// Unlike Segment.ReadFull, which reads the entire file in memory, SegmentIterator reads the file through a fixed size buffer,
+// so the memory used by the iterator is bounded by the buffer size and the size of the largest entry in the segment.
+// SegmentIterator opens its own file handle, so its buffered reads do not interfere with the reads performed by the Store.
+// SegmentIterator does not decompress the values, a merge copies the compressed values as is.
+type SegmentIterator[Key config.BitCaskKey] struct {
+	file      *os.File
+	reader    *bufio.Reader
+	decodeKey func([]byte) (Key, error)
+	cipher    *entryCipher
+	header    []byte
+	offset    uint32
+}
+
+// newSegmentIterator creates a new instance of SegmentIterator for the segment file identified by filePath
+// An encrypted segment is iterated one record at a time, and every record is decrypted with the cipher, refer to EntryCipher.go
+func newSegmentIterator[Key config.BitCaskKey](filePath string, keyMapper func([]byte) Key, cipher *entryCipher) (*SegmentIterator[Key], error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &SegmentIterator[Key]{
+		file:      file,
+		reader:    bufio.NewReaderSize(file, segmentIteratorBufferSize),
+		decodeKey: config.KeyDecoderOf(keyMapper),
+		cipher:    cipher,
+		header:    make([]byte, headerSize),
+		offset:    0,
+	}, nil
+}
+
+// Next returns the next entry of the segment. It returns io.EOF once all the entries have been read.
+// Next reads the header of the entry to get the key size and the value size, and then reads exactly those many bytes for the key and the value.
+// A segment file which ends in the middle of an entry results in an error, and a key of the wrong size results in a CorruptSegmentError, refer to config.KeyDecoderOf.
+func (iterator *SegmentIterator[Key]) Next() (*MappedStoredEntry[Key], error) {
+	if iterator.cipher != nil {
+		return iterator.nextRecord()
+	}
+	if _, err := io.ReadFull(iterator.reader, iterator.header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.New(fmt.Sprintf("Could not read the header of the entry at offset %v in %v, %v", iterator.offset, iterator.file.Name(), err))
+	}
+	timestamp, keySize, valueSize := decodeHeader(iterator.header)
+	if valueSize < tombstoneMarkerSize {
+		return nil, errors.New(fmt.Sprintf("Invalid value size %v of the entry at offset %v in %v", valueSize, iterator.offset, iterator.file.Name()))
+	}
+
+	content := make([]byte, keySize+valueSize)
+	if _, err := io.ReadFull(iterator.reader, content); err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not read the entry at offset %v in %v, %v", iterator.offset, iterator.file.Name(), err))
+	}
+
+	entryLength, value, tombstone := headerSize+keySize+valueSize, content[keySize:keySize+valueSize-tombstoneMarkerSize], content[keySize+valueSize-tombstoneMarkerSize]
+	bucket, serializedKey := decodeBucket(content[:keySize], tombstone)
+	key, err := iterator.decodeKey(serializedKey)
+	if err != nil {
+		return nil, &CorruptSegmentError{FilePath: iterator.file.Name(), Offset: int64(iterator.offset), Err: err}
+	}
+	entry := &MappedStoredEntry[Key]{
+		Key:         key,
+		Bucket:      bucket,
+		Value:       value,
+		Deleted:     tombstone&deletedMarker == deletedMarker,
+		Blob:        decodeBlobReferenceIfMarked(value, tombstone),
+		Compressed:  tombstone&compressedMarker == compressedMarker,
+		Timestamp:   timestamp,
+		KeyOffset:   iterator.offset,
+		EntryLength: entryLength,
+	}
+	iterator.offset = iterator.offset + entryLength
+	return entry, nil
+}
+
+// nextRecord returns the next entry of an encrypted segment. It reads the record_length to know how many bytes of the record follow it, and then decrypts the record.
+// KeyOffset and EntryLength of the entry identify its record.
+func (iterator *SegmentIterator[Key]) nextRecord() (*MappedStoredEntry[Key], error) {
+	recordLengthBytes := make([]byte, reservedRecordLengthSize)
+	if _, err := io.ReadFull(iterator.reader, recordLengthBytes); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errors.New(fmt.Sprintf("Could not read the length of the record at offset %v in %v, %v", iterator.offset, iterator.file.Name(), err))
+	}
+	recordLength := decodeRecordLength(recordLengthBytes)
+	record := make([]byte, recordLength)
+	copy(record, recordLengthBytes)
+	if _, err := io.ReadFull(iterator.reader, record[reservedRecordLengthSize:]); err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not read the record at offset %v in %v, %v", iterator.offset, iterator.file.Name(), err))
+	}
+	encoded, err := iterator.cipher.open(record)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not decrypt the record at offset %v in %v, %v", iterator.offset, iterator.file.Name(), err))
+	}
+
+	storedEntry, _ := decodeFrom(encoded, 0)
+	key, err := iterator.decodeKey(storedEntry.Key)
+	if err != nil {
+		return nil, &CorruptSegmentError{FilePath: iterator.file.Name(), Offset: int64(iterator.offset), Err: err}
+	}
+	entry := &MappedStoredEntry[Key]{
+		Key:         key,
+		Bucket:      storedEntry.Bucket,
+		Value:       storedEntry.Value,
+		Deleted:     storedEntry.Deleted,
+		Blob:        storedEntry.Blob,
+		Compressed:  storedEntry.Compressed,
+		Timestamp:   storedEntry.Timestamp,
+		KeyOffset:   iterator.offset,
+		EntryLength: recordLength,
+	}
+	iterator.offset = iterator.offset + recordLength
+	return entry, nil
+}
+
+// Close closes the file handle of the iterator
+func (iterator *SegmentIterator[Key]) Close() {
+	_ = iterator.file.Close()
+}
@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bitcask/config"
+	"compress/flate"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestIteratesOverASegment(t *testing.T) {
+	segment, _ := NewSegment[serializableKey](1, ".")
+	defer segment.remove()
+
+	_, _ = segment.append(NewEntry[serializableKey]("topic", []byte("microservices"), &FixedClock{}))
+	_, _ = segment.append(NewDeletedEntry[serializableKey]("disk", &FixedClock{}))
+	appendEntryResponse, _ := segment.append(NewEntry[serializableKey]("engine", []byte("bitcask"), &FixedClock{}))
+
+	iterator, _ := segment.Iterator(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	defer iterator.Close()
+
+	entry, _ := iterator.Next()
+	if entry.Key != "topic" || string(entry.Value) != "microservices" || entry.Deleted {
+		t.Fatalf("Expected entry to be %v:%v, received %v:%v", "topic", "microservices", entry.Key, string(entry.Value))
+	}
+	entry, _ = iterator.Next()
+	if entry.Key != "disk" || !entry.Deleted {
+		t.Fatalf("Expected entry of the key %v to be deleted, received %v, deleted %v", "disk", entry.Key, entry.Deleted)
+	}
+	entry, _ = iterator.Next()
+	if entry.Key != "engine" || string(entry.Value) != "bitcask" {
+		t.Fatalf("Expected entry to be %v:%v, received %v:%v", "engine", "bitcask", entry.Key, string(entry.Value))
+	}
+	if int64(entry.KeyOffset) != appendEntryResponse.Offset || entry.EntryLength != appendEntryResponse.EntryLength {
+		t.Fatalf("Expected offset and length to be %v:%v, received %v:%v", appendEntryResponse.Offset, appendEntryResponse.EntryLength, entry.KeyOffset, entry.EntryLength)
+	}
+	if entry.Timestamp != 100 {
+		t.Fatalf("Expected timestamp to be %v, received %v", 100, entry.Timestamp)
+	}
+	_, err := iterator.Next()
+	if err != io.EOF {
+		t.Fatalf("Expected io.EOF after the last entry, received %v", err)
+	}
+}
+
+func TestIteratesOverASegmentWithATruncatedEntry(t *testing.T) {
+	segment, _ := NewSegment[serializableKey](1, ".")
+	defer segment.remove()
+
+	_, _ = segment.append(NewEntry[serializableKey]("topic", []byte("microservices"), &FixedClock{}))
+	encoded := NewEntry[serializableKey]("engine", []byte("bitcask"), &FixedClock{}).encode()
+	_, _ = segment.store.append(encoded[:len(encoded)-2])
+
+	iterator, _ := segment.Iterator(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	defer iterator.Close()
+
+	_, _ = iterator.Next()
+	_, err := iterator.Next()
+	if err == nil || err == io.EOF {
+		t.Fatalf("Expected an error while reading a truncated entry, received %v", err)
+	}
+}
+
+func TestIteratesOverASegmentWithACompressedEntry(t *testing.T) {
+	segment, _ := NewSegment[serializableKey](1, ".")
+	defer segment.remove()
+
+	compressed, _ := config.NewFlateCompressor(flate.BestSpeed).Compress([]byte("microservices"))
+	_, _ = segment.append(NewEntry[serializableKey]("topic", compressed, &FixedClock{}).markCompressed())
+
+	iterator, _ := segment.Iterator(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	defer iterator.Close()
+
+	entry, _ := iterator.Next()
+	if !entry.Compressed || !reflect.DeepEqual(compressed, entry.Value) {
+		t.Fatalf("Expected the entry of the key %v to be iterated as compressed, received compressed %v", "topic", entry.Compressed)
+	}
+}
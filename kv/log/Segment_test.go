@@ -2,6 +2,9 @@ package log
 
 import (
 	"bitcask/clock"
+	"errors"
+	"io/fs"
+	"os"
 	"testing"
 )
 
@@ -145,3 +148,43 @@ func TestNewSegmentAfterStoppingWrites(t *testing.T) {
 		t.Fatalf("Expected error while writing to the segment after it was write closed but no error was received")
 	}
 }
+
+func TestNewSegmentDoesNotOverwriteAnExistingSegment(t *testing.T) {
+	segment, _ := NewSegment[serializableKey](10, ".")
+	defer func() {
+		segment.remove()
+	}()
+	_, _ = segment.append(NewEntry[serializableKey]("topic", []byte("microservices"), clock.NewSystemClock()))
+
+	_, err := NewSegment[serializableKey](10, ".")
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("Expected an error while creating an existing segment, received %v", err)
+	}
+	content, _ := os.ReadFile(segment.filePath)
+	if int64(len(content)) != segment.sizeInBytes() {
+		t.Fatalf("Expected the existing segment of %v bytes to remain intact, received %v bytes", segment.sizeInBytes(), len(content))
+	}
+}
+
+func TestSegmentCountsTheTombstones(t *testing.T) {
+	segment, _ := NewSegment[serializableKey](12, ".")
+	defer func() {
+		segment.remove()
+	}()
+
+	_, _ = segment.append(NewEntry[serializableKey]("topic", []byte("microservices"), clock.NewSystemClock()))
+	_, _ = segment.append(NewDeletedEntry[serializableKey]("topic", clock.NewSystemClock()))
+	_, _ = segment.append(NewDeletedEntry[serializableKey]("disk", clock.NewSystemClock()))
+
+	if segment.Tombstones() != 2 {
+		t.Fatalf("Expected %v tombstones, received %v", 2, segment.Tombstones())
+	}
+
+	reloaded, _ := ReloadInactiveSegment[serializableKey](12, ".")
+	_, _ = reloaded.ReadFull(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	if reloaded.Tombstones() != 2 {
+		t.Fatalf("Expected %v tombstones in the reloaded segment, received %v", 2, reloaded.Tombstones())
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"bitcask/clock"
 	"bitcask/config"
 	"bitcask/kv/log/id"
+	"bitcask/metrics"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
-	"strconv"
+	"path"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Segments[Key config.BitCaskKey] struct {
@@ -18,6 +23,45 @@ type Segments[Key config.BitCaskKey] struct {
 	clock               clock.Clock
 	maxSegmentSizeBytes uint64
 	directory           string
+	blobSegments        *BlobSegments[Key]
+	compressor          config.Compressor
+	keyProvider         config.KeyProvider
+	memoryMappedReads   bool
+	rawValueBytes       int64
+	storedValueBytes    int64
+	valueCache          *ValueCache
+	maxKeySizeBytes     uint64
+	maxValueSizeBytes   uint64
+	preallocateSegments bool
+	maxSegmentAge       time.Duration
+	activeSegmentSince  int64
+	metrics             *metrics.Metrics
+	eventListener       config.EventListener
+}
+
+// SegmentsOptions are the optional features of Segments.
+// BlobValueThresholdBytes enables key-value separation, the values larger than the threshold are written to blob segments (refer to BlobSegments.go), 0 disables it.
+// Compressor enables compression of the values, nil disables it.
+// KeyProvider enables encryption of the segments (and the blob segments), nil disables it. Refer to EntryCipher.go
+// ValueCacheBytes enables the cache of the recently read entries in front of Read, 0 disables it. Refer to ValueCache.go
+// MemoryMappedReads enables the reads of the inactive segments (and the inactive blob segments) from read-only memory mappings. Refer to Store.go
+// MaxKeySizeBytes and MaxValueSizeBytes limit the size of a serialized key and of a value, 0 limits them only by the encoding of an entry. Refer to EntrySizeError
+// PreallocateSegments enables the preallocation of the new segment files (and the new blob segment files) up to the segment size threshold. Refer to Preallocate.go
+// MaxSegmentAge enables the rollover of the active segment (and the active blob segment) once its first entry is older than MaxSegmentAge, 0 disables it. Refer to RolloverExpiredActiveSegments
+// Metrics records the rollovers of the active segment, nil disables it.
+// EventListener is notified of the rollovers and the removals of the segments and the blob segments, nil defaults to config.NoOpEventListener.
+type SegmentsOptions struct {
+	BlobValueThresholdBytes uint64
+	Compressor              config.Compressor
+	KeyProvider             config.KeyProvider
+	ValueCacheBytes         uint64
+	MemoryMappedReads       bool
+	MaxKeySizeBytes         uint64
+	MaxValueSizeBytes       uint64
+	PreallocateSegments     bool
+	MaxSegmentAge           time.Duration
+	Metrics                 *metrics.Metrics
+	EventListener           config.EventListener
 }
 
 type WriteBackResponse[K config.BitCaskKey] struct {
@@ -25,114 +69,412 @@ type WriteBackResponse[K config.BitCaskKey] struct {
 	AppendEntryResponse *AppendEntryResponse
 }
 
+// WriteBackWriter writes the merged entries to new inactive segments, one entry at a time.
+// A new inactive segment is created lazily on the first append, and a segment which has reached the size threshold is closed before the next append.
+type WriteBackWriter[Key config.BitCaskKey] struct {
+	segments        *Segments[Key]
+	segment         *Segment[Key]
+	segmentsWritten int
+	bytesWritten    int64
+}
+
 //NewSegments creates a new instance of Segments and reloads all the inactive segments during DB start-up
 func NewSegments[Key config.BitCaskKey](directory string, maxSegmentSizeBytes uint64, clock clock.Clock) (*Segments[Key], error) {
+	return NewSegmentsWithOptions[Key](directory, maxSegmentSizeBytes, clock, SegmentsOptions{})
+}
+
+//NewSegmentsWithOptions creates a new instance of Segments with the optional features identified by SegmentsOptions.
+//It reloads all the inactive segments and the blob segments during DB start-up, and truncates a partial entry left at the end of the newest segment by a crash
+func NewSegmentsWithOptions[Key config.BitCaskKey](directory string, maxSegmentSizeBytes uint64, clock clock.Clock, options SegmentsOptions) (*Segments[Key], error) {
+	if options.EventListener == nil {
+		options.EventListener = config.NoOpEventListener{}
+	}
 	fileIdGenerator := id.NewTimestampBasedFileIdGenerator(clock)
-	fileId := fileIdGenerator.Next()
-	activeSegment, err := NewSegment[Key](fileId, directory)
+	blobSegments, err := newBlobSegments[Key](directory, maxSegmentSizeBytes, options, clock, fileIdGenerator)
 	if err != nil {
 		return nil, err
 	}
-
 	segments := &Segments[Key]{
-		activeSegment:       activeSegment,
 		inactiveSegments:    make(map[uint64]*Segment[Key]),
 		fileIdGenerator:     fileIdGenerator,
 		clock:               clock,
 		maxSegmentSizeBytes: maxSegmentSizeBytes,
 		directory:           directory,
+		blobSegments:        blobSegments,
+		compressor:          options.Compressor,
+		keyProvider:         options.KeyProvider,
+		memoryMappedReads:   options.MemoryMappedReads,
+		maxKeySizeBytes:     options.MaxKeySizeBytes,
+		maxValueSizeBytes:   options.MaxValueSizeBytes,
+		preallocateSegments: options.PreallocateSegments,
+		maxSegmentAge:       options.MaxSegmentAge,
+		metrics:             options.Metrics,
+		eventListener:       options.EventListener,
+	}
+	if options.ValueCacheBytes > 0 {
+		segments.valueCache = NewValueCache(options.ValueCacheBytes)
 	}
 	if err := segments.reload(); err != nil {
 		return nil, err
 	}
+	activeSegment, err := segments.reuseActiveSegment()
+	if err != nil {
+		return nil, err
+	}
+	if activeSegment == nil {
+		if activeSegment, err = segments.nextSegment(); err != nil {
+			return nil, err
+		}
+	}
+	segments.activeSegment = activeSegment
+	segments.activeSegmentSince = clock.Now()
 	return segments, nil
 }
 
 //Append performs an append operation in the active segment file.
-//Before the append operation can be done, the size of the active segment is checked.
-//If its size < the size of segment threshold, the key value pair is appended to the active segment, else the active segment is rolled-over
+//Before the append operation can be done, the sizes of the key and the value are validated, and an EntrySizeError is returned if either exceeds its maximum size.
+//If the active segment can fit the entry within the size of segment threshold (and is not older than the max segment age), the key value pair is appended to the active segment, else the active segment is rolled-over
+//A value larger than the blob value threshold is appended to the active blob segment, and only the BlobReference is appended to the active segment
+//The value is compressed if a Compressor is configured and the compressed value is smaller than the value
 func (segments *Segments[Key]) Append(key Key, value []byte) (*AppendEntryResponse, error) {
-	if err := segments.maybeRolloverActiveSegment(); err != nil {
+	return segments.AppendInBucket(DefaultBucket, key, value)
+}
+
+//AppendInBucket performs an append operation of the key and the value in the bucket, refer to Append. The key of an entry in a bucket (other than the DefaultBucket)
+//is prefixed by the bucket, refer to Entry.inBucket
+func (segments *Segments[Key]) AppendInBucket(bucket uint32, key Key, value []byte) (*AppendEntryResponse, error) {
+	keySize, err := segments.validate(bucket, key, uint64(len(value)))
+	if err != nil {
+		return nil, err
+	}
+	storedValue, compressed, err := segments.compress(value)
+	if err != nil {
+		return nil, err
+	}
+	if segments.blobSegments.shouldSeparate(uint64(len(value))) {
+		reference, err := segments.blobSegments.Append(bucket, key, storedValue, compressed)
+		if err != nil {
+			return nil, err
+		}
+		segments.countValueBytes(value, storedValue)
+		return segments.AppendBlobReference(bucket, key, reference, 0)
+	}
+	if err := segments.maybeRolloverActiveSegment(segments.entryLength(keySize, uint64(len(storedValue)))); err != nil {
+		return nil, err
+	}
+	entry := NewEntry[Key](key, storedValue, segments.clock).inBucket(bucket)
+	if compressed {
+		entry.markCompressed()
+	}
+	appendEntryResponse, err := segments.activeSegment.append(entry)
+	if err != nil {
 		return nil, err
 	}
-	return segments.activeSegment.append(NewEntry[Key](key, value, segments.clock))
+	segments.countValueBytes(value, storedValue)
+	return appendEntryResponse, nil
+}
+
+//ValueBytes returns the total size of the values appended since Segments was created, before (raw) and after (stored) compression
+func (segments *Segments[Key]) ValueBytes() (int64, int64) {
+	return segments.rawValueBytes, segments.storedValueBytes
+}
+
+//AppendBlobReference performs an append operation of the BlobReference of the key in the bucket in the active segment file, keeping the provided timestamp (0 uses the clock).
+//This method is also invoked during the garbage collection of blob segments to point the key to the new position of its blob entry
+func (segments *Segments[Key]) AppendBlobReference(bucket uint32, key Key, reference *BlobReference, ts uint32) (*AppendEntryResponse, error) {
+	if err := segments.maybeRolloverActiveSegment(segments.entryLength(serializedKeySize(bucket, key.Serialize()), uint64(blobReferenceSize))); err != nil {
+		return nil, err
+	}
+	appendEntryResponse, err := segments.activeSegment.append(NewBlobReferenceEntryPreservingTimestamp[Key](key, reference, ts, segments.clock).inBucket(bucket))
+	if err != nil {
+		return nil, err
+	}
+	appendEntryResponse.Blob = reference
+	return appendEntryResponse, nil
 }
 
 //AppendDeleted performs an append operation in the active segment file. Even the `delete` is an append operation in the log file.
 //The key will eventually be removed during the merge operation
 func (segments *Segments[Key]) AppendDeleted(key Key) (*AppendEntryResponse, error) {
-	if err := segments.maybeRolloverActiveSegment(); err != nil {
+	return segments.AppendDeletedInBucket(DefaultBucket, key)
+}
+
+//AppendDeletedInBucket performs an append operation of the deleted key in the bucket, refer to AppendDeleted
+func (segments *Segments[Key]) AppendDeletedInBucket(bucket uint32, key Key) (*AppendEntryResponse, error) {
+	keySize, err := segments.validate(bucket, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := segments.maybeRolloverActiveSegment(segments.entryLength(keySize, 0)); err != nil {
 		return nil, err
 	}
-	return segments.activeSegment.append(NewDeletedEntry[Key](key, segments.clock))
+	return segments.activeSegment.append(NewDeletedEntry[Key](key, segments.clock).inBucket(bucket))
 }
 
 //Read performs a read operation from the offset in the segment file. This method is invoked in the Get operation
+//If the entry holds a BlobReference, the value is read from the blob segment
+//If the ValueCache is enabled, the entry is served from the cache if it was read recently, else it is cached after the read
 func (segments *Segments[Key]) Read(fileId uint64, offset int64, size uint32) (*StoredEntry, error) {
-	if fileId == segments.activeSegment.fileId {
-		return segments.activeSegment.read(offset, size)
+	var buffer []byte
+	return segments.ReadInto(fileId, offset, size, &buffer)
+}
+
+//ReadInto performs the Read operation into the buffer, which is replaced with a larger one if its capacity is not sufficient. This method is invoked in the GetInto and the View operations
+//to reuse the buffers across reads. The key and the value of the returned StoredEntry may be slices of the buffer (or of a memory mapping, refer to Store.go),
+//so they are valid only until the buffer is reused, and only as long as the caller holds the read lock of KVStore.
+//The entry of a BlobReference is read into the same buffer because the BlobReference is decoded before the blob entry is read.
+func (segments *Segments[Key]) ReadInto(fileId uint64, offset int64, size uint32, buffer *[]byte) (*StoredEntry, error) {
+	if segments.valueCache != nil {
+		if storedEntry, ok := segments.valueCache.Get(fileId, offset); ok {
+			return storedEntry, nil
+		}
 	}
-	segment, ok := segments.inactiveSegments[fileId]
-	if ok {
-		return segment.read(offset, size)
+	storedEntry, err := segments.readEntryInto(fileId, offset, size, buffer)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New(fmt.Sprintf("Invalid file id %v", fileId))
+	if storedEntry.Blob != nil {
+		blobEntry, err := segments.blobSegments.readInto(storedEntry.Blob, buffer)
+		if err != nil {
+			return nil, err
+		}
+		storedEntry.Key, storedEntry.Value = blobEntry.Key, blobEntry.Value
+	}
+	if segments.valueCache != nil {
+		segments.valueCache.Put(fileId, offset, storedEntry)
+	}
+	return storedEntry, nil
+}
+
+//ValueReader returns an io.ReadCloser of the value of the entry at the offset in the segment file, without reading the value in memory. This method is invoked in the GetReader operation.
+//If the entry holds a BlobReference, the value is read from the blob segment. Refer to Segment.valueReader
+func (segments *Segments[Key]) ValueReader(fileId uint64, offset int64, size uint32) (io.ReadCloser, error) {
+	segment, err := segments.segmentOf(fileId)
+	if err != nil {
+		return nil, err
+	}
+	reader, reference, err := segment.valueReader(offset, size)
+	if err != nil {
+		return nil, err
+	}
+	if reference != nil {
+		return segments.blobSegments.valueReader(reference)
+	}
+	return reader, nil
+}
+
+//ValueCache returns the cache of the recently read entries, nil if the cache is not enabled
+func (segments *Segments[Key]) ValueCache() *ValueCache {
+	return segments.valueCache
+}
+
+//BlobSegments returns the blob segments
+func (segments *Segments[Key]) BlobSegments() *BlobSegments[Key] {
+	return segments.blobSegments
 }
 
 // ReadInactiveSegments reads inactive segments identified by `totalSegments`. This operation is performed during merge.
+// The segments are picked in the increasing order of their fileIds (oldest first). If there are fewer inactive segments than `totalSegments`,
+// all the inactive segments are read, so the returned slices never contain nil holes.
 // keyMapper is used to map a byte slice Key to a generically typed Key. keyMapper is basically a means to perform deserialization of keys which is necessary to update the state in KeyDirectory after the merge operation is done, more on this is mentioned in KeyDirectory.go
 func (segments *Segments[Key]) ReadInactiveSegments(totalSegments int, keyMapper func([]byte) Key) ([]uint64, [][]*MappedStoredEntry[Key], error) {
-	index := 0
-	contents, fileIds := make([][]*MappedStoredEntry[Key], totalSegments), make([]uint64, totalSegments)
-	for _, segment := range segments.inactiveSegments {
-		if index >= totalSegments {
-			break
+	fileIds := segments.InactiveSegmentIds()
+	if totalSegments < len(fileIds) {
+		fileIds = fileIds[:totalSegments]
+	}
+	return segments.ReadSegments(fileIds, keyMapper)
+}
+
+// ReadAllInactiveSegments reads all the inactive segments. This operation is performed during merge.
+// keyMapper is used to map a byte slice Key to a generically typed Key. keyMapper is basically a means to perform deserialization of keys which is necessary to update the state in KeyDirectory after the merge operation is done, more on this is mentioned in KeyDirectory.go and Worker.go inside merge/ package.
+func (segments *Segments[Key]) ReadAllInactiveSegments(keyMapper func([]byte) Key) ([]uint64, [][]*MappedStoredEntry[Key], error) {
+	return segments.ReadInactiveSegments(len(segments.inactiveSegments), keyMapper)
+}
+
+// ReadSegments reads the inactive segments identified by `fileIds`, in the order of the `fileIds`. It returns an error if any of the fileIds does not identify an inactive segment.
+func (segments *Segments[Key]) ReadSegments(fileIds []uint64, keyMapper func([]byte) Key) ([]uint64, [][]*MappedStoredEntry[Key], error) {
+	contents := make([][]*MappedStoredEntry[Key], len(fileIds))
+	for index, fileId := range fileIds {
+		segment, ok := segments.inactiveSegments[fileId]
+		if !ok {
+			return nil, nil, errors.New(fmt.Sprintf("Invalid inactive file id %v", fileId))
 		}
 		entries, err := segment.ReadFull(keyMapper)
 		if err != nil {
 			return nil, nil, err
 		}
 		contents[index] = entries
-		fileIds[index] = segment.fileId
-		index = index + 1
 	}
 	return fileIds, contents, nil
 }
 
-// ReadAllInactiveSegments reads all the inactive segments. This operation is performed during merge.
-// keyMapper is used to map a byte slice Key to a generically typed Key. keyMapper is basically a means to perform deserialization of keys which is necessary to update the state in KeyDirectory after the merge operation is done, more on this is mentioned in KeyDirectory.go and Worker.go inside merge/ package.
-func (segments *Segments[Key]) ReadAllInactiveSegments(keyMapper func([]byte) Key) ([]uint64, [][]*MappedStoredEntry[Key], error) {
-	return segments.ReadInactiveSegments(len(segments.inactiveSegments), keyMapper)
+// InactiveSegmentIds returns the fileIds of all the inactive segments in the increasing order (oldest first)
+func (segments *Segments[Key]) InactiveSegmentIds() []uint64 {
+	fileIds := make([]uint64, 0, len(segments.inactiveSegments))
+	for fileId := range segments.inactiveSegments {
+		fileIds = append(fileIds, fileId)
+	}
+	sort.Slice(fileIds, func(i, j int) bool {
+		return fileIds[i] < fileIds[j]
+	})
+	return fileIds
+}
+
+// InactiveSegmentSizes returns the size in bytes of all the inactive segments, keyed by fileId
+func (segments *Segments[Key]) InactiveSegmentSizes() map[uint64]int64 {
+	sizes := make(map[uint64]int64, len(segments.inactiveSegments))
+	for fileId, segment := range segments.inactiveSegments {
+		sizes[fileId] = segment.sizeInBytes()
+	}
+	return sizes
 }
 
 // WriteBack writes back the changes (merged changes) to new inactive segments. This operation is performed during merge.
 // It writes all the changes into M new inactive segments and once those changes are written to the new inactive segment(s), the state of the keys present in the `changes` parameter is updated in the KeyDirectory. More on this is mentioned in Worker.go inside merge/ package.
 func (segments *Segments[Key]) WriteBack(changes map[Key]*MappedStoredEntry[Key]) ([]*WriteBackResponse[Key], error) {
-	segment, err := NewSegment[Key](segments.fileIdGenerator.Next(), segments.directory)
-	if err != nil {
-		return nil, err
-	}
-	segments.inactiveSegments[segment.fileId] = segment
+	writer := segments.NewWriteBackWriter()
+	defer writer.Close()
 
 	index, writeBackResponses := 0, make([]*WriteBackResponse[Key], len(changes))
 	for key, value := range changes {
-		appendEntryResponse, err := segment.append(NewEntryPreservingTimestamp(key, value.Value, value.Timestamp, segments.clock))
+		writeBackResponse, err := writer.Append(key, value)
 		if err != nil {
 			return nil, err
 		}
-		writeBackResponses[index] = &WriteBackResponse[Key]{Key: key, AppendEntryResponse: appendEntryResponse}
+		writeBackResponses[index] = writeBackResponse
 		index = index + 1
+	}
+	return writeBackResponses, nil
+}
 
-		newSegment, err := segments.maybeRolloverSegment(segment)
-		if err != nil {
+// Iterator returns a SegmentIterator over the inactive segment identified by fileId. This operation is performed during merge.
+func (segments *Segments[Key]) Iterator(fileId uint64, keyMapper func([]byte) Key) (*SegmentIterator[Key], error) {
+	segment, ok := segments.inactiveSegments[fileId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Invalid inactive file id %v", fileId))
+	}
+	return segment.Iterator(keyMapper)
+}
+
+// NewWriteBackWriter creates a new instance of WriteBackWriter which writes the merged entries to new inactive segments
+func (segments *Segments[Key]) NewWriteBackWriter() *WriteBackWriter[Key] {
+	return &WriteBackWriter[Key]{segments: segments}
+}
+
+// ShouldRollover returns true if the writer does not have a segment yet, or if its current segment can not fit the entry within the size threshold.
+// The length of the entry is an upper bound, an uncompressed value may be compressed when it is written back, refer to entryOf
+func (writer *WriteBackWriter[Key]) ShouldRollover(key Key, entry *MappedStoredEntry[Key]) bool {
+	if writer.segment == nil {
+		return true
+	}
+	entryLength := writer.segments.entryLength(serializedKeySize(entry.Bucket, key.Serialize()), writeBackValueSize(entry))
+	return !writer.segment.canFit(entryLength, writer.segments.maxSegmentSizeBytes)
+}
+
+// Rollover closes the current segment of the writer, creates a new inactive segment and rolls over the active segment.
+// Rollover changes the state of Segments, so it must be invoked with the exclusive lock of KVStore held.
+//
+// Every time the writer creates a new segment, the active segment is rolled over. Reload reads the segments in the increasing order of their fileIds
+// and the entry in a later segment wins, so a merged segment must be older than any segment receiving the writes made after the merge has copied an entry.
+// Assume K1 is copied to the merged segment F3 and K1 is updated later. Without the rollover, the update would go to the active segment F2 (older than F3)
+// and the stale value in F3 would win on reload. With the rollover, the update goes to a new active segment F4 and wins on reload.
+func (writer *WriteBackWriter[Key]) Rollover() error {
+	writer.Close()
+	segment, err := writer.segments.nextSegment()
+	if err != nil {
+		return err
+	}
+	writer.segments.inactiveSegments[segment.fileId] = segment
+	writer.segment = segment
+	writer.segmentsWritten = writer.segmentsWritten + 1
+	return writer.segments.rolloverActiveSegment()
+}
+
+// Append appends the key and the value of the entry (or a tombstone if the entry is deleted), preserving its timestamp, to the current inactive segment of the writer.
+// An entry holding a BlobReference is written back with the same BlobReference, so the value in the blob segment is never rewritten by the merge.
+// The new segments are added to the inactive segments, so they are readable as soon as the KeyDirectory points to them.
+// Append performs a Rollover if ShouldRollover returns true. If the caller has already performed the Rollover, Append writes only to the
+// segment file of the writer and does not need the lock of KVStore.
+func (writer *WriteBackWriter[Key]) Append(key Key, entry *MappedStoredEntry[Key]) (*WriteBackResponse[Key], error) {
+	if writer.ShouldRollover(key, entry) {
+		if err := writer.Rollover(); err != nil {
 			return nil, err
 		}
-		if newSegment != nil {
-			segments.inactiveSegments[newSegment.fileId] = newSegment
-			segment = newSegment
-		}
 	}
-	return writeBackResponses, nil
+	logEntry, err := writer.entryOf(key, entry)
+	if err != nil {
+		return nil, err
+	}
+	appendEntryResponse, err := writer.segment.append(logEntry)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Deleted {
+		appendEntryResponse.Blob = entry.Blob
+	}
+	writer.bytesWritten = writer.bytesWritten + int64(appendEntryResponse.EntryLength)
+	return &WriteBackResponse[Key]{Key: key, AppendEntryResponse: appendEntryResponse}, nil
+}
+
+// entryOf creates the Entry to write back, in the bucket of the entry. A compressed value is written back as is, whereas an uncompressed value (read by Segment.ReadFull) is compressed
+// if the Segments has a Compressor
+func (writer *WriteBackWriter[Key]) entryOf(key Key, entry *MappedStoredEntry[Key]) (*Entry[Key], error) {
+	if entry.Deleted {
+		return NewDeletedEntryPreservingTimestamp(key, entry.Timestamp, writer.segments.clock).inBucket(entry.Bucket), nil
+	}
+	if entry.Blob != nil {
+		return NewBlobReferenceEntryPreservingTimestamp(key, entry.Blob, entry.Timestamp, writer.segments.clock).inBucket(entry.Bucket), nil
+	}
+	if entry.Compressed {
+		return NewEntryPreservingTimestamp(key, entry.Value, entry.Timestamp, writer.segments.clock).markCompressed().inBucket(entry.Bucket), nil
+	}
+	value, compressed, err := writer.segments.compress(entry.Value)
+	if err != nil {
+		return nil, err
+	}
+	logEntry := NewEntryPreservingTimestamp(key, value, entry.Timestamp, writer.segments.clock).inBucket(entry.Bucket)
+	if compressed {
+		logEntry.markCompressed()
+	}
+	return logEntry, nil
+}
+
+// writeBackValueSize returns the size of the value which is written back for the entry: no value for a tombstone, the encoded BlobReference for a blob entry
+// and the stored value otherwise
+func writeBackValueSize[Key config.BitCaskKey](entry *MappedStoredEntry[Key]) uint64 {
+	if entry.Deleted {
+		return 0
+	}
+	if entry.Blob != nil {
+		return uint64(blobReferenceSize)
+	}
+	return uint64(len(entry.Value))
+}
+
+// SegmentsWritten returns the number of new inactive segments created by the writer
+func (writer *WriteBackWriter[Key]) SegmentsWritten() int {
+	return writer.segmentsWritten
+}
+
+// BytesWritten returns the number of bytes appended by the writer
+func (writer *WriteBackWriter[Key]) BytesWritten() int64 {
+	return writer.bytesWritten
+}
+
+// Sync performs a file sync of the current inactive segment of the writer
+func (writer *WriteBackWriter[Key]) Sync() {
+	if writer.segment != nil {
+		writer.segment.sync()
+	}
+}
+
+// Close syncs and closes the write file pointer of the current inactive segment of the writer
+func (writer *WriteBackWriter[Key]) Close() {
+	if writer.segment != nil {
+		writer.segment.sync()
+		writer.segment.stopWrites()
+		writer.segment = nil
+	}
 }
 
 //RemoveActive removes the active segment file from disk
@@ -140,11 +482,12 @@ func (segments *Segments[Key]) RemoveActive() {
 	segments.activeSegment.remove()
 }
 
-//RemoveAllInactive removes all the inactive segment files from disk
+//RemoveAllInactive removes all the inactive segment files and all the blob segment files from disk
 func (segments *Segments[Key]) RemoveAllInactive() {
 	for _, segment := range segments.inactiveSegments {
 		segment.remove()
 	}
+	segments.blobSegments.removeAll()
 }
 
 //Remove removes all the inactive files identified by fileIds. This operation is called from WriteBack of KVStore which is called during merge operation
@@ -154,10 +497,50 @@ func (segments *Segments[Key]) Remove(fileIds []uint64) {
 		if ok {
 			segment.remove()
 			delete(segments.inactiveSegments, fileId)
+			segments.eventListener.SegmentRemoved(config.SegmentRemovalEvent{FileId: fileId, Reason: config.SegmentMerged})
 		}
 	}
 }
 
+// HasInactiveSegmentOlderThan returns true if there is an inactive segment with a fileId smaller than the provided fileId
+func (segments *Segments[Key]) HasInactiveSegmentOlderThan(fileId uint64) bool {
+	for inactiveFileId := range segments.inactiveSegments {
+		if inactiveFileId < fileId {
+			return true
+		}
+	}
+	return false
+}
+
+//CurrentKeyId returns the id of the current key of the KeyProvider, and false if Segments does not have a KeyProvider
+func (segments *Segments[Key]) CurrentKeyId() (uint32, bool) {
+	if segments.keyProvider == nil {
+		return 0, false
+	}
+	return segments.keyProvider.CurrentKeyId(), true
+}
+
+//SegmentsToReload returns the fileIds of the inactive segments and of the active segment (unless it is empty) in the increasing order, along with the segments and their sizes keyed by fileId.
+//The active segment is not empty at start-up only if the previous active segment is reused, refer to reuseActiveSegment. This operation is performed during start-up to reload the KeyDirectory.
+func (segments *Segments[Key]) SegmentsToReload() ([]uint64, map[uint64]*Segment[Key], map[uint64]int64) {
+	fileIds, sizes := segments.InactiveSegmentIds(), segments.InactiveSegmentSizes()
+	segmentsByFileId := make(map[uint64]*Segment[Key], len(fileIds)+1)
+	for fileId, segment := range segments.inactiveSegments {
+		segmentsByFileId[fileId] = segment
+	}
+	if segments.activeSegment.sizeInBytes() > 0 {
+		fileIds = append(fileIds, segments.activeSegment.fileId)
+		segmentsByFileId[segments.activeSegment.fileId] = segments.activeSegment
+		sizes[segments.activeSegment.fileId] = segments.activeSegment.sizeInBytes()
+	}
+	return fileIds, segmentsByFileId, sizes
+}
+
+//ActiveSegment returns the active segment, nil after Shutdown
+func (segments *Segments[Key]) ActiveSegment() *Segment[Key] {
+	return segments.activeSegment
+}
+
 //AllInactiveSegments returns all the inactive segments
 func (segments *Segments[Key]) AllInactiveSegments() map[uint64]*Segment[Key] {
 	return segments.inactiveSegments
@@ -165,36 +548,115 @@ func (segments *Segments[Key]) AllInactiveSegments() map[uint64]*Segment[Key] {
 
 //Sync Performs a file sync, ensures all the disk blocks (or pages) at the Kernel page cache are flushed to the disk
 func (segments *Segments[Key]) Sync() {
-	segments.activeSegment.sync()
+	segments.SyncActive()
 	for _, segment := range segments.inactiveSegments {
 		segment.sync()
 	}
 }
 
-//Shutdown sets the active segment to nil and deletes all the keys from the inactive segments
+//SyncActive Performs a file sync of the active segment and the active blob segment
+func (segments *Segments[Key]) SyncActive() {
+	segments.activeSegment.sync()
+	segments.blobSegments.sync()
+}
+
+//Shutdown sets the active segment to nil and deletes all the keys from the inactive segments and the blob segments
 func (segments *Segments[Key]) Shutdown() {
 	segments.activeSegment = nil
 	for fileId, _ := range segments.inactiveSegments {
 		delete(segments.inactiveSegments, fileId)
 	}
+	segments.blobSegments.shutdown()
+}
+
+func (segments *Segments[Key]) readEntryInto(fileId uint64, offset int64, size uint32, buffer *[]byte) (*StoredEntry, error) {
+	segment, err := segments.segmentOf(fileId)
+	if err != nil {
+		return nil, err
+	}
+	return segment.readInto(offset, size, buffer)
 }
 
-func (segments *Segments[Key]) maybeRolloverActiveSegment() error {
-	newSegment, err := segments.maybeRolloverSegment(segments.activeSegment)
+func (segments *Segments[Key]) segmentOf(fileId uint64) (*Segment[Key], error) {
+	if fileId == segments.activeSegment.fileId {
+		return segments.activeSegment, nil
+	}
+	segment, ok := segments.inactiveSegments[fileId]
+	if ok {
+		return segment, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Invalid file id %v", fileId))
+}
+
+// maybeRolloverActiveSegment rolls over the active segment if it can not fit an entry of entryLength bytes within the size threshold, or if it has expired.
+// The age of the active segment is counted from the append of its first entry, refer to hasActiveSegmentExpired
+func (segments *Segments[Key]) maybeRolloverActiveSegment(entryLength uint64) error {
+	if segments.hasActiveSegmentExpired() {
+		if err := segments.rolloverActiveSegment(); err != nil {
+			return err
+		}
+	}
+	newSegment, err := segments.maybeRolloverSegment(segments.activeSegment, entryLength)
 	if err != nil {
 		return err
 	}
 	if newSegment != nil {
 		segments.inactiveSegments[segments.activeSegment.fileId] = segments.activeSegment
+		segments.eventListener.SegmentRolledOver(config.SegmentRolloverEvent{FileId: segments.activeSegment.fileId, SizeInBytes: segments.activeSegment.sizeInBytes()})
 		segments.activeSegment = newSegment
+		segments.metrics.SegmentRolledOver()
+	}
+	if segments.activeSegment.sizeInBytes() == 0 {
+		segments.activeSegmentSince = segments.clock.Now()
 	}
 	return nil
 }
 
-func (segments *Segments[Key]) maybeRolloverSegment(segment *Segment[Key]) (*Segment[Key], error) {
-	if segment.sizeInBytes() >= int64(segments.maxSegmentSizeBytes) {
+//RolloverExpiredActiveSegments rolls over the active segment and the active blob segment if they have expired, even if no write is being performed.
+//It returns true if the active segment is rolled over. This operation is invoked periodically by the kv.RolloverWorker and changes the state of Segments,
+//so it must be invoked with the exclusive lock of KVStore held. It does nothing after Shutdown
+func (segments *Segments[Key]) RolloverExpiredActiveSegments() (bool, error) {
+	if segments.activeSegment == nil {
+		return false, nil
+	}
+	segments.blobSegments.maybeRolloverExpiredActiveSegment()
+	if !segments.hasActiveSegmentExpired() {
+		return false, nil
+	}
+	return true, segments.rolloverActiveSegment()
+}
+
+// hasActiveSegmentExpired returns true if the max segment age is enabled and the first entry of the active segment is older than the max segment age.
+// An empty active segment never expires. The age of a reused active segment (refer to reuseActiveSegment) is counted from the start-up
+func (segments *Segments[Key]) hasActiveSegmentExpired() bool {
+	return segments.maxSegmentAge > 0 &&
+		segments.activeSegment.sizeInBytes() > 0 &&
+		segments.clock.Now()-segments.activeSegmentSince >= int64(segments.maxSegmentAge)
+}
+
+// rolloverActiveSegment unconditionally rolls over the active segment. An empty active segment is removed instead of becoming an inactive segment.
+func (segments *Segments[Key]) rolloverActiveSegment() error {
+	newSegment, err := segments.nextSegment()
+	if err != nil {
+		return err
+	}
+	segments.activeSegment.stopWrites()
+	if segments.activeSegment.sizeInBytes() == 0 {
+		segments.activeSegment.remove()
+		segments.eventListener.SegmentRemoved(config.SegmentRemovalEvent{FileId: segments.activeSegment.fileId, Reason: config.SegmentEmpty})
+	} else {
+		segments.inactiveSegments[segments.activeSegment.fileId] = segments.activeSegment
+		segments.eventListener.SegmentRolledOver(config.SegmentRolloverEvent{FileId: segments.activeSegment.fileId, SizeInBytes: segments.activeSegment.sizeInBytes()})
+	}
+	segments.activeSegment = newSegment
+	segments.metrics.SegmentRolledOver()
+	return nil
+}
+
+func (segments *Segments[Key]) maybeRolloverSegment(segment *Segment[Key], entryLength uint64) (*Segment[Key], error) {
+	if !segment.canFit(entryLength, segments.maxSegmentSizeBytes) {
 		segment.stopWrites()
-		newSegment, err := NewSegment[Key](segments.fileIdGenerator.Next(), segments.directory)
+		newSegment, err := segments.nextSegment()
 		if err != nil {
 			return nil, err
 		}
@@ -203,26 +665,163 @@ func (segments *Segments[Key]) maybeRolloverSegment(segment *Segment[Key]) (*Seg
 	return nil, nil
 }
 
+// nextSegment creates a new segment with the next fileId, encrypted with the current key if Segments has a KeyProvider, and preallocated if PreallocateSegments is enabled
+func (segments *Segments[Key]) nextSegment() (*Segment[Key], error) {
+	segment, err := newSegmentFile[Key](segments.fileIdGenerator.Next(), segmentFilePrefix, segments.directory, segments.compressor, segments.keyProvider, segments.memoryMappedReads)
+	if err != nil {
+		return nil, err
+	}
+	if segments.preallocateSegments {
+		segment.preallocate(segments.maxSegmentSizeBytes)
+	}
+	return segment, nil
+}
+
+// validate returns the size of the serialized key (including its bucket), or an EntrySizeError if the key or the value of valueSize bytes exceeds its maximum size.
+// The maximum key size applies to the serialized key without its bucket.
+// Irrespective of the configured maximum sizes, the length of an entry (and of its record, if encrypted) must fit in 32 bits, refer to Entry.go
+func (segments *Segments[Key]) validate(bucket uint32, key Key, valueSize uint64) (uint64, error) {
+	bucketSize := serializedKeySize(bucket, []byte{})
+	keySize := serializedKeySize(bucket, key.Serialize())
+	maxKeySize := math.MaxUint32 - segments.entryLength(bucketSize, 0)
+	if segments.maxKeySizeBytes > 0 && segments.maxKeySizeBytes < maxKeySize {
+		maxKeySize = segments.maxKeySizeBytes
+	}
+	if keySize-bucketSize > maxKeySize {
+		return 0, &EntrySizeError{Err: ErrKeyTooLarge, Size: keySize - bucketSize, MaxSize: maxKeySize}
+	}
+	maxValueSize := math.MaxUint32 - segments.entryLength(keySize, 0)
+	if segments.maxValueSizeBytes > 0 && segments.maxValueSizeBytes < maxValueSize {
+		maxValueSize = segments.maxValueSizeBytes
+	}
+	if valueSize > maxValueSize {
+		return 0, &EntrySizeError{Err: ErrValueTooLarge, Size: valueSize, MaxSize: maxValueSize}
+	}
+	return keySize, nil
+}
+
+// entryLength returns the number of bytes that an entry with a serialized key of keySize bytes and a value of valueSize bytes occupies in a segment
+func (segments *Segments[Key]) entryLength(keySize uint64, valueSize uint64) uint64 {
+	return encodedLength(keySize, valueSize, segments.keyProvider != nil)
+}
+
+// compress compresses the value if Segments has a Compressor. It returns the compressed value and true only if the compressed value is smaller than the value
+func (segments *Segments[Key]) compress(value []byte) ([]byte, bool, error) {
+	if segments.compressor == nil {
+		return value, false, nil
+	}
+	compressed, err := segments.compressor.Compress(value)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(compressed) >= len(value) {
+		return value, false, nil
+	}
+	return compressed, true, nil
+}
+
+// countValueBytes adds the size of the value before and after compression to the value bytes of Segments
+func (segments *Segments[Key]) countValueBytes(value []byte, storedValue []byte) {
+	segments.rawValueBytes = segments.rawValueBytes + int64(len(value))
+	segments.storedValueBytes = segments.storedValueBytes + int64(len(storedValue))
+}
+
+func (segments *Segments[Key]) countStreamedValueBytes(size int64) {
+	segments.rawValueBytes = segments.rawValueBytes + size
+	segments.storedValueBytes = segments.storedValueBytes + size
+}
+
+// reload reloads all the segment files as inactive segments, removes the empty segment files and the staging files left behind by a crash (refer to Stage),
+// and truncates the partial entry at the end of the newest segment, if any.
+// Refer to truncatePartialTail
 func (segments *Segments[Key]) reload() error {
 	entries, err := os.ReadDir(segments.directory)
 	if err != nil {
 		return err
 	}
-	suffix := segmentFilePrefix + "." + segmentFileSuffix
+	suffix, stagingSuffix := segmentFilePrefix+"."+segmentFileSuffix, stagingFilePrefix+"."+segmentFileSuffix
 	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), stagingSuffix) {
+			_ = os.Remove(path.Join(segments.directory, entry.Name()))
+			continue
+		}
 		if strings.HasSuffix(entry.Name(), suffix) {
-			fileId, err := strconv.ParseUint(strings.Split(entry.Name(), "_")[0], 10, 64)
+			segment, err := reloadSegmentFile[Key](entry.Name(), segments.directory, segments.compressor, segments.keyProvider, segments.memoryMappedReads)
 			if err != nil {
 				return err
 			}
-			if fileId != segments.activeSegment.fileId {
-				segment, err := ReloadInactiveSegment[Key](fileId, segments.directory)
-				if err != nil {
-					return err
-				}
-				segments.inactiveSegments[fileId] = segment
+			segments.fileIdGenerator.Observe(segment.fileId)
+			if segment.sizeInBytes() == 0 {
+				segment.remove()
+				segments.eventListener.SegmentRemoved(config.SegmentRemovalEvent{FileId: segment.fileId, Reason: config.SegmentEmpty})
+				continue
 			}
+			segments.inactiveSegments[segment.fileId] = segment
 		}
 	}
-	return nil
+	return segments.truncatePartialTail()
+}
+
+// truncatePartialTail truncates the newest segment to the end of its last complete entry, and removes it if no complete entry remains.
+// The newest segment was the active segment before the restart, so a crash during an append may have left a partial entry at its end: the append was never acknowledged,
+// and the partial entry is dropped, as in the crash recovery of bitcask. The newest segment is repaired before it is reused as the active segment.
+// A crash during a merge may also leave a partial entry at the end of a merged segment which is older than the active segment, refer to TruncatePartialTail
+func (segments *Segments[Key]) truncatePartialTail() error {
+	fileIds := segments.InactiveSegmentIds()
+	if len(fileIds) == 0 {
+		return nil
+	}
+	segment := segments.inactiveSegments[fileIds[len(fileIds)-1]]
+	completeLength, err := segment.completeLength()
+	if err != nil || completeLength == segment.sizeInBytes() {
+		return err
+	}
+	return segments.truncateInactiveSegment(segment, completeLength)
+}
+
+// TruncatePartialTail truncates the inactive segment identified by fileId to sizeInBytes, the end of its last complete entry, and removes it if no complete entry remains.
+// The reload of KVStore invokes it for a segment which ends with a partial entry, refer to Segment.ReadFull. Such a segment is typically a segment written by a merge
+// which was interrupted by a crash: the WriteBackWriter appends to the merged segment while a newer active segment exists, and the partial entry is a copy
+// that the KeyDirectory never pointed to, so it is safe to drop
+func (segments *Segments[Key]) TruncatePartialTail(fileId uint64, sizeInBytes int64) error {
+	segment, ok := segments.inactiveSegments[fileId]
+	if !ok {
+		return errors.New(fmt.Sprintf("Invalid inactive file id %v", fileId))
+	}
+	return segments.truncateInactiveSegment(segment, sizeInBytes)
+}
+
+// truncateInactiveSegment truncates the inactive segment to sizeInBytes, or removes it if sizeInBytes is 0
+func (segments *Segments[Key]) truncateInactiveSegment(segment *Segment[Key], sizeInBytes int64) error {
+	if sizeInBytes == 0 {
+		segment.remove()
+		delete(segments.inactiveSegments, segment.fileId)
+		segments.eventListener.SegmentRemoved(config.SegmentRemovalEvent{FileId: segment.fileId, Reason: config.SegmentEmpty})
+		return nil
+	}
+	return segment.truncate(sizeInBytes)
+}
+
+// reuseActiveSegment reopens the newest reloaded segment for appending, so that a restart does not leave a partially filled segment behind.
+// The newest segment is reused only if it is smaller than the segment size threshold, and if it is encrypted with the current key
+// (or neither the segment nor Segments is encrypted). It returns nil if the newest segment can not be reused, and a new active segment is created instead.
+func (segments *Segments[Key]) reuseActiveSegment() (*Segment[Key], error) {
+	fileIds := segments.InactiveSegmentIds()
+	if len(fileIds) == 0 {
+		return nil, nil
+	}
+	segment := segments.inactiveSegments[fileIds[len(fileIds)-1]]
+	if segment.sizeInBytes() >= int64(segments.maxSegmentSizeBytes) {
+		return nil, nil
+	}
+	keyId, encrypted := segment.KeyId()
+	currentKeyId, encryptionEnabled := segments.CurrentKeyId()
+	if encrypted != encryptionEnabled || keyId != currentKeyId {
+		return nil, nil
+	}
+	if err := segment.reopenWrites(); err != nil {
+		return nil, err
+	}
+	delete(segments.inactiveSegments, segment.fileId)
+	return segment, nil
 }
@@ -2,9 +2,17 @@ package log
 
 import (
 	"bitcask/clock"
+	"bitcask/config"
+	"compress/flate"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestReadActiveSegmentWithAnEntry(t *testing.T) {
@@ -212,3 +220,693 @@ func allInactiveSegmentsKeys(segments *Segments[serializableKey]) []serializable
 	})
 	return allKeys
 }
+
+func TestReadsFewerInactiveSegmentsThanRequested(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 8, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	_, _ = segments.Append("diskType", []byte("solid state drive"))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+
+	fileIds, contents, _ := segments.ReadInactiveSegments(5, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+
+	if len(fileIds) != 2 || len(contents) != 2 {
+		t.Fatalf("Expected %v inactive segments to be read, received %v", 2, len(contents))
+	}
+	if fileIds[0] >= fileIds[1] {
+		t.Fatalf("Expected inactive segments to be read oldest first, received %v", fileIds)
+	}
+	if contents[0][0].Key != "topic" {
+		t.Fatalf("Expected key to be %v, received %v", "topic", contents[0][0].Key)
+	}
+}
+
+func TestReadAValueSeparatedToABlobSegment(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{BlobValueThresholdBytes: 8})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("topic", []byte("microservices"))
+	if appendEntryResponse.Blob == nil {
+		t.Fatalf("Expected the value to be separated to a blob segment but was not")
+	}
+
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+}
+
+func TestDoesNotSeparateAValueWithinTheBlobValueThreshold(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{BlobValueThresholdBytes: 8})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("disk", []byte("ssd"))
+	if appendEntryResponse.Blob != nil {
+		t.Fatalf("Expected the value to be stored in the segment but was separated to a blob segment")
+	}
+	if segments.BlobSegments().activeSegment != nil {
+		t.Fatalf("Expected no blob segment to be created")
+	}
+}
+
+func TestWriteBackPreservesTheBlobReference(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 32, clock.NewSystemClock(), SegmentsOptions{BlobValueThresholdBytes: 8})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	_, _ = segments.Append("disk", []byte("solid state drive"))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+
+	_, contents, _ := segments.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	changes := make(map[serializableKey]*MappedStoredEntry[serializableKey])
+	for _, entries := range contents {
+		for _, entry := range entries {
+			changes[entry.Key] = entry
+		}
+	}
+	writeBackResponses, _ := segments.WriteBack(changes)
+
+	expectedValues := map[serializableKey]string{"topic": "microservices", "disk": "solid state drive"}
+	for _, writeBackResponse := range writeBackResponses {
+		response := writeBackResponse.AppendEntryResponse
+		if response.Blob == nil {
+			t.Fatalf("Expected the written back entry of %v to refer to the blob segment but did not", writeBackResponse.Key)
+		}
+		storedEntry, _ := segments.Read(response.FileId, response.Offset, response.EntryLength)
+		if string(storedEntry.Value) != expectedValues[writeBackResponse.Key] {
+			t.Fatalf("Expected value to be %v, received %v", expectedValues[writeBackResponse.Key], string(storedEntry.Value))
+		}
+	}
+}
+
+func TestReadACompressedValue(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{
+		Compressor: config.NewFlateCompressor(flate.BestSpeed),
+	})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	value := strings.Repeat("microservices", 10)
+	appendEntryResponse, _ := segments.Append("topic", []byte(value))
+	if appendEntryResponse.EntryLength >= uint32(len(value)) {
+		t.Fatalf("Expected the entry length to be smaller than the value size %v, received %v", len(value), appendEntryResponse.EntryLength)
+	}
+
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != value {
+		t.Fatalf("Expected value to be %v, received %v", value, string(storedEntry.Value))
+	}
+	rawBytes, compressedBytes := segments.ValueBytes()
+	if rawBytes != int64(len(value)) || compressedBytes >= rawBytes {
+		t.Fatalf("Expected %v raw bytes and fewer compressed bytes, received %v and %v", len(value), rawBytes, compressedBytes)
+	}
+}
+
+func TestDoesNotCompressAValueThatDoesNotShrink(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{
+		Compressor: config.NewFlateCompressor(flate.BestSpeed),
+	})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("disk", []byte("ssd"))
+
+	storedEntry, _ := segments.activeSegment.read(appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "ssd" {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(storedEntry.Value))
+	}
+	rawBytes, compressedBytes := segments.ValueBytes()
+	if rawBytes != compressedBytes {
+		t.Fatalf("Expected the compressed bytes to be equal to the raw bytes %v, received %v", rawBytes, compressedBytes)
+	}
+}
+
+func TestReadsCompressedAndUncompressedSegmentsFull(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 8, clock.NewSystemClock(), SegmentsOptions{
+		Compressor: config.NewFlateCompressor(flate.BestSpeed),
+	})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	value := strings.Repeat("microservices", 10)
+	_, _ = segments.Append("topic", []byte(value))
+	segments.compressor = nil
+	_, _ = segments.Append("disk", []byte(value))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+
+	_, contents, _ := segments.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	for _, entries := range contents {
+		for _, entry := range entries {
+			if string(entry.Value) != value || entry.Compressed {
+				t.Fatalf("Expected the value of %v to be decompressed to %v, received %v", entry.Key, value, string(entry.Value))
+			}
+		}
+	}
+}
+
+func TestReadAnEncryptedValue(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{
+		KeyProvider: config.NewInMemoryKeyProvider(1, []byte("0123456789abcdef")),
+	})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("topic", []byte("microservices"))
+
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+	content, _ := os.ReadFile(segments.activeSegment.filePath)
+	if strings.Contains(string(content), "microservices") || strings.Contains(string(content), "topic") {
+		t.Fatalf("Expected the segment file to not contain the plaintext key or value")
+	}
+	keyId, encrypted := segments.activeSegment.KeyId()
+	if !encrypted || keyId != 1 {
+		t.Fatalf("Expected the segment to be encrypted with the key id %v, received %v and %v", 1, keyId, encrypted)
+	}
+}
+
+func TestReadsSegmentsEncryptedWithAnOlderKeyAfterRotation(t *testing.T) {
+	keyProvider := config.NewInMemoryKeyProvider(1, []byte("0123456789abcdef"))
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 8, clock.NewSystemClock(), SegmentsOptions{KeyProvider: keyProvider})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	keyProvider.Rotate(2, []byte("fedcba9876543210"))
+	_, _ = segments.Append("disk", []byte("solid state drive"))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+	segments.Sync()
+	segments.Shutdown()
+
+	segments, _ = NewSegmentsWithOptions[serializableKey](".", 8, clock.NewSystemClock(), SegmentsOptions{KeyProvider: keyProvider})
+	keyIds := make(map[uint32]bool)
+	for _, segment := range segments.AllInactiveSegments() {
+		keyId, _ := segment.KeyId()
+		keyIds[keyId] = true
+	}
+	if !keyIds[1] || !keyIds[2] {
+		t.Fatalf("Expected the inactive segments to be encrypted with the key ids 1 and 2, received %v", keyIds)
+	}
+
+	values := make(map[serializableKey]string)
+	_, contents, _ := segments.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	for _, entries := range contents {
+		for _, entry := range entries {
+			values[entry.Key] = string(entry.Value)
+		}
+	}
+	expected := map[serializableKey]string{"topic": "microservices", "disk": "solid state drive", "engine": "bitcask"}
+	if !reflect.DeepEqual(expected, values) {
+		t.Fatalf("Expected the values to be %v, received %v", expected, values)
+	}
+}
+
+func TestReloadAnEncryptedSegmentWithoutItsKey(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 8, clock.NewSystemClock(), SegmentsOptions{
+		KeyProvider: config.NewInMemoryKeyProvider(1, []byte("0123456789abcdef")),
+	})
+	_, _ = segments.Append("topic", []byte("microservices"))
+	_, _ = segments.Append("disk", []byte("solid state drive"))
+	segments.Sync()
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, err := NewSegmentsWithOptions[serializableKey](".", 8, clock.NewSystemClock(), SegmentsOptions{
+		KeyProvider: config.NewInMemoryKeyProvider(2, []byte("fedcba9876543210")),
+	})
+	if err == nil {
+		t.Fatalf("Expected an error while reloading a segment encrypted with an unknown key but received none")
+	}
+}
+
+func TestStageAndAppendAValueFromAReaderAndReadTheValue(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{BlobValueThresholdBytes: 16})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	values := map[serializableKey]string{"topic": "microservices", "paper": strings.Repeat("bitcask", 10)}
+	responses := make(map[serializableKey]*AppendEntryResponse)
+	for key, value := range values {
+		staged, _ := segments.Stage(key, strings.NewReader(value), int64(len(value)))
+		responses[key], _ = segments.AppendStaged(staged)
+	}
+	if responses["paper"].Blob == nil || responses["topic"].Blob != nil {
+		t.Fatalf("Expected only the value larger than the blob value threshold to be separated")
+	}
+	if stagingFilePaths, _ := filepath.Glob("*_staging.data"); len(stagingFilePaths) != 0 {
+		t.Fatalf("Expected no staging file to remain after the values are appended, received %v", stagingFilePaths)
+	}
+
+	for key, value := range values {
+		response := responses[key]
+		storedEntry, _ := segments.Read(response.FileId, response.Offset, response.EntryLength)
+		if string(storedEntry.Value) != value {
+			t.Fatalf("Expected value of %v to be %v, received %v", key, value, string(storedEntry.Value))
+		}
+		reader, _ := segments.ValueReader(response.FileId, response.Offset, response.EntryLength)
+		streamed, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		if string(streamed) != value {
+			t.Fatalf("Expected the streamed value of %v to be %v, received %v", key, value, string(streamed))
+		}
+	}
+}
+
+func TestValueReaderOfACompressedValue(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{
+		Compressor: config.NewFlateCompressor(flate.BestSpeed),
+	})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	value := strings.Repeat("microservices", 10)
+	appendEntryResponse, _ := segments.Append("topic", []byte(value))
+
+	reader, _ := segments.ValueReader(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	defer reader.Close()
+
+	streamed, _ := io.ReadAll(reader)
+	if string(streamed) != value {
+		t.Fatalf("Expected the streamed value to be %v, received %v", value, string(streamed))
+	}
+}
+
+func TestReusesThePreviousActiveSegmentOnReload(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("topic", []byte("microservices"))
+	activeFileId := segments.activeSegment.fileId
+	segments.Sync()
+	segments.Shutdown()
+
+	segments, _ = NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	if segments.activeSegment.fileId != activeFileId || len(segments.inactiveSegments) != 0 {
+		t.Fatalf("Expected the active segment %v to be reused, received %v", activeFileId, segments.activeSegment.fileId)
+	}
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+	appendEntryResponse, _ = segments.Append("disk", []byte("ssd"))
+	if appendEntryResponse.FileId != activeFileId {
+		t.Fatalf("Expected the append to the reused active segment %v, received %v", activeFileId, appendEntryResponse.FileId)
+	}
+	storedEntry, _ = segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "ssd" {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(storedEntry.Value))
+	}
+}
+
+func TestRemovesTheEmptySegmentsOnReload(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	emptyFilePath := segments.activeSegment.filePath
+	segments.Shutdown()
+
+	segments, _ = NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	if _, err := os.Stat(emptyFilePath); !os.IsNotExist(err) && emptyFilePath != segments.activeSegment.filePath {
+		t.Fatalf("Expected the empty segment file %v to be removed", emptyFilePath)
+	}
+	if len(segments.inactiveSegments) != 0 {
+		t.Fatalf("Expected no inactive segments, received %v", len(segments.inactiveSegments))
+	}
+}
+
+func TestTruncatesThePartialEntryOfTheActiveSegmentOnReload(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("topic", []byte("microservices"))
+	activeFileId := segments.activeSegment.fileId
+	completeSize := segments.activeSegment.sizeInBytes()
+	_, _ = segments.activeSegment.store.append([]byte{1, 2, 3})
+	segments.Sync()
+	segments.Shutdown()
+
+	segments, _ = NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	if segments.activeSegment.fileId != activeFileId || segments.activeSegment.sizeInBytes() != completeSize {
+		t.Fatalf("Expected the active segment %v to be truncated to %v bytes and reused, received %v with %v bytes",
+			activeFileId, completeSize, segments.activeSegment.fileId, segments.activeSegment.sizeInBytes())
+	}
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+}
+
+func TestRemovesTheActiveSegmentWithOnlyAPartialEntryOnReload(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	partialFilePath := segments.activeSegment.filePath
+	_, _ = segments.activeSegment.store.append([]byte{1, 2, 3})
+	segments.Sync()
+	segments.Shutdown()
+
+	segments, _ = NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	if _, err := os.Stat(partialFilePath); !os.IsNotExist(err) && partialFilePath != segments.activeSegment.filePath {
+		t.Fatalf("Expected the segment file %v with only a partial entry to be removed", partialFilePath)
+	}
+	if len(segments.inactiveSegments) != 0 {
+		t.Fatalf("Expected no inactive segments, received %v", len(segments.inactiveSegments))
+	}
+}
+
+func TestReadFullOfASegmentWithAPartialEntry(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	_, _ = segments.activeSegment.store.append([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13})
+
+	_, err := segments.activeSegment.ReadFull(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	var corruptSegmentError *CorruptSegmentError
+	if !errors.Is(err, ErrTruncatedEntry) || !errors.As(err, &corruptSegmentError) {
+		t.Fatalf("Expected a CorruptSegmentError with ErrTruncatedEntry, received %v", err)
+	}
+	if corruptSegmentError.FilePath != segments.activeSegment.filePath || corruptSegmentError.Offset == 0 {
+		t.Fatalf("Expected the corruption after the first entry of %v, received %v", segments.activeSegment.filePath, corruptSegmentError)
+	}
+}
+
+func TestRolloversWithAFixedClockCreateDistinctSegments(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 8, &FixedClock{}, SegmentsOptions{BlobValueThresholdBytes: 8})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	_, _ = segments.Append("disk", []byte("ssd"))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+	segments.Sync()
+	segments.Shutdown()
+
+	segments, _ = NewSegmentsWithOptions[serializableKey](".", 8, &FixedClock{}, SegmentsOptions{BlobValueThresholdBytes: 8})
+	_, _ = segments.Append("paper", []byte("riak"))
+
+	values := make(map[serializableKey]string)
+	_, contents, _ := segments.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	for _, entries := range contents {
+		for _, entry := range entries {
+			values[entry.Key] = string(entry.Value)
+		}
+	}
+	if len(values) != 3 || values["disk"] != "ssd" || values["engine"] != "bitcask" {
+		t.Fatalf("Expected the entries of 3 keys to survive the rollovers, received %v", values)
+	}
+	for fileId := range segments.inactiveSegments {
+		if fileId >= segments.activeSegment.fileId {
+			t.Fatalf("Expected the active segment %v to have the largest file id, received %v", segments.activeSegment.fileId, fileId)
+		}
+	}
+}
+
+func TestAppendsDoNotExceedTheSegmentSizeThreshold(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 64, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	for count := 0; count < 5; count++ {
+		_, _ = segments.Append("topic", []byte("microservices"))
+		_, _ = segments.AppendDeleted("disk")
+	}
+	for fileId, segment := range segments.inactiveSegments {
+		if segment.sizeInBytes() > 64 {
+			t.Fatalf("Expected the size of the inactive segment %v to be at most %v, received %v", fileId, 64, segment.sizeInBytes())
+		}
+	}
+}
+
+func TestAppendsAnEntryLargerThanTheSegmentSizeThresholdToASegmentOfItsOwn(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 32, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("disk", []byte("ssd"))
+	appendEntryResponse, _ := segments.Append("topic", []byte("microservices and distributed systems"))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+
+	segment := segments.inactiveSegments[appendEntryResponse.FileId]
+	if appendEntryResponse.Offset != 0 || segment.sizeInBytes() != int64(appendEntryResponse.EntryLength) {
+		t.Fatalf("Expected the large entry to be the only entry of its segment, received offset %v in a segment of %v bytes", appendEntryResponse.Offset, segment.sizeInBytes())
+	}
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "microservices and distributed systems" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices and distributed systems", string(storedEntry.Value))
+	}
+}
+
+func TestAppendFailsForAKeyLargerThanTheMaxKeySize(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{MaxKeySizeBytes: 4})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, err := segments.Append("topic", []byte("microservices"))
+	if !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("Expected ErrKeyTooLarge, received %v", err)
+	}
+	var entrySizeError *EntrySizeError
+	if !errors.As(err, &entrySizeError) || entrySizeError.Size != 5 || entrySizeError.MaxSize != 4 {
+		t.Fatalf("Expected an EntrySizeError of size 5 and max size 4, received %v", err)
+	}
+	if _, err := segments.AppendDeleted("topic"); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("Expected ErrKeyTooLarge for a delete, received %v", err)
+	}
+	if segments.activeSegment.sizeInBytes() != 0 {
+		t.Fatalf("Expected nothing to be appended, received %v bytes", segments.activeSegment.sizeInBytes())
+	}
+}
+
+func TestAppendFailsForAValueLargerThanTheMaxValueSize(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{MaxValueSizeBytes: 8})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, err := segments.Append("topic", []byte("microservices"))
+	var entrySizeError *EntrySizeError
+	if !errors.Is(err, ErrValueTooLarge) || !errors.As(err, &entrySizeError) || entrySizeError.Size != 13 || entrySizeError.MaxSize != 8 {
+		t.Fatalf("Expected an EntrySizeError with ErrValueTooLarge of size 13 and max size 8, received %v", err)
+	}
+	_, err = segments.Stage("topic", strings.NewReader("microservices"), 13)
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Expected ErrValueTooLarge for a streamed value, received %v", err)
+	}
+	if _, err := segments.Append("disk", []byte("ssd")); err != nil {
+		t.Fatalf("Expected a value within the max value size to be appended, received %v", err)
+	}
+}
+
+func TestPreallocatedSegmentsHaveTheSizeOfTheirEntries(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 64, clock.NewSystemClock(), SegmentsOptions{PreallocateSegments: true})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	appendEntryResponse, _ := segments.Append("topic", []byte("microservices"))
+	_, _ = segments.Append("disk", []byte("solid state drive"))
+	_, _ = segments.Append("engine", []byte("bitcask"))
+
+	for _, segment := range append([]*Segment[serializableKey]{segments.activeSegment}, segments.AllInactiveSegments()[appendEntryResponse.FileId]) {
+		fileInfo, err := os.Stat(segment.store.reader.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileInfo.Size() != segment.sizeInBytes() {
+			t.Fatalf("Expected the file size to be %v, received %v", segment.sizeInBytes(), fileInfo.Size())
+		}
+	}
+	storedEntry, _ := segments.Read(appendEntryResponse.FileId, appendEntryResponse.Offset, appendEntryResponse.EntryLength)
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+}
+
+type manualClock struct {
+	now int64
+}
+
+func (clock *manualClock) Now() int64 {
+	return clock.now
+}
+
+func (clock *manualClock) advance(duration time.Duration) {
+	clock.now = clock.now + int64(duration)
+}
+
+func TestRollsOverTheActiveSegmentOlderThanTheMaxSegmentAgeOnAppend(t *testing.T) {
+	clock := &manualClock{now: 1}
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 1024, clock, SegmentsOptions{MaxSegmentAge: time.Minute})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	clock.advance(time.Hour)
+	_, _ = segments.Append("topic", []byte("microservices"))
+	clock.advance(30 * time.Second)
+	_, _ = segments.Append("disk", []byte("ssd"))
+	if len(segments.inactiveSegments) != 0 {
+		t.Fatalf("Expected no inactive segment before the max segment age, received %v", len(segments.inactiveSegments))
+	}
+
+	clock.advance(31 * time.Second)
+	_, _ = segments.Append("engine", []byte("bitcask"))
+	if len(segments.inactiveSegments) != 1 {
+		t.Fatalf("Expected 1 inactive segment after the max segment age, received %v", len(segments.inactiveSegments))
+	}
+	keys := allInactiveSegmentsKeys(segments)
+	expectedKeys := []serializableKey{"disk", "topic"}
+	if !reflect.DeepEqual(expectedKeys, keys) {
+		t.Fatalf("Expected the keys of the inactive segment to be %v, received %v", expectedKeys, keys)
+	}
+}
+
+func TestRolloverExpiredActiveSegmentsWithoutAnAppend(t *testing.T) {
+	clock := &manualClock{now: 1}
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 1024, clock, SegmentsOptions{MaxSegmentAge: time.Minute, BlobValueThresholdBytes: 8})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	if rolledOver, _ := segments.RolloverExpiredActiveSegments(); rolledOver {
+		t.Fatalf("Expected the active segment not to be rolled over before the max segment age")
+	}
+
+	clock.advance(time.Minute)
+	if rolledOver, _ := segments.RolloverExpiredActiveSegments(); !rolledOver {
+		t.Fatalf("Expected the active segment to be rolled over after the max segment age")
+	}
+	if len(segments.inactiveSegments) != 1 || len(segments.blobSegments.inactiveSegments) != 1 || segments.blobSegments.activeSegment != nil {
+		t.Fatalf("Expected 1 inactive segment and 1 inactive blob segment, received %v and %v", len(segments.inactiveSegments), len(segments.blobSegments.inactiveSegments))
+	}
+
+	clock.advance(time.Hour)
+	if rolledOver, _ := segments.RolloverExpiredActiveSegments(); rolledOver {
+		t.Fatalf("Expected an empty active segment not to be rolled over")
+	}
+}
+
+func TestReadsTheBucketsOfTheEntriesOfAnInactiveSegment(t *testing.T) {
+	segments, _ := NewSegments[serializableKey](".", 100, clock.NewSystemClock())
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.Append("topic", []byte("microservices"))
+	_, _ = segments.AppendInBucket(2, "topic", []byte("bitcask"))
+	_, _ = segments.AppendDeletedInBucket(3, "disk")
+	_ = segments.rolloverActiveSegment()
+
+	fileId := segments.InactiveSegmentIds()[0]
+	iterator, _ := segments.Iterator(fileId, func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	defer iterator.Close()
+
+	var buckets []uint32
+	var keys []serializableKey
+	for entry, err := iterator.Next(); err == nil; entry, err = iterator.Next() {
+		buckets = append(buckets, entry.Bucket)
+		keys = append(keys, entry.Key)
+	}
+	if !reflect.DeepEqual([]uint32{DefaultBucket, 2, 3}, buckets) {
+		t.Fatalf("Expected the buckets to be %v, received %v", []uint32{DefaultBucket, 2, 3}, buckets)
+	}
+	if !reflect.DeepEqual([]serializableKey{"topic", "topic", "disk"}, keys) {
+		t.Fatalf("Expected the keys to be %v, received %v", []serializableKey{"topic", "topic", "disk"}, keys)
+	}
+}
+
+func TestReadAnEncryptedValueInABucket(t *testing.T) {
+	segments, _ := NewSegmentsWithOptions[serializableKey](".", 100, clock.NewSystemClock(), SegmentsOptions{
+		KeyProvider: config.NewInMemoryKeyProvider(1, []byte("0123456789abcdef")),
+	})
+	defer func() {
+		segments.RemoveActive()
+		segments.RemoveAllInactive()
+	}()
+
+	_, _ = segments.AppendInBucket(5, "topic", []byte("microservices"))
+	_ = segments.rolloverActiveSegment()
+
+	_, contents, _ := segments.ReadAllInactiveSegments(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})
+	entry := contents[0][0]
+	if entry.Bucket != 5 || entry.Key != "topic" || string(entry.Value) != "microservices" {
+		t.Fatalf("Expected %v -> %v in bucket %v, received %v -> %v in bucket %v", "topic", "microservices", 5, entry.Key, string(entry.Value), entry.Bucket)
+	}
+}
@@ -0,0 +1,111 @@
+package log
+
+import (
+	"bitcask/config"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+// stagingFilePrefix identifies a staging file, fileId_staging.data. A staging file is neither a segment nor a blob segment, so it is never reloaded
+const stagingFilePrefix = "staging"
+
+// StagedValue is a value which is streamed from a reader to a staging file without the lock of KVStore, refer to Segments.Stage.
+// The staging file holds the value encoded as a blob entry, so a value larger than the blob value threshold becomes a blob segment by a rename of the staging file,
+// whereas a smaller value is copied from the staging file to the active segment. Refer to Segments.AppendStaged
+type StagedValue[Key config.BitCaskKey] struct {
+	key      Key
+	size     int64
+	segment  *Segment[Key]
+	response *AppendEntryResponse
+}
+
+// Stage streams the key and the value of size bytes from the reader to a new staging file, and syncs it. The staging file is not visible to the reads, the merges and the reload,
+// so Stage does not change the state of Segments and does not need the lock of KVStore: a slow reader never blocks the other operations.
+// The staging file is removed if the reader fails or provides fewer than size bytes, and a staging file left behind by a crash is removed during start-up.
+// An encrypted entry is sealed as a whole, so Stage returns ErrEncryptedStream if encryption is enabled, instead of reading the value in memory.
+func (segments *Segments[Key]) Stage(key Key, reader io.Reader, size int64) (*StagedValue[Key], error) {
+	if size < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid value size %v", size))
+	}
+	if _, err := segments.validate(DefaultBucket, key, uint64(size)); err != nil {
+		return nil, err
+	}
+	if segments.keyProvider != nil {
+		return nil, ErrEncryptedStream
+	}
+	fileId := segments.fileIdGenerator.Next()
+	segment, err := newSegment[Key](fileId, segmentFileName(fileId, stagingFilePrefix, nil, segments.directory), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := segment.appendFrom(NewEntry[Key](key, nil, segments.clock), reader, size)
+	if err == nil {
+		segment.sync()
+	}
+	segment.stopWrites()
+	if err != nil {
+		segment.remove()
+		segment.close()
+		return nil, err
+	}
+	return &StagedValue[Key]{key: key, size: size, segment: segment, response: response}, nil
+}
+
+// AppendStaged appends the StagedValue, and returns the AppendEntryResponse of its entry in the active segment. A value larger than the blob value threshold is not copied:
+// the staging file becomes an inactive blob segment and only the BlobReference is appended to the active segment. A smaller value is copied from the staging file
+// to the active segment, which reads a local file instead of the reader of the caller, and the staging file is removed.
+// AppendStaged changes the state of Segments, so it must be invoked with the exclusive lock of KVStore held
+func (segments *Segments[Key]) AppendStaged(staged *StagedValue[Key]) (*AppendEntryResponse, error) {
+	if segments.blobSegments.shouldSeparate(uint64(staged.size)) {
+		reference, err := segments.blobSegments.commit(staged)
+		if err != nil {
+			return nil, err
+		}
+		segments.countStreamedValueBytes(staged.size)
+		return segments.AppendBlobReference(DefaultBucket, staged.key, reference, 0)
+	}
+	defer staged.Discard()
+
+	keySize := serializedKeySize(DefaultBucket, staged.key.Serialize())
+	if err := segments.maybeRolloverActiveSegment(segments.entryLength(keySize, uint64(staged.size))); err != nil {
+		return nil, err
+	}
+	reader, _, err := staged.segment.valueReader(staged.response.Offset, staged.response.EntryLength)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	appendEntryResponse, err := segments.activeSegment.appendFrom(NewEntry[Key](staged.key, nil, segments.clock), reader, staged.size)
+	if err != nil {
+		return nil, err
+	}
+	segments.countStreamedValueBytes(staged.size)
+	return appendEntryResponse, nil
+}
+
+// Discard removes the staging file of the StagedValue which is not appended, for example because KVStore is shut down
+func (staged *StagedValue[Key]) Discard() {
+	staged.segment.remove()
+	staged.segment.close()
+}
+
+// commit renames the staging file of the StagedValue to a blob segment file, which becomes an inactive blob segment, and returns the BlobReference to its blob entry.
+// The order of the blob segments does not matter, so the fileId of the staging file is kept. commit must be invoked with the exclusive lock of KVStore held
+func (blobSegments *BlobSegments[Key]) commit(staged *StagedValue[Key]) (*BlobReference, error) {
+	filePath := segmentFileName(staged.segment.fileId, blobSegmentFilePrefix, nil, blobSegments.directory)
+	if err := os.Rename(staged.segment.filePath, filePath); err != nil {
+		staged.Discard()
+		return nil, err
+	}
+	staged.segment.close()
+	segment, err := reloadSegmentFile[Key](path.Base(filePath), blobSegments.directory, blobSegments.compressor, blobSegments.keyProvider, blobSegments.memoryMappedReads)
+	if err != nil {
+		return nil, err
+	}
+	blobSegments.inactiveSegments[segment.fileId] = segment
+	return newBlobReference(staged.response), nil
+}
@@ -3,14 +3,28 @@ package log
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 )
 
 //Store is an abstraction that encapsulates `append`, `read`, `remove` and `sync` file operations
+//currentWriteOffset is atomic because a merge appends to a new inactive segment without holding the lock of KVStore, while its size can be read concurrently.
+//If memory-mapped reads are enabled, the file is mapped read-only on the first read after the writes are stopped (the file is immutable from then on),
+//and read returns slices of the mapping instead of reading from the read file pointer. The mapping is unmapped when the file is removed,
+//so the slices returned by read must not be used after remove. KVStore guarantees this: a segment is removed only with the exclusive lock of KVStore held,
+//and a Get copies the value before it releases the read lock.
+//If the file is preallocated, the disk space beyond the written bytes is released when the writes are stopped.
 type Store struct {
 	writer             *os.File
 	reader             *os.File
-	currentWriteOffset int64
+	currentWriteOffset atomic.Int64
+	memoryMapped       bool
+	writesStopped      atomic.Bool
+	mapOnce            sync.Once
+	mapping            []byte
+	preallocated       bool
 }
 
 //NewStore creates an instance of Store from the filePath. It creates 2 file pointers:
@@ -30,55 +44,136 @@ func NewStore(filePath string) (*Store, error) {
 		return nil, err
 	}
 	return &Store{
-		writer:             writer,
-		reader:             reader,
-		currentWriteOffset: 0,
+		writer: writer,
+		reader: reader,
 	}, nil
 }
 
 //ReloadStore creates an instance of Store with only the read file pointer. This operation is executed only during the start-up to reload the state, if any from disk.
 //This method creates only the read file pointer because reloading the state will only create inactive segment(s) and these will be used only for Get operation
+//The currentWriteOffset of the reloaded store is set to the size of the file, so that the size of the inactive segment is known without reading it.
 func ReloadStore(filePath string) (*Store, error) {
 	reader, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
-	return &Store{
-		writer:             nil,
-		reader:             reader,
-		currentWriteOffset: 0,
-	}, nil
+	fileInfo, err := reader.Stat()
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{
+		writer: nil,
+		reader: reader,
+	}
+	store.currentWriteOffset.Store(fileInfo.Size())
+	store.writesStopped.Store(true)
+	return store, nil
+}
+
+//truncate Truncates the file of a reloaded store to sizeInBytes. This operation is executed only during the start-up, before the store is read, to drop a partial entry
+//left behind at the end of the file by a crash during an append.
+func (store *Store) truncate(sizeInBytes int64) error {
+	if err := os.Truncate(store.reader.Name(), sizeInBytes); err != nil {
+		return err
+	}
+	store.currentWriteOffset.Store(sizeInBytes)
+	return nil
+}
+
+//reopenWrites Reopens the write file pointer of a reloaded store, so that the store can be appended to again. This operation is executed only during the start-up
+//to reuse the previous active segment, before the store is read.
+func (store *Store) reopenWrites() error {
+	writer, err := os.OpenFile(store.reader.Name(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	store.writer = writer
+	store.writesStopped.Store(false)
+	return nil
 }
 
 //append Appends the bytes to the file and maintains the currentWriteOffset
 func (store *Store) append(bytes []byte) (int64, error) {
 	bytesWritten, err := store.writer.Write(bytes)
-	offset := store.currentWriteOffset
+	offset := store.currentWriteOffset.Load()
 	if err != nil {
 		return -1, err
 	}
 	if bytesWritten < len(bytes) {
 		return -1, errors.New(fmt.Sprintf("Could not append %v bytes", len(bytes)))
 	}
-	store.currentWriteOffset = store.currentWriteOffset + int64(bytesWritten)
+	store.currentWriteOffset.Add(int64(bytesWritten))
+	return offset, nil
+}
+
+//appendFrom Appends the prefix, size bytes copied from the reader and the suffix to the file, without holding the size bytes in memory, and maintains the currentWriteOffset.
+//If the copy fails or the reader provides fewer than size bytes, the file is truncated back to its size before the append, so that no partial entry remains in the file.
+func (store *Store) appendFrom(prefix []byte, reader io.Reader, size int64, suffix []byte) (int64, error) {
+	offset := store.currentWriteOffset.Load()
+	if err := store.writeFrom(prefix, reader, size, suffix); err != nil {
+		_ = store.writer.Truncate(offset)
+		return -1, err
+	}
+	store.currentWriteOffset.Add(int64(len(prefix)) + size + int64(len(suffix)))
 	return offset, nil
 }
 
-//read Reads the file content as a byte slice from the offset. This method internally performs 2 operations:
-//1. Seek to the offset
-//2. Reading the byte slice of size from the offset
+func (store *Store) writeFrom(prefix []byte, reader io.Reader, size int64, suffix []byte) error {
+	if _, err := store.writer.Write(prefix); err != nil {
+		return err
+	}
+	bytesCopied, err := io.CopyN(store.writer, reader, size)
+	if bytesCopied < size {
+		return errors.New(fmt.Sprintf("Could not append %v bytes from the reader, copied %v bytes: %v", size, bytesCopied, err))
+	}
+	_, err = store.writer.Write(suffix)
+	return err
+}
+
+//read Reads the file content as a byte slice of size from the offset.
+//It uses `ReadAt` which does not move the file offset, so concurrent reads on the same file pointer do not interfere with each other,
+//and which reads all the bytes (a large blob value may need more than one read from the file)
+//If the file is memory-mapped, read returns a slice of the mapping without a system call.
 func (store *Store) read(offset int64, size uint32) ([]byte, error) {
-	_, err := store.reader.Seek(offset, 0)
+	var buffer []byte
+	return store.readInto(offset, size, &buffer)
+}
+
+//readInto Reads the file content as a byte slice of size from the offset into the buffer, and replaces the buffer with a larger one if its capacity is smaller than size.
+//The returned byte slice is either a slice of the buffer or a slice of the memory mapping.
+func (store *Store) readInto(offset int64, size uint32, buffer *[]byte) ([]byte, error) {
+	if mapping := store.memoryMapping(); offset+int64(size) <= int64(len(mapping)) {
+		return mapping[offset : offset+int64(size) : offset+int64(size)], nil
+	}
+	if uint32(cap(*buffer)) < size {
+		*buffer = make([]byte, size)
+	}
+	bytes := (*buffer)[:size]
+	_, err := store.reader.ReadAt(bytes, offset)
 	if err != nil {
 		return nil, err
 	}
-	bytes := make([]byte, size)
+	return bytes, nil
+}
 
-	_, err = store.reader.Read(bytes)
+//sectionReader returns an io.ReadCloser of size bytes of the file from the offset. The section is read from a new file pointer which is closed by the io.ReadCloser,
+//so the section remains readable even if the file is removed (by a merge) before the section is completely read.
+func (store *Store) sectionReader(offset int64, size int64) (io.ReadCloser, error) {
+	file, err := os.Open(store.reader.Name())
 	if err != nil {
 		return nil, err
 	}
-	return bytes, nil
+	return &sectionReadCloser{SectionReader: io.NewSectionReader(file, offset, size), file: file}, nil
+}
+
+//sectionReadCloser is an io.SectionReader which closes its file pointer on Close
+type sectionReadCloser struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (reader *sectionReadCloser) Close() error {
+	return reader.file.Close()
 }
 
 //readFull Reads the entire file content
@@ -88,7 +183,7 @@ func (store *Store) readFull() ([]byte, error) {
 
 //sizeInBytes Returns the file size in bytes. We could have used `os.Stat()` as well
 func (store *Store) sizeInBytes() int64 {
-	return store.currentWriteOffset
+	return store.currentWriteOffset.Load()
 }
 
 //sync Performs a file sync, ensures all the disk blocks (or pages) at the Kernel page cache are flushed to the disk
@@ -96,12 +191,55 @@ func (store *Store) sync() {
 	store.writer.Sync()
 }
 
+//preallocate Preallocates the disk space of the file up to sizeInBytes without changing the size of the file, so that the size of the file is always the number of bytes written.
+//Preallocation is best-effort, a failure (or an unsupported platform, refer to Preallocate.go) only leaves the file to be extended by the appends.
+func (store *Store) preallocate(sizeInBytes int64) {
+	if err := preallocate(store.writer, sizeInBytes); err == nil {
+		store.preallocated = true
+	}
+}
+
 //stopWrites Closes the write file pointer. This operation is called when the active segment has reached its size threshold.
+//The preallocated disk space beyond the written bytes is released by truncating the file to its size.
 func (store *Store) stopWrites() {
+	if store.preallocated {
+		_ = store.writer.Truncate(store.currentWriteOffset.Load())
+		store.preallocated = false
+	}
 	store.writer.Close()
+	store.writesStopped.Store(true)
 }
 
-//remove Removes the file
+//remove Removes the file, and unmaps the file if it is memory-mapped
 func (store *Store) remove() {
+	if store.mapping != nil {
+		_ = memoryUnmap(store.mapping)
+		store.mapping = nil
+	}
 	_ = os.RemoveAll(store.reader.Name())
 }
+
+//close Closes the read file pointer. This operation is called only for a staging file, which is not read through the store once it is appended or discarded
+func (store *Store) close() {
+	_ = store.reader.Close()
+}
+
+//enableMemoryMappedReads enables memory-mapped reads once the writes are stopped. This operation is called before the store is read.
+func (store *Store) enableMemoryMappedReads() {
+	store.memoryMapped = true
+}
+
+//memoryMapping returns the read-only mapping of the file, mapping the file on the first invocation after the writes are stopped.
+//It returns nil if memory-mapped reads are not enabled, if the file is still being written or if the file could not be mapped (the reads then fall back to the read file pointer).
+func (store *Store) memoryMapping() []byte {
+	if !store.memoryMapped || !store.writesStopped.Load() {
+		return nil
+	}
+	store.mapOnce.Do(func() {
+		mapping, err := memoryMap(store.reader, store.sizeInBytes())
+		if err == nil {
+			store.mapping = mapping
+		}
+	})
+	return store.mapping
+}
@@ -2,6 +2,7 @@ package log
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -144,3 +145,75 @@ func TestStopsWrites(t *testing.T) {
 		t.Fatalf("Expected content to be %v, received %v", content, string(received))
 	}
 }
+
+func TestReadsFromTheMemoryMappingAfterStoppingWrites(t *testing.T) {
+	file, _ := os.CreateTemp(".", "append_only")
+	store, _ := NewStore(file.Name())
+	store.enableMemoryMappedReads()
+	defer store.remove()
+
+	_, _ = store.append([]byte("append-only-log"))
+	if store.memoryMapping() != nil {
+		t.Fatalf("Expected the store to not be memory-mapped before the writes are stopped")
+	}
+	store.stopWrites()
+
+	bytes, _ := store.read(7, 4)
+	if string(bytes) != "only" {
+		t.Fatalf("Expected store content to be %v, received %v", "only", string(bytes))
+	}
+	if string(store.memoryMapping()) != "append-only-log" {
+		t.Fatalf("Expected the memory mapping to be %v, received %v", "append-only-log", string(store.memoryMapping()))
+	}
+}
+
+func TestReloadedStoreReadsFromTheMemoryMapping(t *testing.T) {
+	file, _ := os.CreateTemp(".", "append_only")
+	store, _ := NewStore(file.Name())
+	_, _ = store.append([]byte("append-only-log"))
+	store.stopWrites()
+
+	store, _ = ReloadStore(file.Name())
+	store.enableMemoryMappedReads()
+	defer store.remove()
+
+	bytes, _ := store.read(0, 6)
+	if string(bytes) != "append" || store.memoryMapping() == nil {
+		t.Fatalf("Expected store content to be %v from the memory mapping, received %v", "append", string(bytes))
+	}
+}
+
+func TestAppendsFromAReader(t *testing.T) {
+	file, _ := os.CreateTemp(".", "append_only")
+	store, _ := NewStore(file.Name())
+	defer func() {
+		_ = os.RemoveAll(file.Name())
+	}()
+
+	offset, _ := store.appendFrom([]byte("append-"), strings.NewReader("only-log"), 4, []byte("-log"))
+
+	bytes, _ := store.read(offset, uint32(store.sizeInBytes()))
+	if string(bytes) != "append-only-log" {
+		t.Fatalf("Expected store content to be %v, received %v", "append-only-log", string(bytes))
+	}
+}
+
+func TestAppendFromAShortReaderLeavesNoPartialContent(t *testing.T) {
+	file, _ := os.CreateTemp(".", "append_only")
+	store, _ := NewStore(file.Name())
+	defer func() {
+		_ = os.RemoveAll(file.Name())
+	}()
+
+	_, _ = store.append([]byte("append"))
+	_, err := store.appendFrom([]byte("-only"), strings.NewReader("log"), 10, []byte("!"))
+	if err == nil {
+		t.Fatalf("Expected an error while appending from a short reader but received none")
+	}
+	offset, _ := store.append([]byte("-log"))
+
+	content, _ := store.readFull()
+	if string(content) != "append-log" || offset != 6 || store.sizeInBytes() != 10 {
+		t.Fatalf("Expected store content to be %v, received %v", "append-log", string(content))
+	}
+}
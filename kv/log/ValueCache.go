@@ -0,0 +1,104 @@
+package log
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ValueCache is a bounded in-memory LRU cache of the recently read entries, placed in front of the segment files.
+// An entry is cached by its position (fileId and offset) in a segment file. A put, an update or a delete appends a new entry at a new position,
+// and a merge writes the live entries to new segment files, so the KeyDirectory never points to a stale position again and the cache does not need
+// an explicit invalidation. The stale entries are evicted in the least recently used order once the size of the cache reaches its capacity.
+// The size of a cached entry is the size of its key and its value. An entry larger than the capacity is never cached.
+// ValueCache is safe for concurrent use, it is read by the concurrent Get operations that share the read lock of KVStore.
+type ValueCache struct {
+	lock          sync.Mutex
+	capacityBytes uint64
+	sizeBytes     uint64
+	entries       map[valueCachePosition]*list.Element
+	recency       *list.List
+	hits          uint64
+	misses        uint64
+}
+
+// valueCachePosition identifies an entry in a segment file
+type valueCachePosition struct {
+	fileId uint64
+	offset int64
+}
+
+type valueCacheEntry struct {
+	position    valueCachePosition
+	storedEntry *StoredEntry
+}
+
+// NewValueCache creates a new instance of ValueCache which holds up to capacityBytes of keys and values
+func NewValueCache(capacityBytes uint64) *ValueCache {
+	return &ValueCache{
+		capacityBytes: capacityBytes,
+		entries:       make(map[valueCachePosition]*list.Element),
+		recency:       list.New(),
+	}
+}
+
+// Get returns a copy of the entry cached at the position identified by fileId and offset, and counts a hit or a miss
+func (cache *ValueCache) Get(fileId uint64, offset int64) (*StoredEntry, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	element, ok := cache.entries[valueCachePosition{fileId: fileId, offset: offset}]
+	if !ok {
+		cache.misses = cache.misses + 1
+		return nil, false
+	}
+	cache.hits = cache.hits + 1
+	cache.recency.MoveToFront(element)
+	return copyOf(element.Value.(*valueCacheEntry).storedEntry), true
+}
+
+// Put caches a copy of the entry read from the position identified by fileId and offset, and evicts the least recently used entries
+// until the size of the cache is within its capacity
+func (cache *ValueCache) Put(fileId uint64, offset int64, storedEntry *StoredEntry) {
+	size := sizeOf(storedEntry)
+	if size > cache.capacityBytes {
+		return
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	position := valueCachePosition{fileId: fileId, offset: offset}
+	if _, ok := cache.entries[position]; ok {
+		return
+	}
+	for cache.sizeBytes+size > cache.capacityBytes {
+		cache.evict(cache.recency.Back())
+	}
+	cache.entries[position] = cache.recency.PushFront(&valueCacheEntry{position: position, storedEntry: copyOf(storedEntry)})
+	cache.sizeBytes = cache.sizeBytes + size
+}
+
+// Stats returns the number of hits, the number of misses, the number of cached entries and their size in bytes
+func (cache *ValueCache) Stats() (uint64, uint64, int, uint64) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	return cache.hits, cache.misses, len(cache.entries), cache.sizeBytes
+}
+
+func (cache *ValueCache) evict(element *list.Element) {
+	entry := cache.recency.Remove(element).(*valueCacheEntry)
+	delete(cache.entries, entry.position)
+	cache.sizeBytes = cache.sizeBytes - sizeOf(entry.storedEntry)
+}
+
+// copyOf copies the key and the value of the entry, so that neither the cache nor its callers observe each other's modifications
+func copyOf(storedEntry *StoredEntry) *StoredEntry {
+	entry := *storedEntry
+	entry.Key = append([]byte(nil), storedEntry.Key...)
+	entry.Value = append([]byte(nil), storedEntry.Value...)
+	return &entry
+}
+
+func sizeOf(storedEntry *StoredEntry) uint64 {
+	return uint64(len(storedEntry.Key) + len(storedEntry.Value))
+}
@@ -0,0 +1,63 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestValueCacheGetAfterPut(t *testing.T) {
+	cache := NewValueCache(64)
+	cache.Put(1, 0, &StoredEntry{Key: []byte("topic"), Value: []byte("microservices")})
+
+	storedEntry, ok := cache.Get(1, 0)
+	if !ok || string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", storedEntry)
+	}
+	_, ok = cache.Get(1, 18)
+	if ok {
+		t.Fatalf("Expected no entry at a different offset")
+	}
+	hits, misses, entries, sizeBytes := cache.Stats()
+	if hits != 1 || misses != 1 || entries != 1 || sizeBytes != 18 {
+		t.Fatalf("Expected 1 hit, 1 miss, 1 entry and 18 bytes, received %v, %v, %v and %v", hits, misses, entries, sizeBytes)
+	}
+}
+
+func TestValueCacheEvictsTheLeastRecentlyUsedEntry(t *testing.T) {
+	cache := NewValueCache(20)
+	cache.Put(1, 0, &StoredEntry{Key: []byte("topic"), Value: []byte("bitcask")})
+	cache.Put(1, 20, &StoredEntry{Key: []byte("disk"), Value: []byte("ssd")})
+	_, _ = cache.Get(1, 0)
+	cache.Put(1, 40, &StoredEntry{Key: []byte("engine"), Value: []byte("ok")})
+
+	if _, ok := cache.Get(1, 20); ok {
+		t.Fatalf("Expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get(1, 0); !ok {
+		t.Fatalf("Expected the recently used entry to be retained")
+	}
+	if _, _, _, sizeBytes := cache.Stats(); sizeBytes > 20 {
+		t.Fatalf("Expected the size of the cache to be within 20 bytes, received %v", sizeBytes)
+	}
+}
+
+func TestValueCacheDoesNotCacheAnEntryLargerThanTheCapacity(t *testing.T) {
+	cache := NewValueCache(8)
+	cache.Put(1, 0, &StoredEntry{Key: []byte("topic"), Value: []byte("microservices")})
+
+	if _, ok := cache.Get(1, 0); ok {
+		t.Fatalf("Expected an entry larger than the capacity to not be cached")
+	}
+}
+
+func TestValueCacheReturnsACopy(t *testing.T) {
+	cache := NewValueCache(64)
+	cache.Put(1, 0, &StoredEntry{Key: []byte("topic"), Value: []byte("microservices")})
+
+	storedEntry, _ := cache.Get(1, 0)
+	storedEntry.Value[0] = 'M'
+
+	storedEntry, _ = cache.Get(1, 0)
+	if string(storedEntry.Value) != "microservices" {
+		t.Fatalf("Expected the cached value to be %v, received %v", "microservices", string(storedEntry.Value))
+	}
+}
@@ -2,11 +2,16 @@ package id
 
 import (
 	"bitcask/clock"
+	"sync/atomic"
 )
 
-// TimestampBasedFileIdGenerator generates a new file based on the clock provided.
+// TimestampBasedFileIdGenerator generates a new file id based on the clock provided.
+// The generated file ids are strictly increasing: if the clock returns a time which is not after the last generated (or observed) file id,
+// because two ids are generated in the same clock tick, the clock steps backwards or the clock is fixed, the next file id is the last file id + 1.
+// The file ids of the existing files are observed during start-up (refer to Observe), so a new file id never collides with an existing file.
 type TimestampBasedFileIdGenerator struct {
-	clock clock.Clock
+	clock  clock.Clock
+	lastId atomic.Uint64
 }
 
 // NewTimestampBasedFileIdGenerator creates a new instance of TimestampBasedFileIdGenerator
@@ -14,7 +19,25 @@ func NewTimestampBasedFileIdGenerator(clock clock.Clock) *TimestampBasedFileIdGe
 	return &TimestampBasedFileIdGenerator{clock: clock}
 }
 
-// Next generates the new file id based on the current time of the clock
+// Next generates the new file id based on the current time of the clock, which is greater than all the file ids generated or observed before
 func (generator *TimestampBasedFileIdGenerator) Next() uint64 {
-	return uint64(generator.clock.Now())
+	for {
+		lastId, nextId := generator.lastId.Load(), uint64(generator.clock.Now())
+		if nextId <= lastId {
+			nextId = lastId + 1
+		}
+		if generator.lastId.CompareAndSwap(lastId, nextId) {
+			return nextId
+		}
+	}
+}
+
+// Observe records the file id of an existing file, so that all the file ids generated after it are greater than the observed file id
+func (generator *TimestampBasedFileIdGenerator) Observe(fileId uint64) {
+	for {
+		lastId := generator.lastId.Load()
+		if fileId <= lastId || generator.lastId.CompareAndSwap(lastId, fileId) {
+			return
+		}
+	}
 }
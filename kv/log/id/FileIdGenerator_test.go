@@ -1,6 +1,7 @@
 package id
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -16,3 +17,45 @@ func TestFileIdGenerator(t *testing.T) {
 		t.Fatalf("Expected id to be 1 received %v", next)
 	}
 }
+
+func TestFileIdGeneratorWithAFixedClockGeneratesIncreasingIds(t *testing.T) {
+	generator := NewTimestampBasedFileIdGenerator(&FixedClock{})
+	generator.Next()
+	if next := generator.Next(); next != 101 {
+		t.Fatalf("Expected id to be 101 received %v", next)
+	}
+}
+
+func TestFileIdGeneratorAfterObservingALargerFileId(t *testing.T) {
+	generator := NewTimestampBasedFileIdGenerator(&FixedClock{})
+	generator.Observe(500)
+	generator.Observe(200)
+	if next := generator.Next(); next != 501 {
+		t.Fatalf("Expected id to be 501 received %v", next)
+	}
+}
+
+func TestFileIdGeneratorGeneratesUniqueIdsConcurrently(t *testing.T) {
+	generator := NewTimestampBasedFileIdGenerator(&FixedClock{})
+	ids := make(chan uint64, 1000)
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < 10; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for count := 0; count < 100; count++ {
+				ids <- generator.Next()
+			}
+		}()
+	}
+	waitGroup.Wait()
+	close(ids)
+
+	unique := make(map[uint64]bool)
+	for id := range ids {
+		unique[id] = true
+	}
+	if len(unique) != 1000 {
+		t.Fatalf("Expected 1000 unique ids, received %v", len(unique))
+	}
+}
@@ -0,0 +1,55 @@
+package merge
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the bytes read and written by merge per second.
+// Every acquisition reserves the time needed to transfer its bytes at the configured rate, and waits until the reservations made before it have elapsed.
+// So, the bytes acquired before an acquisition are spread over at least (bytes / bytesPerSecond) seconds.
+type RateLimiter struct {
+	bytesPerSecond uint64
+	next           time.Time
+	lock           sync.Mutex
+}
+
+// NewRateLimiter creates a new instance of RateLimiter. A bytesPerSecond of 0 means no limit
+func NewRateLimiter(bytesPerSecond uint64) *RateLimiter {
+	return &RateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// Acquire blocks until `bytes` can be transferred without exceeding the rate. It returns the context error if the context is done while waiting
+func (limiter *RateLimiter) Acquire(ctx context.Context, bytes int64) error {
+	if limiter.bytesPerSecond == 0 || bytes <= 0 {
+		return nil
+	}
+	delay := limiter.reserve(bytes)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve reserves the time needed to transfer `bytes` and returns the duration to wait before the transfer is allowed
+func (limiter *RateLimiter) reserve(bytes int64) time.Duration {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(float64(bytes) / float64(limiter.bytesPerSecond) * float64(time.Second)))
+	return delay
+}
@@ -0,0 +1,46 @@
+package merge
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterLimitsTheBytesPerSecond(t *testing.T) {
+	limiter := NewRateLimiter(1000)
+
+	startTime := time.Now()
+	for count := 1; count <= 4; count++ {
+		_ = limiter.Acquire(context.Background(), 100)
+	}
+	elapsed := time.Since(startTime)
+
+	if elapsed < 300*time.Millisecond {
+		t.Fatalf("Expected acquiring 400 bytes at 1000 bytes per second to take at least %v, took %v", 300*time.Millisecond, elapsed)
+	}
+}
+
+func TestRateLimiterWithoutALimit(t *testing.T) {
+	limiter := NewRateLimiter(0)
+
+	startTime := time.Now()
+	_ = limiter.Acquire(context.Background(), 1<<30)
+	_ = limiter.Acquire(context.Background(), 1<<30)
+
+	if time.Since(startTime) > 100*time.Millisecond {
+		t.Fatalf("Expected no wait without a limit, took %v", time.Since(startTime))
+	}
+}
+
+func TestRateLimiterWithACancelledContext(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	_ = limiter.Acquire(context.Background(), 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := limiter.Acquire(ctx, 100)
+	if err != context.Canceled {
+		t.Fatalf("Expected %v, received %v", context.Canceled, err)
+	}
+}
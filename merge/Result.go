@@ -0,0 +1,41 @@
+package merge
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMergeInProgress is returned by Worker.Merge if another merge, manual or scheduled, is already running
+var ErrMergeInProgress = errors.New("merge is already in progress")
+
+// ErrMergePaused is returned by Worker.Merge if the Worker is paused
+var ErrMergePaused = errors.New("merge is paused")
+
+// ErrWorkerStopped is returned by Worker.Merge if the Worker is stopped
+var ErrWorkerStopped = errors.New("merge worker is stopped")
+
+// ErrOutsideMergeWindow is returned by a scheduled merge which is cancelled because the merge windows of MergeConfig have closed during the merge
+var ErrOutsideMergeWindow = errors.New("merge window is closed")
+
+// Result describes the outcome of a merge.
+// SegmentsRead is the number of inactive segments that were merged and removed, SegmentsWritten is the number of new inactive segments,
+// BytesReclaimed is the disk space freed by the merge (the bytes read from the segments minus the bytes written, both counted per chunk, so that a cancelled merge
+// does not report the bytes written for a segment it has not finished), EntriesDropped is the number of older values and deleted entries that were not written back
+// and Duration is the time taken by the merge.
+type Result struct {
+	SegmentsRead    int
+	SegmentsWritten int
+	BytesReclaimed  int64
+	EntriesDropped  int
+	Duration        time.Duration
+}
+
+// Outcome describes the last merge performed by a Worker, be it a merge of segments, a garbage collection of blob segments or a re-encryption.
+// StartedAt and CompletedAt are the times the merge started and completed, Result is its Result and Err is the error of a merge that failed or was cancelled.
+// A merge that finds nothing to merge does not have an Outcome.
+type Outcome struct {
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Result      *Result
+	Err         error
+}
@@ -0,0 +1,147 @@
+package merge
+
+import (
+	"bitcask/kv"
+	"sort"
+)
+
+// SegmentSelector decides which inactive segments take part in a merge.
+// Select receives the SegmentStats of all the inactive segments in the increasing order of their fileIds (oldest first) and the number of segments
+// to merge, and returns the fileIds of the selected segments in the increasing order.
+// If there are fewer inactive segments than `totalSegments`, a SegmentSelector selects from the available ones, it never returns more fileIds than
+// the available segments. Worker does not perform a merge if less than 2 segments are selected.
+type SegmentSelector interface {
+	Select(segments []*kv.SegmentStats, totalSegments int) []uint64
+}
+
+// OldestFirstSegmentSelector selects the segments with the smallest fileIds. FileIds are timestamp based, so these are the oldest segments.
+type OldestFirstSegmentSelector struct{}
+
+// SmallestFirstSegmentSelector selects the segments with the smallest size in bytes. Merging small segments is cheap and reduces the number of open files.
+type SmallestFirstSegmentSelector struct{}
+
+// MostGarbageFirstSegmentSelector selects the segments with the most garbage bytes, that is, the bytes that are not pointed to by the KeyDirectory.
+// This selection reclaims the most disk space for every byte read during merge.
+type MostGarbageFirstSegmentSelector struct{}
+
+// SizeTieredSegmentSelector groups the segments into tiers (buckets) of similar sizes and selects from the tier with the most segments.
+// A segment belongs to a tier if its size is between `bucketLow` and `bucketHigh` times the average size of the segments in that tier.
+// Merging segments of similar sizes avoids rewriting a large segment again and again only to merge a few small segments in it.
+type SizeTieredSegmentSelector struct {
+	bucketLow  float64
+	bucketHigh float64
+}
+
+// NewOldestFirstSegmentSelector creates a new instance of OldestFirstSegmentSelector
+func NewOldestFirstSegmentSelector() *OldestFirstSegmentSelector {
+	return &OldestFirstSegmentSelector{}
+}
+
+// NewSmallestFirstSegmentSelector creates a new instance of SmallestFirstSegmentSelector
+func NewSmallestFirstSegmentSelector() *SmallestFirstSegmentSelector {
+	return &SmallestFirstSegmentSelector{}
+}
+
+// NewMostGarbageFirstSegmentSelector creates a new instance of MostGarbageFirstSegmentSelector
+func NewMostGarbageFirstSegmentSelector() *MostGarbageFirstSegmentSelector {
+	return &MostGarbageFirstSegmentSelector{}
+}
+
+// NewSizeTieredSegmentSelector creates a new instance of SizeTieredSegmentSelector with the tier boundaries at 0.5 and 1.5 times the average tier size
+func NewSizeTieredSegmentSelector() *SizeTieredSegmentSelector {
+	return NewSizeTieredSegmentSelectorWithBuckets(0.5, 1.5)
+}
+
+// NewSizeTieredSegmentSelectorWithBuckets creates a new instance of SizeTieredSegmentSelector with the provided tier boundaries
+func NewSizeTieredSegmentSelectorWithBuckets(bucketLow float64, bucketHigh float64) *SizeTieredSegmentSelector {
+	return &SizeTieredSegmentSelector{bucketLow: bucketLow, bucketHigh: bucketHigh}
+}
+
+// Select selects the `totalSegments` oldest segments
+func (selector *OldestFirstSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	return selectFirst(sortedByFileId(segments), totalSegments)
+}
+
+// Select selects the `totalSegments` smallest segments, the ties are broken by picking the older segment
+func (selector *SmallestFirstSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	sorted := sortedByFileId(segments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TotalBytes < sorted[j].TotalBytes
+	})
+	return selectFirst(sorted, totalSegments)
+}
+
+// Select selects the `totalSegments` segments with the most garbage bytes, the ties are broken by picking the older segment
+func (selector *MostGarbageFirstSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	sorted := sortedByFileId(segments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GarbageBytes() > sorted[j].GarbageBytes()
+	})
+	return selectFirst(sorted, totalSegments)
+}
+
+// Select groups the segments into tiers and selects up to `totalSegments` smallest segments from the tier with the most segments.
+// If more than one tier has the most segments, the tier with the smaller segments is picked. A tier with a single segment is never picked because
+// there is nothing to merge it with, so Select returns no fileIds if no 2 segments are of similar sizes.
+func (selector *SizeTieredSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	sorted := sortedByFileId(segments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].TotalBytes < sorted[j].TotalBytes
+	})
+
+	var tiers [][]*kv.SegmentStats
+	var tierTotalBytes []int64
+	for _, segment := range sorted {
+		placed := false
+		for index, tier := range tiers {
+			average := float64(tierTotalBytes[index]) / float64(len(tier))
+			size := float64(segment.TotalBytes)
+			if size >= average*selector.bucketLow && size <= average*selector.bucketHigh {
+				tiers[index] = append(tier, segment)
+				tierTotalBytes[index] = tierTotalBytes[index] + segment.TotalBytes
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			tiers = append(tiers, []*kv.SegmentStats{segment})
+			tierTotalBytes = append(tierTotalBytes, segment.TotalBytes)
+		}
+	}
+
+	var selected []*kv.SegmentStats
+	for _, tier := range tiers {
+		if len(tier) >= 2 && len(tier) > len(selected) {
+			selected = tier
+		}
+	}
+	return selectFirst(selected, totalSegments)
+}
+
+// sortedByFileId returns a copy of the segments in the increasing order of their fileIds
+func sortedByFileId(segments []*kv.SegmentStats) []*kv.SegmentStats {
+	sorted := make([]*kv.SegmentStats, len(segments))
+	copy(sorted, segments)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].FileId < sorted[j].FileId
+	})
+	return sorted
+}
+
+// selectFirst returns the fileIds of the first `totalSegments` segments (or all the segments if there are fewer) in the increasing order
+func selectFirst(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	if totalSegments > len(segments) {
+		totalSegments = len(segments)
+	}
+	if totalSegments <= 0 {
+		return nil
+	}
+	fileIds := make([]uint64, totalSegments)
+	for index := 0; index < totalSegments; index++ {
+		fileIds[index] = segments[index].FileId
+	}
+	sort.Slice(fileIds, func(i, j int) bool {
+		return fileIds[i] < fileIds[j]
+	})
+	return fileIds
+}
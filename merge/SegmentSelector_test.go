@@ -0,0 +1,82 @@
+package merge
+
+import (
+	"bitcask/kv"
+	"reflect"
+	"testing"
+)
+
+func segmentStats() []*kv.SegmentStats {
+	return []*kv.SegmentStats{
+		{FileId: 40, TotalBytes: 100, LiveBytes: 10},
+		{FileId: 10, TotalBytes: 400, LiveBytes: 400},
+		{FileId: 30, TotalBytes: 90, LiveBytes: 90},
+		{FileId: 20, TotalBytes: 380, LiveBytes: 80},
+	}
+}
+
+func TestSelectOldestSegments(t *testing.T) {
+	fileIds := NewOldestFirstSegmentSelector().Select(segmentStats(), 2)
+
+	expected := []uint64{10, 20}
+	if !reflect.DeepEqual(expected, fileIds) {
+		t.Fatalf("Expected selected file ids to be %v, received %v", expected, fileIds)
+	}
+}
+
+func TestSelectSmallestSegments(t *testing.T) {
+	fileIds := NewSmallestFirstSegmentSelector().Select(segmentStats(), 2)
+
+	expected := []uint64{30, 40}
+	if !reflect.DeepEqual(expected, fileIds) {
+		t.Fatalf("Expected selected file ids to be %v, received %v", expected, fileIds)
+	}
+}
+
+func TestSelectSegmentsWithMostGarbage(t *testing.T) {
+	fileIds := NewMostGarbageFirstSegmentSelector().Select(segmentStats(), 2)
+
+	expected := []uint64{20, 40}
+	if !reflect.DeepEqual(expected, fileIds) {
+		t.Fatalf("Expected selected file ids to be %v, received %v", expected, fileIds)
+	}
+}
+
+func TestSelectSegmentsFromTheLargestSizeTier(t *testing.T) {
+	stats := append(segmentStats(), &kv.SegmentStats{FileId: 50, TotalBytes: 420, LiveBytes: 420})
+	fileIds := NewSizeTieredSegmentSelector().Select(stats, 4)
+
+	expected := []uint64{10, 20, 50}
+	if !reflect.DeepEqual(expected, fileIds) {
+		t.Fatalf("Expected selected file ids to be %v, received %v", expected, fileIds)
+	}
+}
+
+func TestSelectNoSegmentsIfNoSizeTierHasMoreThanOneSegment(t *testing.T) {
+	stats := []*kv.SegmentStats{
+		{FileId: 10, TotalBytes: 10},
+		{FileId: 20, TotalBytes: 1000},
+	}
+	fileIds := NewSizeTieredSegmentSelector().Select(stats, 2)
+
+	if len(fileIds) != 0 {
+		t.Fatalf("Expected no selected file ids, received %v", fileIds)
+	}
+}
+
+func TestSelectAllSegmentsIfFewerSegmentsThanRequested(t *testing.T) {
+	fileIds := NewOldestFirstSegmentSelector().Select(segmentStats(), 10)
+
+	expected := []uint64{10, 20, 30, 40}
+	if !reflect.DeepEqual(expected, fileIds) {
+		t.Fatalf("Expected selected file ids to be %v, received %v", expected, fileIds)
+	}
+}
+
+func TestSelectNoSegmentsIfThereAreNone(t *testing.T) {
+	fileIds := NewMostGarbageFirstSegmentSelector().Select(nil, 2)
+
+	if len(fileIds) != 0 {
+		t.Fatalf("Expected no selected file ids, received %v", fileIds)
+	}
+}
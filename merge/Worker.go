@@ -3,23 +3,54 @@ package merge
 import (
 	"bitcask/config"
 	"bitcask/kv"
-	"bitcask/kv/log"
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Worker encapsulates KVStore and MergeConfig. Worker is an abstraction inside merge package that performs merge of inactive segment files every fixed duration
+// Worker encapsulates KVStore, MergeConfig and SegmentSelector. Worker is an abstraction inside merge package that performs merge of inactive segment files every fixed duration
+// Worker also maintains a mergeLock which ensures that a manual merge and a scheduled merge never run concurrently.
+// The merge I/O is limited by the RateLimiter configured with `maxBytesPerSecond` of MergeConfig, and the merges can be paused and resumed.
+// Worker records the Outcome of the last merge, which can be read concurrently with a merge.
+// Worker notifies the config.EventListener of KVStore when a merge starts, finishes or fails, so the failures of the scheduled merges are not silently lost.
 type Worker[Key config.BitCaskKey] struct {
-	kvStore *kv.KVStore[Key]
-	config  *config.MergeConfig[Key]
-	quit    chan struct{}
+	kvStore     *kv.KVStore[Key]
+	config      *config.MergeConfig[Key]
+	selector    SegmentSelector
+	rateLimiter *RateLimiter
+	mergeLock   sync.Mutex
+	pauseLock   sync.Mutex
+	paused      bool
+	resumed     chan struct{}
+	quit        chan struct{}
+	stopped     chan struct{}
+	lastOutcome atomic.Pointer[Outcome]
+	now         func() time.Time
 }
 
-// NewWorker creates an instance of Worker and starts the Worker
+// throttle implements kv.MergeThrottle for the Worker. It blocks while the Worker is paused, cancels a scheduled merge once the merge windows have closed,
+// and then limits the rate of merge I/O
+type throttle[Key config.BitCaskKey] struct {
+	worker    *Worker[Key]
+	scheduled bool
+}
+
+// NewWorker creates an instance of Worker that selects the oldest inactive segments for merge, and starts the Worker
 func NewWorker[Key config.BitCaskKey](kvStore *kv.KVStore[Key], config *config.MergeConfig[Key]) *Worker[Key] {
+	return NewWorkerWithSegmentSelector[Key](kvStore, config, NewOldestFirstSegmentSelector())
+}
+
+// NewWorkerWithSegmentSelector creates an instance of Worker that uses the provided SegmentSelector to select the inactive segments for merge, and starts the Worker
+func NewWorkerWithSegmentSelector[Key config.BitCaskKey](kvStore *kv.KVStore[Key], config *config.MergeConfig[Key], selector SegmentSelector) *Worker[Key] {
 	worker := &Worker[Key]{
-		kvStore: kvStore,
-		config:  config,
-		quit:    make(chan struct{}),
+		kvStore:     kvStore,
+		config:      config,
+		selector:    selector,
+		rateLimiter: NewRateLimiter(config.MaxBytesPerSecond()),
+		quit:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		now:         time.Now,
 	}
 	worker.start()
 	return worker
@@ -29,6 +60,7 @@ func NewWorker[Key config.BitCaskKey](kvStore *kv.KVStore[Key], config *config.M
 func (worker *Worker[Key]) start() {
 	ticker := time.NewTicker(worker.config.RunMergeEvery())
 	go func() {
+		defer close(worker.stopped)
 		for {
 			select {
 			case <-ticker.C:
@@ -41,12 +73,15 @@ func (worker *Worker[Key]) start() {
 	}()
 }
 
-// beginMerge performs the merge operation. It is invoked every `runMergeEvery` duration defined in the MergeConfig
-// As a part of merge process, either all the inactive segments files are read or any of the K inactive segment files are read in memory.
-// Once those files are loaded in memory, an instance of MergedState is created that maintains a HashMap of Key and MappedStoredEntry.
-// MergedState is responsible for performing the merge operation. Merge operation is all about picking the latest value of a key
-// if it is present in 2 or more segment files.
-// Once the merge operation is done, the changes are written back to new inactive files and the in-memory state is updated in KeyDirectory.
+// beginMerge performs the merge operation. It is invoked every `runMergeEvery` duration defined in the MergeConfig.
+// A scheduled merge is skipped if the Worker is paused, if the current time is outside the merge windows of MergeConfig, or if a manual merge is in progress. Refer to Merge.
+// The merge windows are checked again between the chunks of a segment, and a scheduled merge which outlives the merge windows is cancelled with ErrOutsideMergeWindow.
+// A scheduled merge is cancelled when the Worker is stopped. The errors of a scheduled merge are reported to the config.EventListener, refer to recordOutcome.
+// As a part of merge process, either all the inactive segments files or K inactive segment files, chosen by the SegmentSelector, are merged.
+// The segments are not loaded in memory, each segment is streamed one entry at a time and the KeyDirectory decides which entries survive.
+// Merge operation is all about picking the latest value of a key if it is present in 2 or more segment files, and the latest value of a key
+// is the one that the KeyDirectory points to. So, an entry is retained only if the KeyDirectory still points to its fileId and offset.
+// The retained entries are written back to new inactive files and the in-memory state is updated in KeyDirectory.
 
 // Why do we need to update the in-memory state?
 // Assume a Key K1 with Value V1 and Timestamp T1 is present in the segment file F1. This key gets updated with value V2 at a later timestamp T2
@@ -63,6 +98,7 @@ func (worker *Worker[Key]) start() {
 
 // KeyDirectory contains K1 pointing to the offset of K1 in the segment file F2.
 // With this background, let's consider that the merge process starts, and it reads the contents of F1 and F2 and performs a merge.
+// The entry of K1 in F1 is not live because the KeyDirectory does not point to F1, whereas the entry of K1 in F2 is live.
 // The merge writes the key K1 with its new value V2 and timestamp T2 in a new file F3, and deletes files F1 and F2.
 
 //	 Segment file F3
@@ -71,29 +107,306 @@ func (worker *Worker[Key]) start() {
 //	└───────────┴──────────┴────────────┴─────┴───────┘
 //
 // The moment merge process is done, the state of Key K1 needs to be updated in the KeyDirectory to point to the new offset in the new file.
+//
+// Once the segments are merged, the blob segments with garbage are merged independently, refer to MergeBlobs,
+// and the segments encrypted with an older key are re-encrypted, refer to Reencrypt.
 func (worker *Worker[Key]) beginMerge() {
-	var fileIds []uint64
-	var segments [][]*log.MappedStoredEntry[Key]
-	var err error
+	if worker.IsPaused() || !worker.config.IsInMergeWindow(worker.now()) {
+		return
+	}
+	ctx := context.Background()
+	_, _ = worker.merge(ctx, true)
+	_, _ = worker.mergeBlobs(ctx, true)
+	_, _ = worker.reencrypt(ctx, true)
+}
+
+// Merge performs the merge operation synchronously and returns the Result of the merge.
+// Merge returns ErrMergeInProgress if another merge is running, ErrMergePaused if the Worker is paused and ErrWorkerStopped if the Worker is stopped.
+// The context is checked between segments, a cancelled merge returns the context error along with the Result of the segments merged before the cancellation.
+// Stopping the Worker cancels the merge in progress, manual or scheduled, just like the context, refer to Stop.
+// The merge windows of MergeConfig apply only to the scheduled merges, whereas the rate limit and the pause apply to all the merges.
+// A scheduled merge is cancelled between two chunks of a segment once the merge windows have closed, and returns ErrOutsideMergeWindow along with the Result so far.
+// Pausing the Worker during a merge suspends the merge between two chunks of a segment until the Worker is resumed or the context is done.
+// No merge is performed, and an empty Result is returned, if less than 2 segments are selected by the SegmentSelector.
+func (worker *Worker[Key]) Merge(ctx context.Context) (*Result, error) {
+	return worker.merge(ctx, false)
+}
+
+// merge performs the merge of segments, scheduled or manual, refer to Merge
+func (worker *Worker[Key]) merge(ctx context.Context, scheduled bool) (*Result, error) {
+	if worker.IsPaused() {
+		return nil, ErrMergePaused
+	}
+	if !worker.mergeLock.TryLock() {
+		return nil, ErrMergeInProgress
+	}
+	defer worker.mergeLock.Unlock()
+	if worker.isStopped() {
+		return nil, ErrWorkerStopped
+	}
+	if scheduled && !worker.config.IsInMergeWindow(worker.now()) {
+		return nil, ErrOutsideMergeWindow
+	}
+	ctx, cancel := worker.cancelOnStop(ctx)
+	defer cancel()
 
+	startTime := time.Now()
+	segmentStats := worker.kvStore.InactiveSegmentStats()
+	totalSegments := worker.config.TotalSegmentsToRead()
 	if worker.config.ShouldReadAllSegments() {
-		fileIds, segments, err = worker.kvStore.ReadAllInactiveSegments(worker.config.KeyMapper())
-	} else {
-		fileIds, segments, err = worker.kvStore.ReadInactiveSegments(worker.config.TotalSegmentsToRead(), worker.config.KeyMapper())
+		totalSegments = len(segmentStats)
+	}
+	selectedFileIds := worker.selector.Select(segmentStats, totalSegments)
+	if len(selectedFileIds) < 2 {
+		return &Result{Duration: time.Since(startTime)}, nil
+	}
+
+	worker.kvStore.EventListener().MergeStarted(config.MergeStartEvent{Kind: config.SegmentsMerge, FileIds: selectedFileIds})
+	response, err := worker.kvStore.MergeSegments(ctx, selectedFileIds, worker.config.KeyMapper(), throttle[Key]{worker: worker, scheduled: scheduled})
+	return worker.recordOutcome(config.SegmentsMerge, startTime, newResult(startTime, response), err)
+}
+
+// MergeBlobs performs the garbage collection of the inactive blob segments synchronously and returns the Result of the garbage collection.
+// Only the blob segments with garbage (blob entries which are no longer referred to by the KeyDirectory) are considered, and the SegmentSelector selects among them.
+// Unlike Merge, a single blob segment is worth merging, because its live blob entries are written to a new blob segment.
+// MergeBlobs shares the mergeLock, the pause and the rate limit with Merge, refer to Merge.
+func (worker *Worker[Key]) MergeBlobs(ctx context.Context) (*Result, error) {
+	return worker.mergeBlobs(ctx, false)
+}
+
+// mergeBlobs performs the garbage collection of blob segments, scheduled or manual, refer to MergeBlobs
+func (worker *Worker[Key]) mergeBlobs(ctx context.Context, scheduled bool) (*Result, error) {
+	if worker.IsPaused() {
+		return nil, ErrMergePaused
+	}
+	if !worker.mergeLock.TryLock() {
+		return nil, ErrMergeInProgress
+	}
+	defer worker.mergeLock.Unlock()
+	if worker.isStopped() {
+		return nil, ErrWorkerStopped
+	}
+	if scheduled && !worker.config.IsInMergeWindow(worker.now()) {
+		return nil, ErrOutsideMergeWindow
+	}
+	ctx, cancel := worker.cancelOnStop(ctx)
+	defer cancel()
+
+	startTime := time.Now()
+	var segmentStats []*kv.SegmentStats
+	for _, stats := range worker.kvStore.InactiveBlobSegmentStats() {
+		if stats.GarbageBytes() > 0 {
+			segmentStats = append(segmentStats, stats)
+		}
+	}
+	totalSegments := worker.config.TotalSegmentsToRead()
+	if worker.config.ShouldReadAllSegments() {
+		totalSegments = len(segmentStats)
+	}
+	selectedFileIds := worker.selector.Select(segmentStats, totalSegments)
+	if len(selectedFileIds) == 0 {
+		return &Result{Duration: time.Since(startTime)}, nil
+	}
+
+	worker.kvStore.EventListener().MergeStarted(config.MergeStartEvent{Kind: config.BlobSegmentsMerge, FileIds: selectedFileIds})
+	response, err := worker.kvStore.MergeBlobSegments(ctx, selectedFileIds, worker.config.KeyMapper(), throttle[Key]{worker: worker, scheduled: scheduled})
+	return worker.recordOutcome(config.BlobSegmentsMerge, startTime, newResult(startTime, response), err)
+}
+
+// Reencrypt merges all the inactive segments and the inactive blob segments which are not encrypted with the current key of the config.KeyProvider,
+// including the segments written before encryption was enabled. The live entries are written to new segments which are encrypted with the current key,
+// so once Reencrypt completes, the older keys are no longer needed to read the inactive segments. The active segment is encrypted with the key that was current
+// when it was created, it is re-encrypted once it becomes inactive. No merge is performed, and an empty Result is returned, if encryption is not enabled.
+// Reencrypt shares the mergeLock, the pause and the rate limit with Merge, refer to Merge.
+func (worker *Worker[Key]) Reencrypt(ctx context.Context) (*Result, error) {
+	return worker.reencrypt(ctx, false)
+}
+
+// reencrypt performs the re-encryption of segments, scheduled or manual, refer to Reencrypt
+func (worker *Worker[Key]) reencrypt(ctx context.Context, scheduled bool) (*Result, error) {
+	if worker.IsPaused() {
+		return nil, ErrMergePaused
+	}
+	if !worker.mergeLock.TryLock() {
+		return nil, ErrMergeInProgress
+	}
+	defer worker.mergeLock.Unlock()
+	if worker.isStopped() {
+		return nil, ErrWorkerStopped
+	}
+	if scheduled && !worker.config.IsInMergeWindow(worker.now()) {
+		return nil, ErrOutsideMergeWindow
+	}
+	ctx, cancel := worker.cancelOnStop(ctx)
+	defer cancel()
+
+	startTime := time.Now()
+	currentKeyId, encrypted := worker.kvStore.CurrentKeyId()
+	if !encrypted {
+		return &Result{Duration: time.Since(startTime)}, nil
+	}
+	staleFileIds := func(segmentStats []*kv.SegmentStats) []uint64 {
+		var fileIds []uint64
+		for _, stats := range segmentStats {
+			if !stats.Encrypted || stats.KeyId != currentKeyId {
+				fileIds = append(fileIds, stats.FileId)
+			}
+		}
+		return fileIds
 	}
 
-	if err == nil && len(segments) >= 2 {
-		mergedState := NewMergedState[Key]()
-		mergedState.takeAll(segments[0])
+	segmentFileIds := staleFileIds(worker.kvStore.InactiveSegmentStats())
+	blobSegmentFileIds := staleFileIds(worker.kvStore.InactiveBlobSegmentStats())
+	response := &kv.MergeSegmentsResponse{}
+	if len(segmentFileIds) == 0 && len(blobSegmentFileIds) == 0 {
+		return newResult(startTime, response), nil
+	}
 
-		for index := 1; index < len(segments); index++ {
-			mergedState.mergeWith(segments[index])
+	worker.kvStore.EventListener().MergeStarted(config.MergeStartEvent{Kind: config.Reencryption, FileIds: append(append([]uint64(nil), segmentFileIds...), blobSegmentFileIds...)})
+	if len(segmentFileIds) > 0 {
+		segmentsResponse, err := worker.kvStore.MergeSegments(ctx, segmentFileIds, worker.config.KeyMapper(), throttle[Key]{worker: worker, scheduled: scheduled})
+		response.Add(segmentsResponse)
+		if err != nil {
+			return worker.recordOutcome(config.Reencryption, startTime, newResult(startTime, response), err)
 		}
-		_ = worker.kvStore.WriteBack(fileIds, mergedState.valueByKey)
 	}
+	if len(blobSegmentFileIds) > 0 {
+		blobSegmentsResponse, err := worker.kvStore.MergeBlobSegments(ctx, blobSegmentFileIds, worker.config.KeyMapper(), throttle[Key]{worker: worker, scheduled: scheduled})
+		response.Add(blobSegmentsResponse)
+		if err != nil {
+			return worker.recordOutcome(config.Reencryption, startTime, newResult(startTime, response), err)
+		}
+	}
+	return worker.recordOutcome(config.Reencryption, startTime, newResult(startTime, response), nil)
+}
+
+// LastOutcome returns the Outcome of the last merge performed by the Worker, nil if no merge has been performed since the Worker was created
+func (worker *Worker[Key]) LastOutcome() *Outcome {
+	return worker.lastOutcome.Load()
+}
+
+// recordOutcome records the Outcome of a merge of the kind which started at startTime (and the merge in the metrics of KVStore), notifies the config.EventListener
+// that the merge finished or failed, and returns the result and the error of the merge
+func (worker *Worker[Key]) recordOutcome(kind config.MergeKind, startTime time.Time, result *Result, err error) (*Result, error) {
+	completedAt := time.Now()
+	worker.lastOutcome.Store(&Outcome{StartedAt: startTime, CompletedAt: completedAt, Result: result, Err: err})
+	worker.kvStore.Metrics().ObserveMerge(completedAt.Sub(startTime), err)
+	if err != nil {
+		worker.kvStore.EventListener().MergeFailed(config.MergeFailureEvent{Kind: kind, StartedAt: startTime, Duration: completedAt.Sub(startTime), Err: err})
+	} else {
+		worker.kvStore.EventListener().MergeFinished(config.MergeFinishEvent{
+			Kind:            kind,
+			StartedAt:       startTime,
+			Duration:        completedAt.Sub(startTime),
+			SegmentsRead:    result.SegmentsRead,
+			SegmentsWritten: result.SegmentsWritten,
+			BytesReclaimed:  result.BytesReclaimed,
+			EntriesDropped:  result.EntriesDropped,
+		})
+	}
+	return result, err
+}
+
+// Pause pauses the merges. Scheduled merges are skipped, manual merges are rejected and a merge in progress is suspended until Resume is invoked
+func (worker *Worker[Key]) Pause() {
+	worker.pauseLock.Lock()
+	defer worker.pauseLock.Unlock()
+
+	if !worker.paused {
+		worker.paused = true
+		worker.resumed = make(chan struct{})
+	}
+}
+
+// Resume resumes the merges, including a merge that was suspended by Pause
+func (worker *Worker[Key]) Resume() {
+	worker.pauseLock.Lock()
+	defer worker.pauseLock.Unlock()
+
+	if worker.paused {
+		worker.paused = false
+		close(worker.resumed)
+	}
+}
+
+// IsPaused returns true if the Worker is paused
+func (worker *Worker[Key]) IsPaused() bool {
+	worker.pauseLock.Lock()
+	defer worker.pauseLock.Unlock()
+
+	return worker.paused
 }
 
-// Stop closes the quit channel which is used to signal the merge goroutine to stop
+// waitWhilePaused blocks while the Worker is paused. It returns the context error if the context is done while waiting
+func (worker *Worker[Key]) waitWhilePaused(ctx context.Context) error {
+	worker.pauseLock.Lock()
+	paused, resumed := worker.paused, worker.resumed
+	worker.pauseLock.Unlock()
+
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Acquire waits while the Worker is paused, returns ErrOutsideMergeWindow if the merge is scheduled and the merge windows have closed,
+// and then acquires the bytes from the RateLimiter of the Worker
+func (throttle throttle[Key]) Acquire(ctx context.Context, bytes int64) error {
+	if err := throttle.worker.waitWhilePaused(ctx); err != nil {
+		return err
+	}
+	if throttle.scheduled && !throttle.worker.config.IsInMergeWindow(throttle.worker.now()) {
+		return ErrOutsideMergeWindow
+	}
+	return throttle.worker.rateLimiter.Acquire(ctx, bytes)
+}
+
+// newResult creates the Result of a merge which started at startTime
+func newResult(startTime time.Time, response *kv.MergeSegmentsResponse) *Result {
+	return &Result{
+		SegmentsRead:    response.SegmentsRead,
+		SegmentsWritten: response.SegmentsWritten,
+		BytesReclaimed:  response.BytesRead - response.BytesWritten,
+		EntriesDropped:  response.EntriesDropped,
+		Duration:        time.Since(startTime),
+	}
+}
+
+// Stop closes the quit channel which is used to signal the merge goroutine to stop, and cancels the merge in progress, manual or scheduled.
+// Stop waits for the merge goroutine to exit and for the merge in progress to return, so no merge writes to KVStore once Stop returns and KVStore can be shut down.
+// A merge attempted after Stop returns ErrWorkerStopped
 func (worker *Worker[Key]) Stop() {
 	close(worker.quit)
+	<-worker.stopped
+
+	worker.mergeLock.Lock()
+	worker.mergeLock.Unlock()
+}
+
+// isStopped returns true if the Worker is stopped
+func (worker *Worker[Key]) isStopped() bool {
+	select {
+	case <-worker.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// cancelOnStop returns a copy of the context which is cancelled when the Worker is stopped, along with its cancel function
+func (worker *Worker[Key]) cancelOnStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-worker.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
@@ -3,10 +3,20 @@ package merge
 import (
 	bitCaskConfig "bitcask/config"
 	kv "bitcask/kv"
+	"bitcask/metrics"
+	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 )
 
+type serializableKey string
+
+func (key serializableKey) Serialize() []byte {
+	return []byte(key)
+}
+
 func TestMergeSegmentsWithUpdate(t *testing.T) {
 	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
 		return serializableKey(key)
@@ -100,3 +110,608 @@ func TestMergeSegmentsOnSchedule(t *testing.T) {
 		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
 	}
 }
+
+// collidingTimestampClock generates strictly increasing times whose lower 32 bits, which become the timestamp of an entry, are always the same
+type collidingTimestampClock struct {
+	counter int64
+}
+
+func (clock *collidingTimestampClock) Now() int64 {
+	clock.counter = clock.counter + 1
+	return clock.counter<<32 | 7
+}
+
+type newestFirstSegmentSelector struct{}
+
+func (selector newestFirstSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	var fileIds []uint64
+	for index := len(segments) - 1; index >= 0 && len(fileIds) < totalSegments; index-- {
+		fileIds = append([]uint64{segments[index].FileId}, fileIds...)
+	}
+	return fileIds
+}
+
+func TestMergeSegmentsWithCollidingTimestamps(t *testing.T) {
+	config := bitCaskConfig.NewConfigWithClock(".", 8, 16, bitCaskConfig.NewMergeConfig(3, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}), &collidingTimestampClock{})
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("ssd"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("engine", []byte("bitcask"))
+
+	worker.beginMerge()
+
+	value, _ := store.Get("topic")
+	if string(value) != "bitcask" {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
+	}
+}
+
+func TestMergeSegmentsAndUpdateAfterMergeSurvivesReload(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+
+	worker := NewWorker(store, config.MergeConfig())
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("ssd"))
+	_ = store.Put("engine", []byte("bitcask"))
+
+	worker.beginMerge()
+	worker.Stop()
+
+	_ = store.Put("topic", []byte("bitcask"))
+	store.Sync()
+	store.Shutdown()
+
+	store, _ = kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	value, _ := store.Get("topic")
+	if string(value) != "bitcask" {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
+	}
+}
+
+func TestMergeSegmentsRetainsTombstoneOfAKeyInAnOlderSegment(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfig(2, func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+
+	worker := NewWorkerWithSegmentSelector(store, config.MergeConfig(), newestFirstSegmentSelector{})
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("ssd"))
+	_ = store.Delete("topic")
+	_ = store.Put("engine", []byte("bitcask"))
+
+	worker.beginMerge()
+	worker.Stop()
+
+	store.Sync()
+	store.Shutdown()
+
+	store, _ = kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	value, ok := store.SilentGet("topic")
+	if ok {
+		t.Fatalf("Expected value to be missing for the key %v, received %v", "topic", string(value))
+	}
+	value, _ = store.Get("disk")
+	if string(value) != "ssd" {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(value))
+	}
+}
+
+func TestMergeReturnsTheResult(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Delete("topic")
+	_ = store.Put("disk", []byte("ssd"))
+
+	result, err := worker.Merge(context.Background())
+	if err != nil {
+		t.Fatalf("Expected merge to succeed, received %v", err)
+	}
+	if result.SegmentsRead != 3 {
+		t.Fatalf("Expected %v segments to be read, received %v", 3, result.SegmentsRead)
+	}
+	if result.SegmentsWritten != 0 {
+		t.Fatalf("Expected %v segments to be written, received %v", 0, result.SegmentsWritten)
+	}
+	if result.EntriesDropped != 3 {
+		t.Fatalf("Expected %v entries to be dropped, received %v", 3, result.EntriesDropped)
+	}
+	if result.BytesReclaimed <= 0 {
+		t.Fatalf("Expected bytes to be reclaimed, received %v", result.BytesReclaimed)
+	}
+}
+
+func TestMergeWithACancelledContext(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := worker.Merge(ctx)
+	if err != context.Canceled {
+		t.Fatalf("Expected %v, received %v", context.Canceled, err)
+	}
+	if result.SegmentsRead != 0 {
+		t.Fatalf("Expected no segments to be read, received %v", result.SegmentsRead)
+	}
+	value, _ := store.Get("topic")
+	if string(value) != "bitcask" {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
+	}
+}
+
+func TestMergeWhileAnotherMergeIsInProgress(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	worker.mergeLock.Lock()
+	defer worker.mergeLock.Unlock()
+
+	_, err := worker.Merge(context.Background())
+	if err != ErrMergeInProgress {
+		t.Fatalf("Expected %v, received %v", ErrMergeInProgress, err)
+	}
+}
+
+func TestMergeWhileTheWorkerIsPaused(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	worker.Pause()
+	_, err := worker.Merge(context.Background())
+	if err != ErrMergePaused {
+		t.Fatalf("Expected %v, received %v", ErrMergePaused, err)
+	}
+
+	worker.Resume()
+	_, err = worker.Merge(context.Background())
+	if err != nil {
+		t.Fatalf("Expected merge to succeed after resume, received %v", err)
+	}
+}
+
+func TestPauseSuspendsAMergeInProgress(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	worker.Pause()
+	acquired := make(chan error)
+	go func() {
+		acquired <- throttle[serializableKey]{worker: worker}.Acquire(context.Background(), 10)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Expected the merge to be suspended while the worker is paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	worker.Resume()
+	if err := <-acquired; err != nil {
+		t.Fatalf("Expected the merge to continue after resume, received %v", err)
+	}
+}
+
+// pausingSegmentSelector selects all the segments and pauses the Worker, so that the merge is suspended at its first chunk
+type pausingSegmentSelector struct {
+	worker *Worker[serializableKey]
+}
+
+func (selector *pausingSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	selector.worker.Pause()
+	return NewOldestFirstSegmentSelector().Select(segments, totalSegments)
+}
+
+func TestStopCancelsAndWaitsForAMergeInProgress(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("ssd"))
+	_ = store.Put("engine", []byte("bitcask"))
+
+	selector := &pausingSegmentSelector{}
+	worker := NewWorkerWithSegmentSelector[serializableKey](store, config.MergeConfig(), selector)
+	selector.worker = worker
+
+	merged := make(chan error, 1)
+	go func() {
+		_, err := worker.Merge(context.Background())
+		merged <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	worker.Stop()
+	outcome := worker.LastOutcome()
+	if outcome == nil || !errors.Is(outcome.Err, context.Canceled) {
+		t.Fatalf("Expected Stop to cancel and wait for the merge in progress, received the outcome %v", outcome)
+	}
+	if err := <-merged; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected %v, received %v", context.Canceled, err)
+	}
+
+	worker.Resume()
+	if _, err := worker.Merge(context.Background()); err != ErrWorkerStopped {
+		t.Fatalf("Expected %v, received %v", ErrWorkerStopped, err)
+	}
+}
+
+func TestScheduledMergeOutsideTheMergeWindow(t *testing.T) {
+	now := time.Now()
+	window, _ := bitCaskConfig.NewMergeWindow((now.Hour()+12)%24, 0, (now.Hour()+13)%24, 0)
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}).WithMergeWindows(window))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+
+	segmentsBeforeMerge := len(store.InactiveSegmentStats())
+	worker.beginMerge()
+
+	if len(store.InactiveSegmentStats()) != segmentsBeforeMerge {
+		t.Fatalf("Expected no merge outside the merge window, inactive segments changed from %v to %v", segmentsBeforeMerge, len(store.InactiveSegmentStats()))
+	}
+}
+
+// closingWindowSegmentSelector selects all the segments and moves the clock of the Worker past the merge windows, so that the merge windows close during the merge
+type closingWindowSegmentSelector struct {
+	worker  *Worker[serializableKey]
+	closeAt time.Time
+}
+
+func (selector *closingWindowSegmentSelector) Select(segments []*kv.SegmentStats, totalSegments int) []uint64 {
+	selector.worker.now = func() time.Time {
+		return selector.closeAt
+	}
+	return NewOldestFirstSegmentSelector().Select(segments, totalSegments)
+}
+
+func TestScheduledMergeIsCancelledWhenTheMergeWindowCloses(t *testing.T) {
+	window, _ := bitCaskConfig.NewMergeWindow(1, 0, 5, 0)
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}).WithMergeWindows(window))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+	_ = store.Put("engine", []byte("bitcask"))
+
+	day := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local)
+	selector := &closingWindowSegmentSelector{closeAt: day.Add(6 * time.Hour)}
+	worker := NewWorkerWithSegmentSelector[serializableKey](store, config.MergeConfig(), selector)
+	defer worker.Stop()
+	selector.worker = worker
+	worker.now = func() time.Time {
+		return day.Add(2 * time.Hour)
+	}
+
+	segmentsBeforeMerge := len(store.InactiveSegmentStats())
+	worker.beginMerge()
+
+	outcome := worker.LastOutcome()
+	if outcome == nil || !errors.Is(outcome.Err, ErrOutsideMergeWindow) {
+		t.Fatalf("Expected the scheduled merge to be cancelled with %v, received the outcome %v", ErrOutsideMergeWindow, outcome)
+	}
+	if outcome.Result == nil || outcome.Result.SegmentsRead >= segmentsBeforeMerge {
+		t.Fatalf("Expected a partial result of less than %v segments read, received %v", segmentsBeforeMerge, outcome.Result)
+	}
+	value, _ := store.Get("topic")
+	if string(value) != "bitcask" {
+		t.Fatalf("Expected value to be %v, received %v", "bitcask", string(value))
+	}
+	value, _ = store.Get("disk")
+	if string(value) != "ssd" {
+		t.Fatalf("Expected value to be %v, received %v", "ssd", string(value))
+	}
+}
+
+func TestMergeBlobsReclaimsOnlyTheBlobSegmentsWithGarbage(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithBlobValueThreshold(8)
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("solid state drive"))
+	_ = store.Put("topic", []byte("distributed systems"))
+	_ = store.Put("engine", []byte("bitcask storage"))
+
+	result, err := worker.MergeBlobs(context.Background())
+	if err != nil {
+		t.Fatalf("Expected merge of blobs to succeed, received %v", err)
+	}
+	if result.SegmentsRead != 1 || result.SegmentsWritten != 0 || result.EntriesDropped != 1 {
+		t.Fatalf("Expected 1 blob segment to be read, 0 to be written and 1 entry to be dropped, received %v, %v and %v",
+			result.SegmentsRead, result.SegmentsWritten, result.EntriesDropped)
+	}
+	if result.BytesReclaimed <= 0 {
+		t.Fatalf("Expected bytes to be reclaimed, received %v", result.BytesReclaimed)
+	}
+
+	value, _ := store.Get("topic")
+	if string(value) != "distributed systems" {
+		t.Fatalf("Expected value to be %v, received %v", "distributed systems", string(value))
+	}
+	value, _ = store.Get("disk")
+	if string(value) != "solid state drive" {
+		t.Fatalf("Expected value to be %v, received %v", "solid state drive", string(value))
+	}
+}
+
+func TestReencryptMovesTheSegmentsToTheCurrentKey(t *testing.T) {
+	keyProvider := bitCaskConfig.NewInMemoryKeyProvider(1, []byte("0123456789abcdef"))
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithKeyProvider(keyProvider).WithBlobValueThreshold(16)
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("solid state drive with a large value"))
+	keyProvider.Rotate(2, []byte("fedcba9876543210"))
+	_ = store.Put("engine", []byte("bitcask"))
+	_ = store.Put("paper", []byte("riak"))
+
+	result, err := worker.Reencrypt(context.Background())
+	if err != nil {
+		t.Fatalf("Expected re-encryption to succeed, received %v", err)
+	}
+	if result.SegmentsRead == 0 {
+		t.Fatalf("Expected the segments encrypted with the older key to be read, received %v segments", result.SegmentsRead)
+	}
+	for _, stats := range append(store.InactiveSegmentStats(), store.InactiveBlobSegmentStats()...) {
+		if !stats.Encrypted || stats.KeyId != 2 {
+			t.Fatalf("Expected the inactive segment %v to be encrypted with the key id %v, received %v", stats.FileId, 2, stats.KeyId)
+		}
+	}
+
+	value, _ := store.Get("topic")
+	if string(value) != "microservices" {
+		t.Fatalf("Expected value to be %v, received %v", "microservices", string(value))
+	}
+	value, _ = store.Get("disk")
+	if string(value) != "solid state drive with a large value" {
+		t.Fatalf("Expected value to be %v, received %v", "solid state drive with a large value", string(value))
+	}
+}
+
+func TestReencryptWithoutEncryption(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("disk", []byte("ssd"))
+
+	result, err := worker.Reencrypt(context.Background())
+	if err != nil || result.SegmentsRead != 0 {
+		t.Fatalf("Expected no segments to be read without encryption, received %v segments and %v", result.SegmentsRead, err)
+	}
+}
+
+func TestMergeRecordsTheLastOutcome(t *testing.T) {
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	}))
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	if worker.LastOutcome() != nil {
+		t.Fatalf("Expected no outcome before the first merge, received %v", worker.LastOutcome())
+	}
+	if _, _ = worker.Merge(context.Background()); worker.LastOutcome() != nil {
+		t.Fatalf("Expected no outcome for a merge with nothing to merge, received %v", worker.LastOutcome())
+	}
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+
+	result, _ := worker.Merge(context.Background())
+	outcome := worker.LastOutcome()
+	if outcome == nil || outcome.Result != result || outcome.Err != nil {
+		t.Fatalf("Expected the outcome to record the result %v of the merge, received %v", result, outcome)
+	}
+	if outcome.StartedAt.IsZero() || outcome.CompletedAt.Before(outcome.StartedAt) {
+		t.Fatalf("Expected the merge to start at %v and complete later, completed at %v", outcome.StartedAt, outcome.CompletedAt)
+	}
+}
+
+func TestMergeRecordsTheMergeInTheMetrics(t *testing.T) {
+	mergeMetrics := metrics.NewMetrics()
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithMetrics(mergeMetrics)
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+	_, _ = worker.Merge(context.Background())
+
+	builder := &strings.Builder{}
+	_ = mergeMetrics.Write(builder)
+	for _, expected := range []string{
+		`bitcask_merge_runs_total{outcome="success"} 1` + "\n",
+		`bitcask_merge_runs_total{outcome="failure"} 0` + "\n",
+		"bitcask_merge_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(builder.String(), expected) {
+			t.Fatalf("Expected the metrics to contain %q, received\n%v", expected, builder.String())
+		}
+	}
+}
+
+type recordingEventListener struct {
+	bitCaskConfig.NoOpEventListener
+	starts   []bitCaskConfig.MergeStartEvent
+	finishes []bitCaskConfig.MergeFinishEvent
+	failures []bitCaskConfig.MergeFailureEvent
+	removals []bitCaskConfig.SegmentRemovalEvent
+}
+
+func (listener *recordingEventListener) MergeStarted(event bitCaskConfig.MergeStartEvent) {
+	listener.starts = append(listener.starts, event)
+}
+
+func (listener *recordingEventListener) MergeFinished(event bitCaskConfig.MergeFinishEvent) {
+	listener.finishes = append(listener.finishes, event)
+}
+
+func (listener *recordingEventListener) MergeFailed(event bitCaskConfig.MergeFailureEvent) {
+	listener.failures = append(listener.failures, event)
+}
+
+func (listener *recordingEventListener) SegmentRemoved(event bitCaskConfig.SegmentRemovalEvent) {
+	listener.removals = append(listener.removals, event)
+}
+
+func TestMergeNotifiesTheEventListener(t *testing.T) {
+	listener := &recordingEventListener{}
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithEventListener(listener)
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+
+	result, _ := worker.Merge(context.Background())
+	if len(listener.starts) != 1 || listener.starts[0].Kind != bitCaskConfig.SegmentsMerge || len(listener.starts[0].FileIds) != result.SegmentsRead {
+		t.Fatalf("Expected a start of a merge of %v segments, received %v", result.SegmentsRead, listener.starts)
+	}
+	if len(listener.finishes) != 1 || listener.finishes[0].SegmentsRead != result.SegmentsRead || listener.finishes[0].EntriesDropped != result.EntriesDropped {
+		t.Fatalf("Expected a finish of the merge with the result %v, received %v", result, listener.finishes)
+	}
+	if len(listener.failures) != 0 {
+		t.Fatalf("Expected no failure, received %v", listener.failures)
+	}
+	merged := 0
+	for _, removal := range listener.removals {
+		if removal.Reason == bitCaskConfig.SegmentMerged {
+			merged = merged + 1
+		}
+	}
+	if merged != result.SegmentsRead {
+		t.Fatalf("Expected %v merged segments to be removed, received %v", result.SegmentsRead, merged)
+	}
+}
+
+func TestCancelledMergeNotifiesTheEventListenerOfTheFailure(t *testing.T) {
+	listener := &recordingEventListener{}
+	config := bitCaskConfig.NewConfig(".", 8, 16, bitCaskConfig.NewMergeConfigWithAllSegmentsToRead(func(key []byte) serializableKey {
+		return serializableKey(key)
+	})).WithEventListener(listener)
+	store, _ := kv.NewKVStore[serializableKey](config)
+	defer store.ClearLog()
+
+	worker := NewWorker(store, config.MergeConfig())
+	defer worker.Stop()
+
+	_ = store.Put("topic", []byte("microservices"))
+	_ = store.Put("topic", []byte("bitcask"))
+	_ = store.Put("disk", []byte("ssd"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _ = worker.Merge(ctx)
+
+	if len(listener.starts) != 1 || len(listener.finishes) != 0 {
+		t.Fatalf("Expected a start and no finish of the merge, received %v and %v", listener.starts, listener.finishes)
+	}
+	if len(listener.failures) != 1 || listener.failures[0].Err != context.Canceled {
+		t.Fatalf("Expected a failure of the merge with %v, received %v", context.Canceled, listener.failures)
+	}
+}
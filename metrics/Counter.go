@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing count, exposed as a Prometheus counter
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Add adds delta to the Counter
+func (counter *Counter) Add(delta uint64) {
+	counter.value.Add(delta)
+}
+
+// Inc increments the Counter by 1
+func (counter *Counter) Inc() {
+	counter.value.Add(1)
+}
+
+// Value returns the current count
+func (counter *Counter) Value() uint64 {
+	return counter.value.Load()
+}
+
+// writeTo writes the sample of the Counter in the Prometheus text exposition format
+func (counter *Counter) writeTo(writer io.Writer, name string, labels string) error {
+	_, err := fmt.Fprintf(writer, "%v%v %v\n", name, labels, counter.Value())
+	return err
+}
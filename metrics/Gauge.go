@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+// Gauge is a value that can go up and down, exposed as a Prometheus gauge. The value is stored as the bits of a float64, so that it is updated atomically
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the value of the Gauge
+func (gauge *Gauge) Set(value float64) {
+	gauge.bits.Store(math.Float64bits(value))
+}
+
+// Value returns the current value of the Gauge
+func (gauge *Gauge) Value() float64 {
+	return math.Float64frombits(gauge.bits.Load())
+}
+
+// writeTo writes the sample of the Gauge in the Prometheus text exposition format
+func (gauge *Gauge) writeTo(writer io.Writer, name string, labels string) error {
+	_, err := fmt.Fprintf(writer, "%v%v %v\n", name, labels, formatFloat(gauge.Value()))
+	return err
+}
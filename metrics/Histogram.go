@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Histogram counts the observed values in buckets with fixed upper bounds, exposed as a Prometheus histogram.
+// counts[index] is the number of observations less than or equal to upperBounds[index] and greater than the previous upper bound,
+// and the last (overflow) bucket counts the observations greater than the largest upper bound. The buckets are made cumulative when the Histogram is written,
+// and the count is the sum of all the buckets, so the written buckets are always monotonic and the +Inf bucket always equals the count.
+// Every field is atomic, so Observe does not need a lock, but a concurrent write may see an observation in the buckets before it sees it in sum.
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64
+	sumBits     atomic.Uint64
+}
+
+// NewHistogram creates a new instance of Histogram with the upper bounds of its buckets, which are sorted in the increasing order
+func NewHistogram(upperBounds []float64) *Histogram {
+	sorted := make([]float64, len(upperBounds))
+	copy(sorted, upperBounds)
+	sort.Float64s(sorted)
+	return &Histogram{
+		upperBounds: sorted,
+		counts:      make([]atomic.Uint64, len(sorted)+1),
+	}
+}
+
+// Observe adds the value to the bucket with the smallest upper bound greater than or equal to the value (or to the overflow bucket), and to the sum of the Histogram
+func (histogram *Histogram) Observe(value float64) {
+	histogram.counts[sort.SearchFloat64s(histogram.upperBounds, value)].Add(1)
+	for {
+		current := histogram.sumBits.Load()
+		if histogram.sumBits.CompareAndSwap(current, math.Float64bits(math.Float64frombits(current)+value)) {
+			return
+		}
+	}
+}
+
+// ObserveDuration observes the duration in seconds
+func (histogram *Histogram) ObserveDuration(duration time.Duration) {
+	histogram.Observe(duration.Seconds())
+}
+
+// Count returns the number of observations, which is the sum of all the buckets
+func (histogram *Histogram) Count() uint64 {
+	var count uint64
+	for index := range histogram.counts {
+		count = count + histogram.counts[index].Load()
+	}
+	return count
+}
+
+// Sum returns the sum of the observations
+func (histogram *Histogram) Sum() float64 {
+	return math.Float64frombits(histogram.sumBits.Load())
+}
+
+// writeTo writes the cumulative buckets, the sum and the count of the Histogram in the Prometheus text exposition format.
+// labels are the labels of the series (without the le label), formatted as {name="value",...} or empty.
+// Every bucket is loaded once, and the +Inf bucket and the count are the cumulative count of the loaded buckets, so that a concurrent Observe never makes the buckets decrease
+func (histogram *Histogram) writeTo(writer io.Writer, name string, labels string) error {
+	var cumulativeCount uint64
+	for index, upperBound := range histogram.upperBounds {
+		cumulativeCount = cumulativeCount + histogram.counts[index].Load()
+		if _, err := fmt.Fprintf(writer, "%v_bucket%v %v\n", name, withLabel(labels, "le", formatFloat(upperBound)), cumulativeCount); err != nil {
+			return err
+		}
+	}
+	count := cumulativeCount + histogram.counts[len(histogram.upperBounds)].Load()
+	if _, err := fmt.Fprintf(writer, "%v_bucket%v %v\n", name, withLabel(labels, "le", "+Inf"), count); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(writer, "%v_sum%v %v\n", name, labels, formatFloat(histogram.Sum())); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(writer, "%v_count%v %v\n", name, labels, count)
+	return err
+}
+
+// withLabel adds the label to the formatted labels
+func withLabel(labels string, name string, value string) string {
+	label := fmt.Sprintf("%v=%q", name, value)
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + label + "}"
+}
+
+// formatFloat formats the value as expected by the Prometheus text exposition format
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
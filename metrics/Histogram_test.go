@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramCountsTheObservationsInBuckets(t *testing.T) {
+	histogram := NewHistogram([]float64{1, 0.1, 0.5})
+	histogram.Observe(0.05)
+	histogram.Observe(0.1)
+	histogram.Observe(0.3)
+	histogram.Observe(2)
+
+	if histogram.Count() != 4 {
+		t.Fatalf("Expected %v observations, received %v", 4, histogram.Count())
+	}
+	if histogram.Sum() != 2.45 {
+		t.Fatalf("Expected the sum of the observations to be %v, received %v", 2.45, histogram.Sum())
+	}
+
+	builder := &strings.Builder{}
+	_ = histogram.writeTo(builder, "latency_seconds", `{operation="put"}`)
+
+	expected := `latency_seconds_bucket{operation="put",le="0.1"} 2
+latency_seconds_bucket{operation="put",le="0.5"} 3
+latency_seconds_bucket{operation="put",le="1"} 3
+latency_seconds_bucket{operation="put",le="+Inf"} 4
+latency_seconds_sum{operation="put"} 2.45
+latency_seconds_count{operation="put"} 4
+`
+	if builder.String() != expected {
+		t.Fatalf("Expected the histogram to be written as\n%v\nreceived\n%v", expected, builder.String())
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	histogram := NewHistogram([]float64{0.01})
+	histogram.ObserveDuration(5 * time.Millisecond)
+
+	builder := &strings.Builder{}
+	_ = histogram.writeTo(builder, "latency_seconds", "")
+
+	expected := `latency_seconds_bucket{le="0.01"} 1
+latency_seconds_bucket{le="+Inf"} 1
+latency_seconds_sum 0.005
+latency_seconds_count 1
+`
+	if builder.String() != expected {
+		t.Fatalf("Expected the histogram to be written as\n%v\nreceived\n%v", expected, builder.String())
+	}
+}
+
+func TestHistogramIsMonotonicWhileObserving(t *testing.T) {
+	histogram := NewHistogram([]float64{0.1, 1})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				histogram.Observe(0.05)
+				histogram.Observe(5)
+			}
+		}
+	}()
+
+	for attempt := 0; attempt < 1000; attempt++ {
+		builder := &strings.Builder{}
+		_ = histogram.writeTo(builder, "latency_seconds", "")
+
+		var previous uint64
+		var count uint64
+		for _, line := range strings.Split(strings.TrimSpace(builder.String()), "\n") {
+			fields := strings.Fields(line)
+			value, _ := strconv.ParseUint(fields[1], 10, 64)
+			switch {
+			case strings.HasPrefix(fields[0], "latency_seconds_bucket"):
+				if value < previous {
+					t.Fatalf("Expected the buckets to be monotonic, received\n%v", builder.String())
+				}
+				previous = value
+			case fields[0] == "latency_seconds_count":
+				count = value
+			}
+		}
+		if count != previous {
+			t.Fatalf("Expected the count to equal the +Inf bucket, received\n%v", builder.String())
+		}
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// operationDurationBuckets are the upper bounds (in seconds) of the buckets of the latencies of the operations and of the lock waits, from 10µs to 1s
+var operationDurationBuckets = []float64{0.00001, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// mergeDurationBuckets are the upper bounds (in seconds) of the buckets of the durations of the merges, from 10ms to 10 minutes
+var mergeDurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics instruments bitcask and exposes the measurements in the Prometheus text exposition format, refer to Handler.
+// Metrics is optional: it is enabled by config.Config.WithMetrics, and all the methods of a nil *Metrics record nothing, so that the instrumented code does not check for nil.
+// The measurements are cumulative since the Metrics was created, a Metrics shared by two DBs adds up their measurements.
+type Metrics struct {
+	putDuration      *Histogram
+	getDuration      *Histogram
+	deleteDuration   *Histogram
+	readLockWait     *Histogram
+	writeLockWait    *Histogram
+	bytesWritten     Counter
+	bytesRead        Counter
+	segmentRollovers Counter
+	mergeSuccesses   Counter
+	mergeFailures    Counter
+	mergeDuration    *Histogram
+	reloadDuration   Gauge
+}
+
+// family is a metric family of the text exposition format: the series of a metric name, with its HELP and its TYPE
+type family struct {
+	name       string
+	help       string
+	metricType string
+	series     []series
+}
+
+// series is a sample (or the samples of a Histogram) of a family with its labels, formatted as {name="value",...} or empty
+type series struct {
+	labels string
+	metric interface {
+		writeTo(writer io.Writer, name string, labels string) error
+	}
+}
+
+// NewMetrics creates a new instance of Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		putDuration:    NewHistogram(operationDurationBuckets),
+		getDuration:    NewHistogram(operationDurationBuckets),
+		deleteDuration: NewHistogram(operationDurationBuckets),
+		readLockWait:   NewHistogram(operationDurationBuckets),
+		writeLockWait:  NewHistogram(operationDurationBuckets),
+		mergeDuration:  NewHistogram(mergeDurationBuckets),
+	}
+}
+
+// ObservePut records the latency of a put, and the bytes written by the put
+func (metrics *Metrics) ObservePut(duration time.Duration, bytesWritten int64) {
+	if metrics == nil {
+		return
+	}
+	metrics.putDuration.ObserveDuration(duration)
+	metrics.bytesWritten.Add(uint64(bytesWritten))
+}
+
+// ObserveGet records the latency of a get, and the bytes read by the get
+func (metrics *Metrics) ObserveGet(duration time.Duration, bytesRead int64) {
+	if metrics == nil {
+		return
+	}
+	metrics.getDuration.ObserveDuration(duration)
+	metrics.bytesRead.Add(uint64(bytesRead))
+}
+
+// ObserveDelete records the latency of a delete, and the bytes written by the delete
+func (metrics *Metrics) ObserveDelete(duration time.Duration, bytesWritten int64) {
+	if metrics == nil {
+		return
+	}
+	metrics.deleteDuration.ObserveDuration(duration)
+	metrics.bytesWritten.Add(uint64(bytesWritten))
+}
+
+// ObserveReadLockWait records the time spent waiting for the read lock of KVStore
+func (metrics *Metrics) ObserveReadLockWait(duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+	metrics.readLockWait.ObserveDuration(duration)
+}
+
+// ObserveWriteLockWait records the time spent waiting for the exclusive lock of KVStore
+func (metrics *Metrics) ObserveWriteLockWait(duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+	metrics.writeLockWait.ObserveDuration(duration)
+}
+
+// SegmentRolledOver records a rollover of the active segment
+func (metrics *Metrics) SegmentRolledOver() {
+	if metrics == nil {
+		return
+	}
+	metrics.segmentRollovers.Inc()
+}
+
+// ObserveMerge records a merge run with its duration, and whether it failed
+func (metrics *Metrics) ObserveMerge(duration time.Duration, err error) {
+	if metrics == nil {
+		return
+	}
+	if err != nil {
+		metrics.mergeFailures.Inc()
+	} else {
+		metrics.mergeSuccesses.Inc()
+	}
+	metrics.mergeDuration.ObserveDuration(duration)
+}
+
+// ObserveReload records the time taken by the reload of the KeyDirectory during start-up
+func (metrics *Metrics) ObserveReload(duration time.Duration) {
+	if metrics == nil {
+		return
+	}
+	metrics.reloadDuration.Set(duration.Seconds())
+}
+
+// Write writes all the metrics in the Prometheus text exposition format (version 0.0.4). A nil *Metrics writes nothing
+func (metrics *Metrics) Write(writer io.Writer) error {
+	if metrics == nil {
+		return nil
+	}
+	bufferedWriter := bufio.NewWriter(writer)
+	for _, family := range metrics.families() {
+		if _, err := fmt.Fprintf(bufferedWriter, "# HELP %v %v\n# TYPE %v %v\n", family.name, family.help, family.name, family.metricType); err != nil {
+			return err
+		}
+		for _, series := range family.series {
+			if err := series.metric.writeTo(bufferedWriter, family.name, series.labels); err != nil {
+				return err
+			}
+		}
+	}
+	return bufferedWriter.Flush()
+}
+
+// Handler returns an http.Handler which responds with all the metrics in the Prometheus text exposition format, to be scraped by Prometheus.
+// The Handler of a nil *Metrics responds with an empty body
+func (metrics *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = metrics.Write(writer)
+	})
+}
+
+// families returns all the metric families, in a fixed order
+func (metrics *Metrics) families() []family {
+	return []family{
+		{
+			name:       "bitcask_operation_duration_seconds",
+			help:       "Latency of the put, get and delete operations, including the time spent waiting for the lock (excluding it for every key of a multi put and a multi get).",
+			metricType: "histogram",
+			series: []series{
+				{labels: `{operation="put"}`, metric: metrics.putDuration},
+				{labels: `{operation="get"}`, metric: metrics.getDuration},
+				{labels: `{operation="delete"}`, metric: metrics.deleteDuration},
+			},
+		},
+		{
+			name:       "bitcask_lock_wait_seconds",
+			help:       "Time spent by the operations waiting for the lock of the key value store.",
+			metricType: "histogram",
+			series: []series{
+				{labels: `{lock="read"}`, metric: metrics.readLockWait},
+				{labels: `{lock="write"}`, metric: metrics.writeLockWait},
+			},
+		},
+		{
+			name:       "bitcask_written_bytes_total",
+			help:       "Bytes appended to the segment files by the put and delete operations.",
+			metricType: "counter",
+			series:     []series{{metric: &metrics.bytesWritten}},
+		},
+		{
+			name:       "bitcask_read_bytes_total",
+			help:       "Bytes of the entries read by the get operations, including the entries served by the value cache.",
+			metricType: "counter",
+			series:     []series{{metric: &metrics.bytesRead}},
+		},
+		{
+			name:       "bitcask_segment_rollovers_total",
+			help:       "Rollovers of the active segment file.",
+			metricType: "counter",
+			series:     []series{{metric: &metrics.segmentRollovers}},
+		},
+		{
+			name:       "bitcask_merge_runs_total",
+			help:       "Merge runs which merged at least one segment file, by outcome.",
+			metricType: "counter",
+			series: []series{
+				{labels: `{outcome="success"}`, metric: &metrics.mergeSuccesses},
+				{labels: `{outcome="failure"}`, metric: &metrics.mergeFailures},
+			},
+		},
+		{
+			name:       "bitcask_merge_duration_seconds",
+			help:       "Duration of the merge runs which merged at least one segment file.",
+			metricType: "histogram",
+			series:     []series{{metric: metrics.mergeDuration}},
+		},
+		{
+			name:       "bitcask_reload_duration_seconds",
+			help:       "Time taken by the last reload of the key directory during start-up.",
+			metricType: "gauge",
+			series:     []series{{metric: &metrics.reloadDuration}},
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNilMetricsRecordNothing(t *testing.T) {
+	var metrics *Metrics
+	metrics.ObservePut(time.Millisecond, 10)
+	metrics.ObserveGet(time.Millisecond, 10)
+	metrics.ObserveDelete(time.Millisecond, 10)
+	metrics.ObserveReadLockWait(time.Millisecond)
+	metrics.ObserveWriteLockWait(time.Millisecond)
+	metrics.SegmentRolledOver()
+	metrics.ObserveMerge(time.Second, nil)
+	metrics.ObserveReload(time.Second)
+
+	builder := &strings.Builder{}
+	if err := metrics.Write(builder); err != nil || builder.Len() != 0 {
+		t.Fatalf("Expected a nil Metrics to write nothing, received %v, %v", builder.String(), err)
+	}
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("Expected the Handler of a nil Metrics to respond with an empty body, received %v", recorder.Body.String())
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.ObservePut(2*time.Millisecond, 30)
+	metrics.ObservePut(3*time.Millisecond, 20)
+	metrics.ObserveGet(time.Millisecond, 30)
+	metrics.ObserveDelete(time.Millisecond, 15)
+	metrics.SegmentRolledOver()
+	metrics.ObserveMerge(time.Second, nil)
+	metrics.ObserveMerge(time.Second, errors.New("merge failed"))
+	metrics.ObserveReload(1500 * time.Millisecond)
+
+	builder := &strings.Builder{}
+	if err := metrics.Write(builder); err != nil {
+		t.Fatalf("Expected no error while writing the metrics, received %v", err)
+	}
+	written := builder.String()
+	for _, expected := range []string{
+		"# HELP bitcask_operation_duration_seconds ",
+		"# TYPE bitcask_operation_duration_seconds histogram\n",
+		`bitcask_operation_duration_seconds_bucket{operation="put",le="0.0025"} 1` + "\n",
+		`bitcask_operation_duration_seconds_count{operation="put"} 2` + "\n",
+		`bitcask_operation_duration_seconds_count{operation="get"} 1` + "\n",
+		`bitcask_operation_duration_seconds_count{operation="delete"} 1` + "\n",
+		`bitcask_lock_wait_seconds_count{lock="read"} 0` + "\n",
+		"# TYPE bitcask_written_bytes_total counter\nbitcask_written_bytes_total 65\n",
+		"bitcask_read_bytes_total 30\n",
+		"bitcask_segment_rollovers_total 1\n",
+		`bitcask_merge_runs_total{outcome="success"} 1` + "\n",
+		`bitcask_merge_runs_total{outcome="failure"} 1` + "\n",
+		"bitcask_merge_duration_seconds_count 2\n",
+		"# TYPE bitcask_reload_duration_seconds gauge\nbitcask_reload_duration_seconds 1.5\n",
+	} {
+		if !strings.Contains(written, expected) {
+			t.Fatalf("Expected the metrics to contain %q, received\n%v", expected, written)
+		}
+	}
+}
+
+func TestHandlerServesTheMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.SegmentRolledOver()
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("Expected the content type of the text exposition format, received %v", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "bitcask_segment_rollovers_total 1\n") {
+		t.Fatalf("Expected the response to contain the rollovers, received\n%v", recorder.Body.String())
+	}
+}